@@ -3,29 +3,53 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ruskiiamov/shortener/internal/access"
 	"github.com/ruskiiamov/shortener/internal/chi"
 	"github.com/ruskiiamov/shortener/internal/config"
 	"github.com/ruskiiamov/shortener/internal/data"
 	"github.com/ruskiiamov/shortener/internal/grpcserver"
+	"github.com/ruskiiamov/shortener/internal/lifecycle"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/metrics"
+	"github.com/ruskiiamov/shortener/internal/outbox"
+	"github.com/ruskiiamov/shortener/internal/probe"
 	pb "github.com/ruskiiamov/shortener/internal/proto"
+	pbv2 "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
 	"github.com/ruskiiamov/shortener/internal/server"
+	"github.com/ruskiiamov/shortener/internal/tlscert"
+	"github.com/ruskiiamov/shortener/internal/tracing"
 	"github.com/ruskiiamov/shortener/internal/url"
 	"github.com/ruskiiamov/shortener/internal/user"
-	"golang.org/x/crypto/acme/autocert"
-	"golang.org/x/sync/errgroup"
+	"github.com/ruskiiamov/shortener/internal/webhook"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
-const maxShutdownTime = 3 * time.Second
+const (
+	outboxInterval = time.Second
+
+	healthCheckInterval = 5 * time.Second
+	readinessTimeout    = time.Second
+
+	checkDeleteWorker = "delete_worker"
+
+	serviceName = "shortener"
+)
 
 var (
 	buildVersion string = `"N/A"`
@@ -34,92 +58,428 @@ var (
 )
 
 func main() {
-	go func() {
-		http.ListenAndServe(":9090", nil)
-	}()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.PrintConfig {
+		if err = cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
-	config, err := config.Load()
+	logLevel, err := zap.ParseAtomicLevel(cfg.LogLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	dataKeeper, err := data.NewKeeper(config.DatabaseDSN, config.FileStoragePath)
+	l, err := logger.NewWithLevel(logLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer l.Sync()
 
-	userAuthorizer := user.NewAuthorizer([]byte(config.AuthSignKey))
-	urlConverter := url.NewConverter(dataKeeper)
-	delBuf := url.StartDeleteURL(ctx, urlConverter)
+	zap.ReplaceGlobals(l)
+	zap.RedirectStdLog(l)
 
-	router := chi.NewRouter()
-	handler, err := server.NewHandler(ctx, userAuthorizer, urlConverter, router, delBuf, config.BaseURL, config.TrustedSubnet)
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:       cfg.TraceExporter,
+		Endpoint:       cfg.TraceEndpoint,
+		Insecure:       cfg.TraceInsecure,
+		SampleRatio:    cfg.TraceSampleRatio,
+		ServiceName:    serviceName,
+		ServiceVersion: strings.Trim(buildVersion, `"`),
+	})
 	if err != nil {
-		log.Fatal(err)
+		l.Fatal("startup error", zap.Error(err))
 	}
 
-	manager := &autocert.Manager{Prompt: autocert.AcceptTOS}
+	serviceMetrics := metrics.New()
 
-	httpServer := &http.Server{
-		Addr:    config.ServerAddress,
-		Handler: handler,
-		BaseContext: func(_ net.Listener) context.Context {
-			return ctx
-		},
-		TLSConfig: manager.TLSConfig(),
+	dataKeeper, err := data.NewKeeper(cfg.DatabaseDSN, cfg.FileStoragePath, l.Named("data"))
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
 	}
+	readiness := probe.NewChecker(readinessTimeout, l.Named("probe"))
+	readiness.Add(data.Checks(dataKeeper)...)
 
-	listen, err := net.Listen("tcp", "127.0.0.1:3200")
+	dataKeeper = serviceMetrics.WrapDataKeeper(dataKeeper, data.Backend(cfg.DatabaseDSN))
+
+	auditSink, err := data.NewAuditSink(cfg.DatabaseDSN, cfg.AuditLogPath, l.Named("audit"))
 	if err != nil {
-		log.Fatal(err)
+		l.Fatal("startup error", zap.Error(err))
+	}
+
+	webhookStore, err := data.NewWebhookStore(cfg.DatabaseDSN, cfg.FileStoragePath, l.Named("webhook"))
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
+
+	var urlConverter url.Converter
+
+	webhookOptions := webhook.DefaultOptions()
+	webhookOptions.Logger = l.Named("webhook")
+	webhookOptions.AllowedSubnets, err = access.ParseCIDRs(cfg.WebhookAllowedSubnets)
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
 	}
 
-	authInterceptor := grpcserver.NewAuthInterceptor(userAuthorizer)
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor))
-	pb.RegisterShortenerServer(grpcServer, grpcserver.NewGRPCServer(urlConverter, delBuf))
+	webhooks := webhook.NewDispatcher(webhookStore, func(ctx context.Context, linkID string) (string, error) {
+		return urlConverter.GetOwner(ctx, linkID)
+	}, webhookOptions)
+
+	domains, err := cfg.ShortDomains()
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
 
-	g, gCtx := errgroup.WithContext(ctx)
+	userAuthorizer := user.NewAuthorizer([]byte(cfg.AuthSignKey))
+	urlConverter = tracing.WrapConverter(url.NewConverter(dataKeeper, cfg.Quota(), auditSink, webhooks, domains, l.Named("url")))
+	// The delete worker and the handlers outlive the signal, they are
+	// stopped by the lifecycle manager.
+	delBuf, deleteWorker := url.StartDeleteURL(context.Background(), urlConverter, auditSink, serviceMetrics, l.Named("url"))
+	readiness.Add(probe.Check{Name: checkDeleteWorker, Func: deleteWorker.Check})
 
-	g.Go(func() error {
-		if config.EnableHTTPS {
-			return httpServer.ListenAndServeTLS("", "")
+	publishers := []outbox.Publisher{outbox.Forward(webhooks)}
+	if cfg.OutboxFilePath != "" {
+		filePublisher, err := outbox.NewFilePublisher(cfg.OutboxFilePath)
+		if err != nil {
+			l.Fatal("startup error", zap.Error(err))
 		}
-		return httpServer.ListenAndServe()
-	})
+		defer filePublisher.Close()
+		publishers = append(publishers, filePublisher)
+	}
 
-	g.Go(func() error {
-		return grpcServer.Serve(listen)
-	})
+	relay := outbox.NewRelay(dataKeeper, outboxInterval, l.Named("outbox"), publishers...)
+
+	rateLimitRules, err := cfg.RateLimitRules()
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
+
+	rateLimitBackend, err := data.NewLimitBackend(cfg.DatabaseDSN, l.Named("ratelimit"))
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
 
-	g.Go(func() error {
-		<-gCtx.Done()
+	rateLimiter := ratelimit.NewLimiter(rateLimitBackend, rateLimitRules)
 
-		ctx, cancel := context.WithTimeout(context.Background(), maxShutdownTime)
-		defer cancel()
+	accessChecker, err := access.NewChecker(cfg.TrustedSubnet, cfg.TrustedProxies)
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
+
+	router := chi.NewRouter()
+	router.AddMiddlewares(
+		tracing.Middleware(router.RoutePattern),
+		serviceMetrics.HTTPMiddleware(router.RoutePattern),
+	)
+	handler, err := server.NewHandler(ctx, userAuthorizer, urlConverter, rateLimiter, webhooks, router, delBuf, domains, accessChecker, readiness, l.Named("http"))
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
 
-		grpcServer.Stop()
+	httpServer := &http.Server{
+		Addr:    cfg.ServerAddress,
+		Handler: handler,
+	}
 
-		err = httpServer.Shutdown(ctx)
+	var redirectServer *http.Server
+	if cfg.EnableHTTPS {
+		certs, err := tlscert.New(tlscert.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			Hosts:        cfg.Hosts(),
+			CacheDir:     cfg.AutocertCacheDir,
+			DirectoryURL: cfg.AutocertDirectoryURL,
+			Email:        cfg.AutocertEmail,
+			Logger:       l.Named("tls"),
+		})
 		if err != nil {
-			log.Printf("server shutdown error: %s", err)
+			l.Fatal("startup error", zap.Error(err))
+		}
+		httpServer.TLSConfig = certs.TLSConfig()
+
+		if cfg.HTTPRedirectAddress != "" {
+			_, httpsPort, _ := net.SplitHostPort(cfg.ServerAddress)
+			redirectServer = &http.Server{
+				Addr:    cfg.HTTPRedirectAddress,
+				Handler: certs.RedirectHandler(httpsPort),
+			}
 		}
+	}
 
-		close(delBuf)
+	listen, err := net.Listen("tcp", cfg.GRPCAddress)
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
+
+	grpcTLS, err := cfg.GRPCTLS()
+	if err != nil {
+		l.Fatal("startup error", zap.Error(err))
+	}
 
-		err = dataKeeper.Close(ctx)
+	accessInterceptor := tracing.WrapUnary("access", grpcserver.NewAccessInterceptor(accessChecker))
+	accessStreamInterceptor := tracing.WrapStream("access", grpcserver.NewAccessStreamInterceptor(accessChecker))
+	rateLimitInterceptor := tracing.WrapUnary("rate_limit", grpcserver.NewRateLimitInterceptor(rateLimiter, userAuthorizer, accessChecker))
+	rateLimitStreamInterceptor := tracing.WrapStream("rate_limit", grpcserver.NewRateLimitStreamInterceptor(rateLimiter, userAuthorizer, accessChecker))
+	authInterceptor := tracing.WrapUnary("auth", grpcserver.NewAuthInterceptor(userAuthorizer, accessChecker))
+	authStreamInterceptor := tracing.WrapStream("auth", grpcserver.NewAuthStreamInterceptor(userAuthorizer, accessChecker))
+	loggingInterceptor := grpcserver.NewLoggingInterceptor(l.Named("grpc"))
+	loggingStreamInterceptor := grpcserver.NewLoggingStreamInterceptor(l.Named("grpc"))
+	grpcOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(tracing.UnaryInterceptor(), serviceMetrics.UnaryInterceptor(), loggingInterceptor, accessInterceptor, rateLimitInterceptor, authInterceptor),
+		grpc.ChainStreamInterceptor(tracing.StreamInterceptor(), serviceMetrics.StreamInterceptor(), loggingStreamInterceptor, accessStreamInterceptor, rateLimitStreamInterceptor, authStreamInterceptor),
+	}
+	if grpcTLS {
+		creds, err := grpcserver.NewCredentials(cfg.GRPCCertFile, cfg.GRPCKeyFile, cfg.GRPCClientCAFile)
 		if err != nil {
-			log.Printf("data keeper close error: %s", err)
+			l.Fatal("startup error", zap.Error(err))
 		}
+		grpcOptions = append(grpcOptions, grpc.Creds(creds))
+	}
+
+	grpcServer := grpc.NewServer(grpcOptions...)
+	shortenerServer := grpcserver.NewGRPCServer(urlConverter, delBuf)
+	pbv2.RegisterShortenerServer(grpcServer, shortenerServer)
+	pb.RegisterShortenerServer(grpcServer, grpcserver.NewLegacyServer(shortenerServer))
 
-		return err
+	healthServer := grpcserver.NewHealth(readiness, healthCheckInterval)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	if cfg.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+
+	reloader := config.NewReloader(cfg, nil, l.Named("config"))
+	reloader.Subscribe("access", func(c *config.Config) error {
+		return accessChecker.Update(c.TrustedSubnet, c.TrustedProxies)
 	})
+	reloader.Subscribe("rate_limit", func(c *config.Config) error {
+		rules, err := c.RateLimitRules()
+		if err != nil {
+			return err
+		}
+		rateLimiter.SetRules(rules)
+		return nil
+	})
+	reloader.Subscribe("logger", func(c *config.Config) error {
+		return logLevel.UnmarshalText([]byte(c.LogLevel))
+	})
+
+	// pprof handlers are registered in http.DefaultServeMux.
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/config/reload", reloader)
+	adminMux.Handle("/metrics", serviceMetrics.Handler())
+	adminMux.Handle("/debug/pprof/", http.DefaultServeMux)
+
+	adminServer := &http.Server{
+		Addr:    cfg.AdminAddress,
+		Handler: adminMux,
+	}
+
+	lc := lifecycle.New(cfg.ShutdownTimeout, l.Named("lifecycle"))
+
+	lc.Add(lifecycle.Hook{
+		Name: "tracing",
+		Stop: shutdownTracing,
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name: "admin",
+		Serve: func() error {
+			return serveHTTP(adminServer.ListenAndServe)
+		},
+		Stop: adminServer.Shutdown,
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name: "storage",
+		Stop: dataKeeper.Close,
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name: "audit",
+		Stop: func(context.Context) error {
+			return auditSink.Close()
+		},
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name: "webhook_store",
+		Stop: func(context.Context) error {
+			return webhookStore.Close()
+		},
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name: "rate_limit",
+		Stop: func(context.Context) error {
+			return rateLimitBackend.Close()
+		},
+	})
+
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	lc.Add(lifecycle.Hook{
+		Name:      "webhooks",
+		DependsOn: []string{"storage", "webhook_store"},
+		Start: func(context.Context) error {
+			webhooks.Start(webhooksCtx)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopWebhooks()
+			return wait(ctx, webhooks.Wait)
+		},
+	})
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	lc.Add(lifecycle.Hook{
+		Name:      "outbox",
+		DependsOn: []string{"storage", "webhooks"},
+		Start: func(context.Context) error {
+			relay.Start(relayCtx)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopRelay()
+			return wait(ctx, relay.Wait)
+		},
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name:      "delete_worker",
+		DependsOn: []string{"storage", "audit"},
+		Stop:      deleteWorker.Stop,
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name:      "grpc",
+		DependsOn: []string{"storage", "webhooks", "delete_worker", "rate_limit"},
+		Serve: func() error {
+			return grpcServer.Serve(listen)
+		},
+		Stop: func(ctx context.Context) error {
+			err := wait(ctx, grpcServer.GracefulStop)
+			if err != nil {
+				grpcServer.Stop()
+			}
+			return err
+		},
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name:      "http",
+		DependsOn: []string{"storage", "webhooks", "delete_worker", "rate_limit"},
+		Serve: func() error {
+			if cfg.EnableHTTPS {
+				return serveHTTP(func() error { return httpServer.ListenAndServeTLS("", "") })
+			}
+			return serveHTTP(httpServer.ListenAndServe)
+		},
+		Stop: func(ctx context.Context) error {
+			err := httpServer.Shutdown(ctx)
+			if err != nil {
+				httpServer.Close()
+			}
+			return err
+		},
+	})
+
+	if redirectServer != nil {
+		lc.Add(lifecycle.Hook{
+			Name: "http_redirect",
+			Serve: func() error {
+				return serveHTTP(redirectServer.ListenAndServe)
+			},
+			Stop: redirectServer.Shutdown,
+		})
+	}
+
+	hup := make(chan os.Signal, 1)
+	stopReload := make(chan struct{})
+	lc.Add(lifecycle.Hook{
+		Name: "config_reload",
+		Start: func(context.Context) error {
+			signal.Notify(hup, syscall.SIGHUP)
+			go func() {
+				for {
+					select {
+					case <-stopReload:
+						return
+					case <-hup:
+						reloader.Reload()
+					}
+				}
+			}()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			signal.Stop(hup)
+			close(stopReload)
+			return nil
+		},
+	})
+
+	lc.Add(lifecycle.Hook{
+		Name:      "readiness",
+		DependsOn: []string{"http", "grpc"},
+		Start: func(ctx context.Context) error {
+			healthServer.Start(ctx)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			readiness.Shutdown()
+			healthServer.Shutdown()
+			return sleep(ctx, cfg.ShutdownDelay)
+		},
+	})
+
+	if err = lc.Run(ctx); err != nil {
+		l.Error("exit", zap.Error(err))
+	}
+}
+
+// serveHTTP runs serve, the error of the closed server is not returned.
+func serveHTTP(serve func() error) error {
+	err := serve()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// wait runs the blocking f and waits for it within ctx.
+func wait(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
 
-	if err = g.Wait(); err != nil {
-		log.Printf("exit: %s", err)
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
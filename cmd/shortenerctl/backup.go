@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/backup"
+)
+
+// backupPath is the service endpoint of the online backup.
+const backupPath = "/api/internal/backup"
+
+func runBackup(ctx context.Context, a *app, args []string) error {
+	var storage storageFlags
+	var out string
+	var online bool
+
+	fs := newOfflineFlagSet("backup", &storage)
+	fs.StringVar(&out, "out", fmt.Sprintf("shortener-%s.backup", time.Now().UTC().Format("20060102T150405Z")), "Archive file")
+	fs.BoolVar(&online, "online", false, "Download the archive from the running service over HTTP (trusted subnets only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The archive is written to the temporary file, so the broken archive
+	// never replaces the previous one.
+	tmp := out + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	if online {
+		err = a.downloadBackup(ctx, file)
+	} else {
+		err = writeBackup(ctx, &storage, file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	m, err := backup.Verify(file)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, out); err != nil {
+		return err
+	}
+
+	return a.printManifest(out, m)
+}
+
+func writeBackup(ctx context.Context, storage *storageFlags, w io.Writer) error {
+	keeper, err := storage.open(false)
+	if err != nil {
+		return err
+	}
+	defer closeKeeper(keeper)
+
+	_, err = backup.Write(ctx, keeper, w)
+	return err
+}
+
+// downloadBackup saves the archive from the service backup endpoint.
+func (a *app) downloadBackup(ctx context.Context, w io.Writer) error {
+	transport, server, err := a.resolve()
+	if err != nil {
+		return err
+	}
+	if transport != transportHTTP {
+		return fmt.Errorf("%w: online backup requires http transport", errUsage)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(server, "/")+backupPath, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var details struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		}
+		json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&details)
+		return fmt.Errorf("backup request: %s: %s", res.Status, firstNonEmpty(details.Detail, details.Title))
+	}
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+func runRestore(ctx context.Context, a *app, args []string) error {
+	var storage storageFlags
+	var in string
+	var force bool
+
+	fs := newOfflineFlagSet("restore", &storage)
+	fs.StringVar(&in, "in", "", "Archive file")
+	fs.BoolVar(&force, "force", false, "Clear the data storage with records before restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if in == "" {
+		return fmt.Errorf("%w: archive file required", errUsage)
+	}
+
+	file, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	keeper, err := storage.open(true)
+	if err != nil {
+		return err
+	}
+	defer closeKeeper(keeper)
+
+	m, err := backup.Restore(ctx, keeper, file, force)
+	if err != nil {
+		return err
+	}
+
+	return a.printManifest(in, m)
+}
+
+func (a *app) printManifest(path string, m *backup.Manifest) error {
+	return a.print(m, []string{"FILE", "CREATED", "RECORDS", "DELETED", "USERS", "QUOTAS", "NEXT ID", "SHA256"}, [][]string{{
+		path,
+		m.Created.Format(time.RFC3339),
+		fmt.Sprint(m.Records),
+		fmt.Sprint(m.Deleted),
+		fmt.Sprint(m.Users),
+		fmt.Sprint(m.Quotas),
+		fmt.Sprint(m.NextID),
+		m.SHA256,
+	}})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultHTTPServer = "http://localhost:8080"
+	defaultGRPCServer = "localhost:3200"
+)
+
+// ctlConfig is the config file of the tool.
+type ctlConfig struct {
+	Server    string `json:"server,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	TLS       bool   `json:"tls,omitempty"`
+	CAFile    string `json:"ca_file,omitempty"`
+	AuthToken string `json:"token,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".shortenerctl.json"
+	}
+
+	return filepath.Join(dir, "shortenerctl", "config.json")
+}
+
+// loadConfig reads the config file. Missing file means empty config.
+func loadConfig(path string) (*ctlConfig, error) {
+	c := &ctlConfig{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// save writes the config file readable by the owner only, it keeps the token.
+func (c *ctlConfig) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+
+	if err = os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+
+	return nil
+}
+
+// Token implements client.TokenStore interface.
+func (c *ctlConfig) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.AuthToken, nil
+}
+
+// SetToken implements client.TokenStore interface. The config file is saved
+// with the new token.
+func (c *ctlConfig) SetToken(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.AuthToken = token
+
+	return c.save()
+}
+
+// resolve returns the transport and the server address from the flags, the
+// config file and the defaults.
+func (a *app) resolve() (transport, server string, err error) {
+	transport = firstNonEmpty(a.transport, a.config.Transport, transportHTTP)
+	if transport != transportHTTP && transport != transportGRPC {
+		return "", "", fmt.Errorf("%w: unknown transport %s", errUsage, transport)
+	}
+
+	server = firstNonEmpty(a.server, a.config.Server)
+	if server == "" {
+		server = defaultHTTPServer
+		if transport == transportGRPC {
+			server = defaultGRPCServer
+		}
+	}
+
+	if transport == transportHTTP && !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+
+	return transport, server, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,200 @@
+// Shortenerctl is the command-line management tool for shortener service.
+//
+// Usage:
+//
+//	shortenerctl [flags] command [command flags] [args]
+//
+// Commands talking to the service over HTTP or gRPC:
+//
+//	shorten URL...   shorten URLs
+//	batch FILE       shorten URLs from the file, one per line, "-" for stdin
+//	list             list links of the user
+//	delete ID...     delete links of the user
+//	resolve ID       print the original URL of the link
+//	stats            print service statistics (trusted subnets only)
+//	ping             check the service storage
+//	config           save the flags to the config file
+//
+// Offline commands working directly on the data storage, which must not be
+// used by the service at the same time:
+//
+//	export           write all records as JSON lines
+//	import           save records from JSON lines with their ids
+//	verify           compare records from JSON lines with the data storage
+//	migrate          move all records, quota overrides and the id sequence to
+//	                 another storage
+//	backup           write the checksummed archive of the data storage, or
+//	                 download it from the running service with -online
+//	restore          restore the archive to the data storage
+//
+// Remote commands are limited by -timeout, 30s by default. Offline commands
+// have no limit unless -timeout is set.
+//
+// The auth token issued by the service is saved to the config file, so all
+// calls are made by the same user.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+
+	outputTable = "table"
+	outputJSON  = "json"
+
+	// maxCloseTime limits saving the data storage by offline commands.
+	maxCloseTime = 10 * time.Second
+
+	// defaultTimeout limits remote commands if -timeout is not set.
+	defaultTimeout = 30 * time.Second
+)
+
+var errUsage = errors.New("usage error")
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, app *app, args []string) error
+
+	// offline commands work over the whole data storage and have no
+	// timeout by default.
+	offline bool
+}
+
+// commands is set in init because the commands refer to their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"shorten": {"shorten URL...", runShorten, false},
+		"batch":   {"batch FILE", runBatch, false},
+		"list":    {"list", runList, false},
+		"delete":  {"delete ID...", runDelete, false},
+		"resolve": {"resolve ID", runResolve, false},
+		"stats":   {"stats", runStats, false},
+		"ping":    {"ping", runPing, false},
+		"config":  {"config", runConfig, false},
+		"export":  {"export [-d DSN | -f FILE] [-out FILE]", runExport, true},
+		"import":  {"import [-d DSN | -f FILE] [-in FILE]", runImport, true},
+		"verify":  {"verify [-d DSN | -f FILE] [-in FILE]", runVerify, true},
+		"migrate": {"migrate [-from-d DSN | -from-f FILE] [-to-d DSN | -to-f FILE] [-dry-run] [-verify]", runMigrate, true},
+		"backup":  {"backup [-d DSN | -f FILE | -online] [-out FILE]", runBackup, true},
+		"restore": {"restore [-d DSN | -f FILE] -in FILE [-force]", runRestore, true},
+	}
+}
+
+var commandOrder = []string{"shorten", "batch", "list", "delete", "resolve", "stats", "ping", "config", "export", "import", "verify", "migrate", "backup", "restore"}
+
+// app is the state shared by commands.
+type app struct {
+	configPath string
+	config     *ctlConfig
+
+	// Flags override the config file values.
+	server    string
+	transport string
+	tls       bool
+	caFile    string
+
+	output     string
+	timeout    time.Duration
+	timeoutSet bool
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("shortenerctl: ")
+
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	a := &app{stdin: stdin, stdout: stdout}
+
+	fs := flag.NewFlagSet("shortenerctl", flag.ContinueOnError)
+	fs.StringVar(&a.configPath, "config", defaultConfigPath(), "Config file path")
+	fs.StringVar(&a.server, "server", "", "Service address, e.g. http://localhost:8080 or localhost:3200")
+	fs.StringVar(&a.transport, "transport", "", "Transport: http or grpc")
+	fs.BoolVar(&a.tls, "tls", false, "Use TLS for gRPC")
+	fs.StringVar(&a.caFile, "ca", "", "CA file for gRPC TLS")
+	fs.StringVar(&a.output, "o", outputTable, "Output format: table or json")
+	fs.DurationVar(&a.timeout, "timeout", 0, fmt.Sprintf("Command timeout, 0 means no limit (default %s for remote commands, no limit for offline ones)", defaultTimeout))
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: shortenerctl [flags] command [command flags] [args]")
+		fmt.Fprintln(out, "\nCommands:")
+		for _, name := range commandOrder {
+			fmt.Fprintf(out, "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "timeout" {
+			a.timeoutSet = true
+		}
+	})
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: command required", errUsage)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("%w: unknown command %s", errUsage, fs.Arg(0))
+	}
+
+	if a.output != outputTable && a.output != outputJSON {
+		return fmt.Errorf("%w: unknown output format %s", errUsage, a.output)
+	}
+
+	config, err := loadConfig(a.configPath)
+	if err != nil {
+		return err
+	}
+	a.config = config
+
+	ctx := context.Background()
+	if timeout := a.commandTimeout(cmd); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return cmd.run(ctx, a, fs.Args()[1:])
+}
+
+// commandTimeout returns the -timeout value if it is set, otherwise
+// defaultTimeout for remote commands and no limit for offline ones.
+func (a *app) commandTimeout(cmd command) time.Duration {
+	if a.timeoutSet {
+		return a.timeout
+	}
+
+	if cmd.offline {
+		return 0
+	}
+
+	return defaultTimeout
+}
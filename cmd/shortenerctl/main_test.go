@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/backup"
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/server"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCtl(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout)
+
+	return stdout.String(), err
+}
+
+func TestRemoteCommands(t *testing.T) {
+	keeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+
+	converter := url.NewConverter(keeper, url.Quota{}, nil, nil, nil, nil)
+	h, err := server.NewHandler(
+		context.Background(),
+		user.NewAuthorizer([]byte("secret")),
+		converter,
+		nil,
+		nil,
+		chi.NewRouter(),
+		make(chan *url.DelBatch, 1),
+		url.NewDomains(url.Domain{BaseURL: "http://short.test"}),
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	config := filepath.Join(t.TempDir(), "config.json")
+
+	_, err = runCtl(t, "", "-config", config, "-server", ts.URL, "config")
+	require.NoError(t, err)
+
+	out, err := runCtl(t, "", "-config", config, "shorten", "http://example.com/a")
+	require.NoError(t, err)
+	assert.Contains(t, out, "http://short.test/1")
+
+	out, err = runCtl(t, "http://example.com/a\n# comment\n\nhttp://example.com/b\n", "-config", config, "-o", "json", "batch", "-")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"correlation_id": "4"`)
+
+	// The saved token makes all calls on behalf of one user.
+	out, err = runCtl(t, "", "-config", config, "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "http://example.com/a")
+	assert.Contains(t, out, "http://example.com/b")
+
+	out, err = runCtl(t, "", "-config", config, "resolve", "2")
+	require.NoError(t, err)
+	assert.Contains(t, out, "http://example.com/b")
+
+	_, err = runCtl(t, "", "-config", config, "resolve", "zzzz")
+	assert.Error(t, err)
+
+	_, err = runCtl(t, "", "-config", config, "unknown")
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestOfflineCommands(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.json")
+	dst := filepath.Join(dir, "dst.json")
+	dump := filepath.Join(dir, "dump.jsonl")
+	config := filepath.Join(dir, "config.json")
+
+	keeper, err := data.NewKeeper("", src, nil)
+	require.NoError(t, err)
+	_, _, err = keeper.AddBatch(context.Background(), "user1", "", []string{"http://example.com/a", "http://example.com/b"})
+	require.NoError(t, err)
+	_, err = keeper.DeleteBatch(context.Background(), map[string][]int{"user1": {1}})
+	require.NoError(t, err)
+	require.NoError(t, keeper.Close(context.Background()))
+
+	_, err = runCtl(t, "", "-config", config, "export", "-f", src, "-out", dump)
+	require.NoError(t, err)
+
+	out, err := runCtl(t, "", "-config", config, "import", "-f", dst, "-in", dump)
+	require.NoError(t, err)
+	assert.Contains(t, out, "2 records imported")
+
+	out, err = runCtl(t, "", "-config", config, "verify", "-f", dst, "-in", dump)
+	require.NoError(t, err)
+	assert.Contains(t, out, "2 records verified")
+
+	_, err = runCtl(t, "", "-config", config, "import", "-f", dst, "-in", dump)
+	assert.ErrorIs(t, err, url.ErrImportConflict)
+
+	_, err = runCtl(t, `{"id":3,"url":"http://example.com/c","user_id":"user1","deleted":false}`, "-config", config, "verify", "-f", dst)
+	assert.Error(t, err)
+
+	_, err = runCtl(t, "", "-config", config, "export", "-f", filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	migrated := filepath.Join(dir, "migrated.json")
+
+	out, err = runCtl(t, "", "-config", config, "-o", "json", "migrate", "-from-f", src, "-to-f", migrated)
+	require.NoError(t, err)
+	assert.Contains(t, out, `"verified": true`)
+
+	_, err = runCtl(t, "", "-config", config, "migrate", "-from-f", src, "-to-f", migrated, "-dry-run")
+	assert.Error(t, err)
+	archive := filepath.Join(dir, "shortener.backup")
+
+	out, err = runCtl(t, "", "-config", config, "-o", "json", "backup", "-f", src, "-out", archive)
+	require.NoError(t, err)
+	assert.Contains(t, out, `"records": 2`)
+
+	_, err = runCtl(t, "", "-config", config, "restore", "-f", dst, "-in", archive)
+	assert.ErrorIs(t, err, backup.ErrNotEmpty)
+
+	restored := filepath.Join(dir, "restored.json")
+
+	_, err = runCtl(t, "", "-config", config, "restore", "-f", restored, "-in", archive)
+	require.NoError(t, err)
+
+	out, err = runCtl(t, "", "-config", config, "verify", "-f", restored, "-in", dump)
+	require.NoError(t, err)
+	assert.Contains(t, out, "2 records verified")
+
+	_, err = runCtl(t, "", "-config", config, "restore", "-f", dst, "-in", archive, "-force")
+	require.NoError(t, err)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		app  app
+		cmd  string
+		want time.Duration
+	}{
+		{name: "remote default", cmd: "list", want: defaultTimeout},
+		{name: "offline default", cmd: "migrate", want: 0},
+		{name: "remote set", app: app{timeout: time.Minute, timeoutSet: true}, cmd: "list", want: time.Minute},
+		{name: "offline set", app: app{timeout: time.Hour, timeoutSet: true}, cmd: "migrate", want: time.Hour},
+		{name: "no limit", app: app{timeoutSet: true}, cmd: "list", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.app.commandTimeout(commands[tt.cmd]))
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/migrate"
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// importChunkSize is the number of records saved in one Import call.
+const importChunkSize = 1000
+
+// storageFlags are the data storage flags of the offline commands.
+type storageFlags struct {
+	dsn  string
+	file string
+}
+
+func (s *storageFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.dsn, "d", os.Getenv("DATABASE_DSN"), "Database DSN")
+	fs.StringVar(&s.file, "f", os.Getenv("FILE_STORAGE_PATH"), "File storage path")
+}
+
+// open returns the data keeper. The file storage must exist unless create
+// is set.
+func (s *storageFlags) open(create bool) (url.DataKeeper, error) {
+	if s.dsn == "" && s.file == "" {
+		return nil, fmt.Errorf("%w: database DSN or file storage path required", errUsage)
+	}
+
+	if s.dsn == "" && !create {
+		if _, err := os.Stat(s.file); err != nil {
+			return nil, err
+		}
+	}
+
+	return data.NewKeeper(s.dsn, s.file, nil)
+}
+
+func closeKeeper(k url.DataKeeper) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxCloseTime)
+	defer cancel()
+
+	if err := k.Close(ctx); err != nil {
+		log.Printf("data keeper close error: %s", err)
+	}
+}
+
+func newOfflineFlagSet(name string, s *storageFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	s.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shortenerctl %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	var storage storageFlags
+	var out string
+
+	fs := newOfflineFlagSet("export", &storage)
+	fs.StringVar(&out, "out", "-", "Output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keeper, err := storage.open(false)
+	if err != nil {
+		return err
+	}
+	defer closeKeeper(keeper)
+
+	w := a.stdout
+	if out != "-" {
+		file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	count := 0
+	err = keeper.Export(ctx, func(r url.Record) error {
+		count++
+		return enc.Encode(r)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+
+	if out != "-" {
+		return a.message(fmt.Sprintf("%d records exported to %s", count, out))
+	}
+
+	return nil
+}
+
+func runImport(ctx context.Context, a *app, args []string) error {
+	var storage storageFlags
+	var in string
+
+	fs := newOfflineFlagSet("import", &storage)
+	fs.StringVar(&in, "in", "-", "Input file, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keeper, err := storage.open(true)
+	if err != nil {
+		return err
+	}
+	defer closeKeeper(keeper)
+
+	count := 0
+	chunk := make([]url.Record, 0, importChunkSize)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := keeper.Import(ctx, chunk); err != nil {
+			return fmt.Errorf("import after %d records: %w", count, err)
+		}
+		count += len(chunk)
+		chunk = chunk[:0]
+		return nil
+	}
+
+	err = readRecords(a, in, func(r url.Record) error {
+		chunk = append(chunk, r)
+		if len(chunk) < importChunkSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = flush(); err != nil {
+		return err
+	}
+
+	return a.message(fmt.Sprintf("%d records imported", count))
+}
+
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	var from, to storageFlags
+	var opts migrate.Options
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.StringVar(&from.dsn, "from-d", "", "Source database DSN")
+	fs.StringVar(&from.file, "from-f", "", "Source file storage path")
+	fs.StringVar(&to.dsn, "to-d", "", "Destination database DSN")
+	fs.StringVar(&to.file, "to-f", "", "Destination file storage path")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Read source and check destination without saving")
+	fs.BoolVar(&opts.Verify, "verify", true, "Compare destination with source after saving")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shortenerctl %s\n", commands["migrate"].usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	src, err := from.open(false)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer closeKeeper(src)
+
+	dst, err := to.open(true)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer closeKeeper(dst)
+
+	report, err := migrate.Run(ctx, src, dst, opts)
+	if err != nil {
+		return err
+	}
+
+	return a.print(report, []string{"RECORDS", "DELETED", "USERS", "QUOTAS", "NEXT ID", "DRY RUN", "VERIFIED"}, [][]string{{
+		fmt.Sprint(report.Records),
+		fmt.Sprint(report.Deleted),
+		fmt.Sprint(report.Users),
+		fmt.Sprint(report.Quotas),
+		fmt.Sprint(report.NextID),
+		fmt.Sprint(report.DryRun),
+		fmt.Sprint(report.Verified),
+	}})
+}
+
+func runVerify(ctx context.Context, a *app, args []string) error {
+	var storage storageFlags
+	var in string
+
+	fs := newOfflineFlagSet("verify", &storage)
+	fs.StringVar(&in, "in", "-", "Input file, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keeper, err := storage.open(false)
+	if err != nil {
+		return err
+	}
+	defer closeKeeper(keeper)
+
+	stored := make(map[int]url.Record)
+	err = keeper.Export(ctx, func(r url.Record) error {
+		stored[r.ID] = r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	type mismatch struct {
+		ID       int         `json:"id"`
+		Problem  string      `json:"problem"`
+		Expected url.Record  `json:"expected"`
+		Stored   *url.Record `json:"stored,omitempty"`
+	}
+
+	var mismatches []mismatch
+	count := 0
+
+	err = readRecords(a, in, func(r url.Record) error {
+		count++
+
+		s, ok := stored[r.ID]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, mismatch{ID: r.ID, Problem: "missing", Expected: r})
+		case s != r:
+			mismatches = append(mismatches, mismatch{ID: r.ID, Problem: "different", Expected: r, Stored: &s})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(mismatches) == 0 {
+		return a.message(fmt.Sprintf("%d records verified", count))
+	}
+
+	rows := make([][]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		rows = append(rows, []string{fmt.Sprint(m.ID), m.Problem, m.Expected.URL})
+	}
+	if err = a.print(mismatches, []string{"ID", "PROBLEM", "URL"}, rows); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d of %d records do not match", len(mismatches), count)
+}
+
+// readRecords calls fn for records from JSON lines.
+func readRecords(a *app, path string, fn func(url.Record) error) error {
+	var r io.Reader = a.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for line := 1; ; line++ {
+		var record url.Record
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
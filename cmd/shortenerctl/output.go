@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// print writes v as JSON or the rows as the table with header.
+func (a *app) print(v any, header []string, rows [][]string) error {
+	if a.output == outputJSON {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// message writes the command result message.
+func (a *app) message(msg string) error {
+	if a.output == outputJSON {
+		return json.NewEncoder(a.stdout).Encode(map[string]string{"message": msg})
+	}
+
+	_, err := fmt.Fprintln(a.stdout, msg)
+	return err
+}
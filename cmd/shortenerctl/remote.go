@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ruskiiamov/shortener/pkg/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func (a *app) client() (client.Client, error) {
+	transport, server, err := a.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := client.DefaultOptions()
+	opts.Tokens = a.config
+
+	if transport == transportHTTP {
+		return client.NewHTTP(server, nil, opts), nil
+	}
+
+	creds := insecure.NewCredentials()
+	if a.tls || a.config.TLS {
+		caFile := firstNonEmpty(a.caFile, a.config.CAFile)
+		if caFile != "" {
+			creds, err = credentials.NewClientTLSFromFile(caFile, "")
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+	}
+
+	return client.DialGRPC(server, opts, grpc.WithTransportCredentials(creds))
+}
+
+// withClient runs fn with the service client.
+func (a *app) withClient(fn func(c client.Client) error) error {
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return fn(c)
+}
+
+func parseNoFlags(name string, args []string) ([]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shortenerctl %s\n", commands[name].usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return fs.Args(), nil
+}
+
+func runShorten(ctx context.Context, a *app, args []string) error {
+	urls, err := parseNoFlags("shorten", args)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("%w: URL required", errUsage)
+	}
+
+	type result struct {
+		client.Link
+		Existed bool `json:"existed"`
+	}
+
+	return a.withClient(func(c client.Client) error {
+		results := make([]result, 0, len(urls))
+		for _, u := range urls {
+			link, err := c.Shorten(ctx, u)
+
+			var errDupl *client.DuplicateError
+			switch {
+			case errors.As(err, &errDupl):
+				results = append(results, result{Link: errDupl.Link, Existed: true})
+			case err != nil:
+				return err
+			default:
+				results = append(results, result{Link: *link})
+			}
+		}
+
+		rows := make([][]string, 0, len(results))
+		for _, r := range results {
+			rows = append(rows, []string{r.ID, r.ShortURL, r.URL, strconv.FormatBool(r.Existed)})
+		}
+
+		return a.print(results, []string{"ID", "SHORT URL", "URL", "EXISTED"}, rows)
+	})
+}
+
+func runBatch(ctx context.Context, a *app, args []string) error {
+	files, err := parseNoFlags("batch", args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("%w: one file required", errUsage)
+	}
+
+	items, err := readBatch(a, files[0])
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return errors.New("no URLs in the file")
+	}
+
+	return a.withClient(func(c client.Client) error {
+		results, err := c.ShortenBatch(ctx, items)
+		if err != nil {
+			return err
+		}
+
+		originals := make(map[string]string, len(items))
+		for _, item := range items {
+			originals[item.CorrelationID] = item.URL
+		}
+
+		rows := make([][]string, 0, len(results))
+		for _, r := range results {
+			rows = append(rows, []string{r.CorrelationID, r.ID, r.ShortURL, originals[r.CorrelationID]})
+		}
+
+		return a.print(results, []string{"LINE", "ID", "SHORT URL", "URL"}, rows)
+	})
+}
+
+// readBatch reads URLs, one per line. Line numbers are correlation IDs,
+// empty lines and lines starting with # are skipped.
+func readBatch(a *app, path string) ([]client.BatchItem, error) {
+	var r io.Reader = a.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var items []client.BatchItem
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		u := strings.TrimSpace(scanner.Text())
+		if u == "" || strings.HasPrefix(u, "#") {
+			continue
+		}
+		items = append(items, client.BatchItem{CorrelationID: strconv.Itoa(line), URL: u})
+	}
+
+	return items, scanner.Err()
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	if _, err := parseNoFlags("list", args); err != nil {
+		return err
+	}
+
+	return a.withClient(func(c client.Client) error {
+		links, err := c.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		if links == nil {
+			links = []client.Link{}
+		}
+
+		rows := make([][]string, 0, len(links))
+		for _, link := range links {
+			rows = append(rows, []string{link.ID, link.ShortURL, link.URL})
+		}
+
+		return a.print(links, []string{"ID", "SHORT URL", "URL"}, rows)
+	})
+}
+
+func runDelete(ctx context.Context, a *app, args []string) error {
+	ids, err := parseNoFlags("delete", args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: ID required", errUsage)
+	}
+
+	return a.withClient(func(c client.Client) error {
+		if err := c.Delete(ctx, ids); err != nil {
+			return err
+		}
+
+		return a.message(fmt.Sprintf("%d links scheduled for deletion", len(ids)))
+	})
+}
+
+func runResolve(ctx context.Context, a *app, args []string) error {
+	ids, err := parseNoFlags("resolve", args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("%w: one ID required", errUsage)
+	}
+
+	return a.withClient(func(c client.Client) error {
+		original, err := c.Resolve(ctx, ids[0])
+		if err != nil {
+			return err
+		}
+
+		link := client.Link{ID: ids[0], URL: original}
+
+		return a.print(link, []string{"ID", "URL"}, [][]string{{link.ID, link.URL}})
+	})
+}
+
+func runStats(ctx context.Context, a *app, args []string) error {
+	if _, err := parseNoFlags("stats", args); err != nil {
+		return err
+	}
+
+	return a.withClient(func(c client.Client) error {
+		stats, err := c.Stats(ctx)
+		if err != nil {
+			return err
+		}
+
+		return a.print(stats, []string{"URLS", "USERS"}, [][]string{{strconv.Itoa(stats.URLs), strconv.Itoa(stats.Users)}})
+	})
+}
+
+func runPing(ctx context.Context, a *app, args []string) error {
+	if _, err := parseNoFlags("ping", args); err != nil {
+		return err
+	}
+
+	return a.withClient(func(c client.Client) error {
+		if err := c.Ping(ctx); err != nil {
+			return err
+		}
+
+		return a.message("ok")
+	})
+}
+
+// runConfig saves the global flags to the config file.
+func runConfig(ctx context.Context, a *app, args []string) error {
+	if _, err := parseNoFlags("config", args); err != nil {
+		return err
+	}
+
+	if a.transport != "" {
+		a.config.Transport = a.transport
+	}
+	if a.server != "" {
+		a.config.Server = a.server
+	}
+	if a.tls {
+		a.config.TLS = true
+	}
+	if a.caFile != "" {
+		a.config.CAFile = a.caFile
+	}
+
+	if _, _, err := a.resolve(); err != nil {
+		return err
+	}
+
+	if err := a.config.save(); err != nil {
+		return err
+	}
+
+	return a.message("config saved to " + a.configPath)
+}
@@ -0,0 +1,188 @@
+// Package access restricts the internal API to trusted subnets. The same
+// checker guards HTTP routes and gRPC methods.
+package access
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ruskiiamov/shortener/internal/problem"
+)
+
+// Client address headers set by trusted proxies.
+const (
+	RealIPHeader       = "X-Real-IP"
+	ForwardedForHeader = "X-Forwarded-For"
+)
+
+// Checker allows requests from clients in the trusted subnets. Client address
+// headers are taken into account only for requests from trusted proxies.
+type Checker struct {
+	lists atomic.Pointer[lists]
+}
+
+type lists struct {
+	subnets []*net.IPNet
+	proxies []*net.IPNet
+}
+
+// NewChecker returns checker for comma-separated lists of trusted subnets
+// and trusted proxy subnets in CIDR notation. A bare IP address is a single
+// host subnet. All requests are denied if no subnet is set.
+func NewChecker(subnets, proxies string) (*Checker, error) {
+	c := new(Checker)
+	if err := c.Update(subnets, proxies); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Update replaces the trusted subnets and proxies for the next requests.
+// The lists are kept if any of them is not valid.
+func (c *Checker) Update(subnets, proxies string) error {
+	s, err := ParseCIDRs(subnets)
+	if err != nil {
+		return err
+	}
+
+	p, err := ParseCIDRs(proxies)
+	if err != nil {
+		return err
+	}
+
+	c.lists.Store(&lists{subnets: s, proxies: p})
+
+	return nil
+}
+
+// ParseCIDRs parses comma-separated list of IPv4 and IPv6 subnets.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "CIDR address", Text: s}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			subnets = append(subnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
+
+// ClientIP returns the client address of the request from the peer address.
+// Address headers are read with header only if the peer is a trusted proxy:
+// X-Forwarded-For is walked from the right skipping trusted proxies, then
+// X-Real-IP is used. A nil checker trusts no proxies. It returns nil if the
+// address is unknown.
+func (c *Checker) ClientIP(peer string, header func(key string) []string) net.IP {
+	if c == nil {
+		return parseIP(peer)
+	}
+
+	return c.lists.Load().clientIP(peer, header)
+}
+
+func (l *lists) clientIP(peer string, header func(key string) []string) net.IP {
+	ip := parseIP(peer)
+	if ip == nil || !contains(l.proxies, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, value := range header(ForwardedForHeader) {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := parseIP(forwarded[i])
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(l.proxies, hop) {
+			return hop
+		}
+	}
+
+	if len(forwarded) > 0 {
+		return ip
+	}
+
+	if values := header(RealIPHeader); len(values) > 0 {
+		if realIP := parseIP(values[0]); realIP != nil {
+			return realIP
+		}
+	}
+
+	return ip
+}
+
+// Check returns Forbidden problem error if the client is not trusted.
+func (c *Checker) Check(peer string, header func(key string) []string) error {
+	if c == nil {
+		return problem.Errorf(problem.Forbidden, "trusted subnet not set")
+	}
+
+	l := c.lists.Load()
+	if len(l.subnets) == 0 {
+		return problem.Errorf(problem.Forbidden, "trusted subnet not set")
+	}
+
+	ip := l.clientIP(peer, header)
+	if ip == nil {
+		return problem.Errorf(problem.Forbidden, "client IP unknown")
+	}
+
+	if !contains(l.subnets, ip) {
+		return problem.Errorf(problem.Forbidden, "trusted subnet does not contain IP %s", ip)
+	}
+
+	return nil
+}
+
+func contains(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIP parses IP address with optional port and IPv6 zone.
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
@@ -0,0 +1,106 @@
+package access
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	subnets, err := ParseCIDRs(" 192.168.0.0/16, fd00::/8,10.0.0.1 ,, ::1")
+	require.NoError(t, err)
+	require.Len(t, subnets, 4)
+	assert.Equal(t, "10.0.0.1/32", subnets[2].String())
+	assert.Equal(t, "::1/128", subnets[3].String())
+
+	_, err = ParseCIDRs("192.168.0.0/33")
+	assert.Error(t, err)
+
+	_, err = ParseCIDRs("localhost")
+	assert.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	c, err := NewChecker("192.168.0.0/16, fd00::/8", "127.0.0.1, 10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		peer    string
+		header  map[string]string
+		wantErr bool
+	}{
+		{name: "peer in subnet", peer: "192.168.1.5:4000"},
+		{name: "ipv6 peer in subnet", peer: "[fd00::5%eth0]:4000"},
+		{name: "peer not in subnet", peer: "172.16.0.1:4000", wantErr: true},
+		{
+			name:    "header from untrusted peer",
+			peer:    "172.16.0.1:4000",
+			header:  map[string]string{RealIPHeader: "192.168.1.5"},
+			wantErr: true,
+		},
+		{name: "real ip from proxy", peer: "127.0.0.1:4000", header: map[string]string{RealIPHeader: "192.168.1.5"}},
+		{
+			name:    "real ip not in subnet",
+			peer:    "127.0.0.1:4000",
+			header:  map[string]string{RealIPHeader: "172.16.0.1"},
+			wantErr: true,
+		},
+		{
+			name:   "forwarded through proxies",
+			peer:   "127.0.0.1:4000",
+			header: map[string]string{ForwardedForHeader: "172.16.0.1, 192.168.1.5, 10.1.1.1"},
+		},
+		{
+			name:    "forwarded spoofed",
+			peer:    "127.0.0.1:4000",
+			header:  map[string]string{ForwardedForHeader: "192.168.1.5, 172.16.0.1"},
+			wantErr: true,
+		},
+		{name: "proxy without headers", peer: "127.0.0.1:4000", wantErr: true},
+		{name: "unknown peer", peer: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+
+			err := c.Check(tt.peer, header.Values)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			assert.Equal(t, problem.Forbidden, problem.Classify(err))
+		})
+	}
+}
+
+func TestCheckNotSet(t *testing.T) {
+	c, err := NewChecker("", "")
+	require.NoError(t, err)
+	assert.Error(t, c.Check("192.168.1.5:4000", http.Header{}.Values))
+
+	var nilChecker *Checker
+	assert.Error(t, nilChecker.Check("192.168.1.5:4000", http.Header{}.Values))
+}
+
+func TestUpdate(t *testing.T) {
+	c, err := NewChecker("192.168.1.0/24", "")
+	require.NoError(t, err)
+	assert.NoError(t, c.Check("192.168.1.5:4000", http.Header{}.Values))
+
+	require.NoError(t, c.Update("10.0.0.0/8", ""))
+	assert.Error(t, c.Check("192.168.1.5:4000", http.Header{}.Values))
+	assert.NoError(t, c.Check("10.1.2.3:4000", http.Header{}.Values))
+
+	assert.Error(t, c.Update("10.0.0.0/33", ""))
+	assert.NoError(t, c.Check("10.1.2.3:4000", http.Header{}.Values))
+}
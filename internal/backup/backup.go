@@ -0,0 +1,339 @@
+// Package backup writes and restores data storage archives. The archive is
+// zstd-compressed JSON lines: the header, the records, the quotas and the
+// trailer with counts and SHA-256 checksum of all previous lines.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/compress"
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// Version is the archive format version.
+const Version = 1
+
+// ContentType is the media type of the archive.
+const ContentType = "application/vnd.shortener.backup+zstd"
+
+// Line types.
+const (
+	typeHeader  = "header"
+	typeRecord  = "record"
+	typeQuota   = "quota"
+	typeTrailer = "trailer"
+)
+
+// restoreChunkSize is the number of records saved in one Import call.
+const restoreChunkSize = 1000
+
+var (
+	// ErrCorrupted is returned for archives with wrong structure or checksum.
+	ErrCorrupted = errors.New("backup archive corrupted")
+
+	// ErrVersion is returned for archives of unknown format version.
+	ErrVersion = errors.New("backup archive version not supported")
+
+	// ErrNotEmpty is returned for restore to data storage with URLs.
+	ErrNotEmpty = errors.New("data storage is not empty")
+)
+
+// Snapshotter writes consistent copy of data storage. It is implemented by
+// url.DataKeeper and url.Converter.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, w url.SnapshotWriter) error
+}
+
+// Manifest describes the archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	NextID  int       `json:"next_id"`
+	Records int       `json:"records"`
+	Deleted int       `json:"deleted"`
+	Users   int       `json:"users"`
+	Quotas  int       `json:"quotas"`
+	SHA256  string    `json:"sha256"`
+}
+
+type line struct {
+	Type string `json:"type"`
+
+	// Header.
+	Version int        `json:"version,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+	NextID  int        `json:"next_id,omitempty"`
+
+	Record *url.Record `json:"record,omitempty"`
+
+	UserID string     `json:"user_id,omitempty"`
+	Quota  *url.Quota `json:"quota,omitempty"`
+
+	// Trailer.
+	Records int    `json:"records,omitempty"`
+	Quotas  int    `json:"quotas,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// Write writes the archive of the data storage snapshot to w.
+func Write(ctx context.Context, s Snapshotter, w io.Writer) (*Manifest, error) {
+	enc, err := compress.GetEncoder(compress.Zstd, w)
+	if err != nil {
+		return nil, err
+	}
+	defer compress.PutEncoder(compress.Zstd, enc)
+
+	aw := &archiveWriter{
+		manifest: Manifest{Version: Version, Created: time.Now().UTC()},
+		buf:      bufio.NewWriter(enc),
+		hash:     sha256.New(),
+		users:    make(map[string]struct{}),
+	}
+
+	if err = s.Snapshot(ctx, aw); err != nil {
+		return nil, err
+	}
+
+	if !aw.headerWritten {
+		return nil, errors.New("snapshot without next id")
+	}
+
+	aw.manifest.Users = len(aw.users)
+	aw.manifest.SHA256 = hex.EncodeToString(aw.hash.Sum(nil))
+
+	err = aw.write(line{
+		Type:    typeTrailer,
+		Records: aw.manifest.Records,
+		Quotas:  aw.manifest.Quotas,
+		SHA256:  aw.manifest.SHA256,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = aw.buf.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return &aw.manifest, nil
+}
+
+type archiveWriter struct {
+	manifest      Manifest
+	buf           *bufio.Writer
+	hash          hash.Hash
+	users         map[string]struct{}
+	headerWritten bool
+}
+
+// WriteNextID implements url.SnapshotWriter interface.
+func (a *archiveWriter) WriteNextID(id int) error {
+	a.manifest.NextID = id
+	a.headerWritten = true
+
+	return a.write(line{Type: typeHeader, Version: Version, Created: &a.manifest.Created, NextID: id})
+}
+
+// WriteRecord implements url.SnapshotWriter interface.
+func (a *archiveWriter) WriteRecord(r url.Record) error {
+	a.manifest.Records++
+	if r.Deleted {
+		a.manifest.Deleted++
+	}
+	a.users[r.UserID] = struct{}{}
+
+	return a.write(line{Type: typeRecord, Record: &r})
+}
+
+// WriteQuota implements url.SnapshotWriter interface.
+func (a *archiveWriter) WriteQuota(userID string, q url.Quota) error {
+	a.manifest.Quotas++
+
+	return a.write(line{Type: typeQuota, UserID: userID, Quota: &q})
+}
+
+func (a *archiveWriter) write(l line) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if l.Type != typeTrailer {
+		a.hash.Write(data)
+	}
+
+	_, err = a.buf.Write(data)
+	return err
+}
+
+// Verify reads the whole archive and checks its structure and checksum.
+func Verify(r io.Reader) (*Manifest, error) {
+	return read(r, func(line) error { return nil })
+}
+
+// read calls fn for all lines of the archive except the trailer. The
+// checksum is checked after the last line.
+func read(r io.Reader, fn func(line) error) (*Manifest, error) {
+	dec, err := compress.GetDecoder(compress.Zstd, r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	defer compress.PutDecoder(compress.Zstd, dec)
+
+	scanner := bufio.NewScanner(dec)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	h := sha256.New()
+	m := &Manifest{}
+	users := make(map[string]struct{})
+	headerRead := false
+
+	for scanner.Scan() {
+		data := scanner.Bytes()
+
+		var l line
+		if err = json.Unmarshal(data, &l); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+		}
+
+		if !headerRead {
+			if l.Type != typeHeader || l.Created == nil {
+				return nil, fmt.Errorf("%w: no header", ErrCorrupted)
+			}
+			if l.Version != Version {
+				return nil, fmt.Errorf("%w: %d", ErrVersion, l.Version)
+			}
+			m.Version, m.Created, m.NextID = l.Version, *l.Created, l.NextID
+			headerRead = true
+		}
+
+		switch {
+		case l.Type == typeTrailer:
+			m.SHA256 = hex.EncodeToString(h.Sum(nil))
+			if l.SHA256 != m.SHA256 || l.Records != m.Records || l.Quotas != m.Quotas {
+				return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+			}
+			if scanner.Scan() {
+				return nil, fmt.Errorf("%w: data after trailer", ErrCorrupted)
+			}
+			m.Users = len(users)
+			return m, nil
+		case l.Type == typeRecord && l.Record != nil:
+			m.Records++
+			if l.Record.Deleted {
+				m.Deleted++
+			}
+			users[l.Record.UserID] = struct{}{}
+		case l.Type == typeQuota && l.Quota != nil && l.UserID != "":
+			m.Quotas++
+		case l.Type != typeHeader:
+			return nil, fmt.Errorf("%w: unknown line type %q", ErrCorrupted, l.Type)
+		}
+
+		h.Write(data)
+		h.Write([]byte{'\n'})
+
+		if err = fn(l); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+
+	return nil, fmt.Errorf("%w: no trailer", ErrCorrupted)
+}
+
+// Keeper is the data storage to restore.
+type Keeper interface {
+	Export(ctx context.Context, fn func(url.Record) error) error
+	Import(ctx context.Context, records []url.Record) error
+	SetQuota(ctx context.Context, userID string, q url.Quota) error
+	SetNextID(ctx context.Context, id int) error
+	Clear(ctx context.Context) error
+}
+
+// Restore saves the archive to data storage. The archive is verified before
+// any change, so r is read twice. Data storage with URLs is cleared if force
+// is set, otherwise ErrNotEmpty is returned.
+func Restore(ctx context.Context, k Keeper, r io.ReadSeeker, force bool) (*Manifest, error) {
+	if _, err := Verify(r); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	empty := true
+	errStop := errors.New("stop")
+	err := k.Export(ctx, func(url.Record) error {
+		empty = false
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+
+	if !empty && !force {
+		return nil, ErrNotEmpty
+	}
+
+	if err = k.Clear(ctx); err != nil {
+		return nil, err
+	}
+
+	chunk := make([]url.Record, 0, restoreChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		err := k.Import(ctx, chunk)
+		chunk = chunk[:0]
+		return err
+	}
+
+	m, err := read(r, func(l line) error {
+		switch l.Type {
+		case typeRecord:
+			chunk = append(chunk, *l.Record)
+			if len(chunk) == restoreChunkSize {
+				return flush()
+			}
+		case typeQuota:
+			if err := flush(); err != nil {
+				return err
+			}
+			return k.SetQuota(ctx, l.UserID, *l.Quota)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = flush(); err != nil {
+		return nil, err
+	}
+
+	if err = k.SetNextID(ctx, m.NextID); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
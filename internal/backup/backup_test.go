@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/compress"
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keepers returns the data storages to test. Postgres is tested if
+// TEST_DATABASE_DSN is set, its tables are cleared.
+func keepers(t *testing.T) map[string]func(t *testing.T) url.DataKeeper {
+	t.Helper()
+
+	k := map[string]func(t *testing.T) url.DataKeeper{
+		"memory": func(t *testing.T) url.DataKeeper {
+			keeper, err := data.NewKeeper("", "", nil)
+			require.NoError(t, err)
+			return keeper
+		},
+	}
+
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		k["postgres"] = func(t *testing.T) url.DataKeeper {
+			keeper, err := data.NewKeeper(dsn, "", nil)
+			require.NoError(t, err)
+			require.NoError(t, keeper.Clear(context.Background()))
+			t.Cleanup(func() { keeper.Close(context.Background()) })
+			return keeper
+		}
+	}
+
+	return k
+}
+
+func fill(t *testing.T, k url.DataKeeper) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	_, _, err := k.AddBatch(ctx, "user1", "", []string{"http://example.com/a", "http://example.com/b"})
+	require.NoError(t, err)
+	_, err = k.Add(ctx, "user2", "", "http://example.com/c", url.Redirect{})
+	require.NoError(t, err)
+	_, err = k.DeleteBatch(ctx, map[string][]int{"user1": {2}})
+	require.NoError(t, err)
+	require.NoError(t, k.SetQuota(ctx, "user2", url.Quota{MaxLinks: 5}))
+	require.NoError(t, k.SetNextID(ctx, 10))
+}
+
+type snapshot struct {
+	nextID  int
+	records []url.Record
+	quotas  map[string]url.Quota
+}
+
+func (s *snapshot) WriteNextID(id int) error {
+	s.nextID = id
+	return nil
+}
+
+func (s *snapshot) WriteRecord(r url.Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *snapshot) WriteQuota(userID string, q url.Quota) error {
+	if s.quotas == nil {
+		s.quotas = make(map[string]url.Quota)
+	}
+	s.quotas[userID] = q
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, newKeeper := range keepers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			src := newKeeper(t)
+			fill(t, src)
+
+			var buf bytes.Buffer
+			m, err := Write(ctx, src, &buf)
+			require.NoError(t, err)
+			assert.Equal(t, Version, m.Version)
+			assert.Equal(t, 3, m.Records)
+			assert.Equal(t, 1, m.Deleted)
+			assert.Equal(t, 2, m.Users)
+			assert.Equal(t, 1, m.Quotas)
+			assert.Equal(t, 10, m.NextID)
+
+			verified, err := Verify(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, m.SHA256, verified.SHA256)
+
+			want := new(snapshot)
+			require.NoError(t, src.Snapshot(ctx, want))
+
+			// Restore to the same storage.
+			_, err = Restore(ctx, src, bytes.NewReader(buf.Bytes()), false)
+			assert.ErrorIs(t, err, ErrNotEmpty)
+
+			_, err = src.Add(ctx, "user3", "", "http://example.com/d", url.Redirect{})
+			require.NoError(t, err)
+
+			restored, err := Restore(ctx, src, bytes.NewReader(buf.Bytes()), true)
+			require.NoError(t, err)
+			assert.Equal(t, m.SHA256, restored.SHA256)
+
+			got := new(snapshot)
+			require.NoError(t, src.Snapshot(ctx, got))
+			assert.Equal(t, want, got)
+
+			rec, err := src.Get(ctx, 2)
+			require.NoError(t, err)
+			assert.True(t, rec.Deleted)
+
+			id, err := src.Add(ctx, "user3", "", "http://example.com/d", url.Redirect{})
+			require.NoError(t, err)
+			assert.Equal(t, 10, id)
+		})
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	ctx := context.Background()
+
+	keeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+	fill(t, keeper)
+
+	var buf bytes.Buffer
+	_, err = Write(ctx, keeper, &buf)
+	require.NoError(t, err)
+
+	_, err = Verify(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	// Change a record and compress the archive again.
+	dec, err := compress.GetDecoder(compress.Zstd, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	var plain bytes.Buffer
+	_, err = plain.ReadFrom(dec)
+	require.NoError(t, err)
+
+	tampered := bytes.Replace(plain.Bytes(), []byte("example.com/a"), []byte("example.com/x"), 1)
+
+	var archive bytes.Buffer
+	enc, err := compress.GetEncoder(compress.Zstd, &archive)
+	require.NoError(t, err)
+	_, err = enc.Write(tampered)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	_, err = Verify(bytes.NewReader(archive.Bytes()))
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	empty, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+	_, err = Restore(ctx, empty, bytes.NewReader(archive.Bytes()), false)
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	got := new(snapshot)
+	require.NoError(t, empty.Snapshot(ctx, got))
+	assert.Empty(t, got.records)
+}
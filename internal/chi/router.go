@@ -16,7 +16,7 @@ type router struct {
 func NewRouter() *router {
 	chiMux := chi.NewMux()
 
-	chiMux.Use(middleware.Logger, middleware.Recoverer)
+	chiMux.Use(middleware.Recoverer)
 
 	return &router{mux: chiMux}
 }
@@ -31,11 +31,21 @@ func (rtr *router) GET(pattern string, handler http.Handler) {
 	rtr.mux.Get(pattern, handler.ServeHTTP)
 }
 
+// HEAD registers hanlders for HEAD HTTP method.
+func (rtr *router) HEAD(pattern string, handler http.Handler) {
+	rtr.mux.Head(pattern, handler.ServeHTTP)
+}
+
 // POST registers hanlders for POST HTTP method.
 func (rtr *router) POST(pattern string, handler http.Handler) {
 	rtr.mux.Post(pattern, handler.ServeHTTP)
 }
 
+// PATCH registers hanlders for PATCH HTTP method.
+func (rtr *router) PATCH(pattern string, handler http.Handler) {
+	rtr.mux.Patch(pattern, handler.ServeHTTP)
+}
+
 // DELETE registers hanlders for DELETE HTTP method.
 func (rtr *router) DELETE(pattern string, handler http.Handler) {
 	rtr.mux.Delete(pattern, handler.ServeHTTP)
@@ -50,3 +60,14 @@ func (rtr *router) GetURLParam(r *http.Request, key string) string {
 func (rtr *router) AddMiddlewares(middlewares ...func(http.Handler) http.Handler) {
 	rtr.mux.Use(middlewares...)
 }
+
+// RoutePattern returns the pattern of the matched route, it is empty before
+// routing and for not found routes.
+func (rtr *router) RoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+
+	return rctx.RoutePattern()
+}
@@ -0,0 +1,145 @@
+// Package compress provides pooled encoders and decoders for HTTP content
+// codings and Accept-Encoding negotiation.
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings.
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+	Zstd     = "zstd"
+	Identity = "identity"
+)
+
+const brotliLevel = 4
+
+// ErrUnsupported is returned for unknown content coding.
+var ErrUnsupported = errors.New("unsupported content encoding")
+
+// Encoder compresses data written to it. Close flushes data but does not
+// close the underlying writer.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Decoder decompresses data read from the underlying reader.
+type Decoder interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+type codec struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+// preferred is the server preference order used when client weights are equal.
+var preferred = []string{Zstd, Brotli, Gzip, Deflate}
+
+var codecs = map[string]*codec{
+	Gzip: {
+		encoders: sync.Pool{New: func() any {
+			w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+			return w
+		}},
+		decoders: sync.Pool{New: func() any { return new(gzip.Reader) }},
+	},
+	Deflate: {
+		encoders: sync.Pool{New: func() any {
+			w, _ := flate.NewWriter(nil, flate.BestSpeed)
+			return w
+		}},
+		decoders: sync.Pool{New: func() any { return &flateReader{ReadCloser: flate.NewReader(nil)} }},
+	},
+	Brotli: {
+		encoders: sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+		decoders: sync.Pool{New: func() any { return brotli.NewReader(nil) }},
+	},
+	Zstd: {
+		encoders: sync.Pool{New: func() any {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+		decoders: sync.Pool{New: func() any {
+			r, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			return r
+		}},
+	},
+}
+
+type flateReader struct {
+	io.ReadCloser
+}
+
+// Reset implements Decoder interface.
+func (f *flateReader) Reset(r io.Reader) error {
+	return f.ReadCloser.(flate.Resetter).Reset(r, nil)
+}
+
+// Supported returns supported content codings in server preference order.
+func Supported() []string {
+	return append([]string(nil), preferred...)
+}
+
+// IsSupported reports whether the content coding is supported.
+func IsSupported(encoding string) bool {
+	_, ok := codecs[encoding]
+	return ok
+}
+
+// GetEncoder returns pooled encoder that writes to w.
+func GetEncoder(encoding string, w io.Writer) (Encoder, error) {
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	e := c.encoders.Get().(Encoder)
+	e.Reset(w)
+
+	return e, nil
+}
+
+// PutEncoder returns closed encoder to the pool.
+func PutEncoder(encoding string, e Encoder) {
+	if c, ok := codecs[encoding]; ok {
+		e.Reset(nil)
+		c.encoders.Put(e)
+	}
+}
+
+// GetDecoder returns pooled decoder that reads from r.
+func GetDecoder(encoding string, r io.Reader) (Decoder, error) {
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	d := c.decoders.Get().(Decoder)
+	if err := d.Reset(r); err != nil {
+		c.decoders.Put(d)
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// PutDecoder returns decoder to the pool.
+func PutDecoder(encoding string, d Decoder) {
+	if c, ok := codecs[encoding]; ok {
+		c.decoders.Put(d)
+	}
+}
@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "empty", header: "", want: Identity},
+		{name: "gzip only", header: "gzip", want: Gzip},
+		{name: "server preference", header: "gzip, deflate, br, zstd", want: Zstd},
+		{name: "q-values", header: "gzip;q=1.0, br;q=0.8, zstd;q=0.5", want: Gzip},
+		{name: "excluded", header: "br;q=0, deflate", want: Deflate},
+		{name: "wildcard", header: "*;q=0.5, zstd;q=0", want: Brotli},
+		{name: "unknown", header: "compress, sdch", want: Identity},
+		{name: "invalid q", header: "gzip;q=2, deflate", want: Deflate},
+		{name: "case and spaces", header: " GZIP ; Q=0.9 ", want: Gzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.header))
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := strings.Repeat("http://shortener.com/", 100)
+
+	for _, encoding := range Supported() {
+		t.Run(encoding, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+
+				e, err := GetEncoder(encoding, &buf)
+				require.NoError(t, err)
+				_, err = io.WriteString(e, data)
+				require.NoError(t, err)
+				require.NoError(t, e.Close())
+				PutEncoder(encoding, e)
+
+				assert.Less(t, buf.Len(), len(data))
+
+				d, err := GetDecoder(encoding, &buf)
+				require.NoError(t, err)
+				decoded, err := io.ReadAll(d)
+				require.NoError(t, err)
+				PutDecoder(encoding, d)
+
+				assert.Equal(t, data, string(decoded))
+			}
+		})
+	}
+
+	_, err := GetEncoder("compress", io.Discard)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
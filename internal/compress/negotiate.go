@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Negotiate returns the best supported content coding for the Accept-Encoding
+// header value. Codings with higher q-value win, equal q-values are resolved
+// by server preference. It returns Identity if no coding is acceptable.
+func Negotiate(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q, ok := parseCoding(part)
+		if !ok {
+			continue
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := Identity, 0.0
+
+	for _, name := range preferred {
+		q, ok := weights[name]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+
+	return best
+}
+
+func parseCoding(s string) (string, float64, bool) {
+	name, params, _ := strings.Cut(s, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", 0, false
+	}
+
+	q := 1.0
+
+	for _, param := range strings.Split(params, ";") {
+		key, value, found := strings.Cut(param, "=")
+		if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 || v > 1 {
+			return "", 0, false
+		}
+		q = v
+	}
+
+	return name, q, true
+}
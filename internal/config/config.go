@@ -1,91 +1,697 @@
 // Package config is the configuration provider for the whole application.
+//
+// Every layer overrides the previous one: defaults, the configuration file,
+// the environment variables and the command line flags. The file is JSON,
+// YAML or TOML chosen by its extension, durations are strings such as
+// "10s". Secrets are also read from the file named by the variable with
+// the _FILE suffix, e.g. AUTH_SIGN_KEY_FILE.
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
+	"net"
+	neturl "net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/caarlos0/env/v6"
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/tracing"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
 )
 
-// Config for env parsing.
+// Config is the service configuration. The field tags are the variable
+// names, the defaults and the file keys. The fields tagged with reload are
+// applied by Reloader without restart.
 type Config struct {
-	ServerAddress   string `env:"SERVER_ADDRESS" envDefault:"localhost:8080" json:"server_address"`
-	BaseURL         string `env:"BASE_URL" envDefault:"http://localhost:8080" json:"base_url"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"file_storage_path"`
-	AuthSignKey     string `env:"AUTH_SIGN_KEY" envDefault:"secret_key" json:"auth_sign_key"`
-	DatabaseDSN     string `env:"DATABASE_DSN" json:"database_dsn"`
-	EnableHTTPS     bool   `env:"ENABLE_HTTPS" json:"enable_https"`
-	Config          string `env:"CONFIG"`
-	TrustedSubnet   string `env:"TRUSTED_SUBNET"`
+	ServerAddress   string `env:"SERVER_ADDRESS" envDefault:"localhost:8080" yaml:"server_address"`
+	BaseURL         string `env:"BASE_URL" envDefault:"http://localhost:8080" yaml:"base_url"`
+	FileStoragePath string `env:"FILE_STORAGE_PATH" yaml:"file_storage_path"`
+	AuthSignKey     string `env:"AUTH_SIGN_KEY" envDefault:"secret_key" yaml:"auth_sign_key" secret:"true"`
+	DatabaseDSN     string `env:"DATABASE_DSN" yaml:"database_dsn" secret:"true"`
+	EnableHTTPS     bool   `env:"ENABLE_HTTPS" yaml:"enable_https"`
+	TrustedSubnet   string `env:"TRUSTED_SUBNET" yaml:"trusted_subnet" reload:"true"`
+
+	// TrustedProxies are the proxies whose X-Real-IP and X-Forwarded-For
+	// headers and metadata are trusted. Both TrustedSubnet and TrustedProxies
+	// are comma-separated lists of IPv4 and IPv6 subnets.
+	TrustedProxies string `env:"TRUSTED_PROXIES" yaml:"trusted_proxies" reload:"true"`
+
+	// Rate limits in "rate:burst" format, e.g. "5:20". Empty means no limit.
+	RateLimitShorten  string `env:"RATE_LIMIT_SHORTEN" yaml:"rate_limit_shorten" reload:"true"`
+	RateLimitBatch    string `env:"RATE_LIMIT_BATCH" yaml:"rate_limit_batch" reload:"true"`
+	RateLimitRedirect string `env:"RATE_LIMIT_REDIRECT" yaml:"rate_limit_redirect" reload:"true"`
+	RateLimitDelete   string `env:"RATE_LIMIT_DELETE" yaml:"rate_limit_delete" reload:"true"`
+
+	// Default user quotas. Zero means no limit.
+	MaxLinksPerUser int `env:"MAX_LINKS_PER_USER" yaml:"max_links_per_user"`
+	MaxBatchSize    int `env:"MAX_BATCH_SIZE" yaml:"max_batch_size"`
+	MaxDeleteIDs    int `env:"MAX_DELETE_IDS" yaml:"max_delete_ids"`
+
+	// AuditLogPath is the JSON lines audit file used without database.
+	AuditLogPath string `env:"AUDIT_LOG_PATH" yaml:"audit_log_path"`
+
+	// OutboxFilePath is the NDJSON file the link events are relayed to.
+	OutboxFilePath string `env:"OUTBOX_FILE_PATH" yaml:"outbox_file_path"`
+
+	// WebhookAllowedSubnets are the internal subnets (comma-separated CIDRs)
+	// webhook endpoints may be in. Not public addresses are rejected by
+	// default.
+	WebhookAllowedSubnets string `env:"WEBHOOK_ALLOWED_SUBNETS" yaml:"webhook_allowed_subnets"`
+
+	// HTTPS certificate with EnableHTTPS: static cert and key files
+	// reloaded when they change, or autocert for the allowed hosts
+	// (comma-separated). The ACME directory is Let's Encrypt by default.
+	TLSCertFile          string `env:"TLS_CERT_FILE" yaml:"tls_cert_file"`
+	TLSKeyFile           string `env:"TLS_KEY_FILE" yaml:"tls_key_file"`
+	AutocertHosts        string `env:"AUTOCERT_HOSTS" yaml:"autocert_hosts"`
+	AutocertCacheDir     string `env:"AUTOCERT_CACHE_DIR" yaml:"autocert_cache_dir"`
+	AutocertDirectoryURL string `env:"AUTOCERT_DIRECTORY_URL" yaml:"autocert_directory_url"`
+	AutocertEmail        string `env:"AUTOCERT_EMAIL" yaml:"autocert_email"`
+
+	// HTTPRedirectAddress is the plain HTTP listener redirecting to HTTPS
+	// and serving ACME challenges. Empty means no listener.
+	HTTPRedirectAddress string `env:"HTTP_REDIRECT_ADDRESS" yaml:"http_redirect_address"`
+
+	// gRPC listener. TLS is enabled with both cert and key files set, client
+	// certificates are required with the client CA file set.
+	GRPCAddress      string `env:"GRPC_ADDRESS" envDefault:"127.0.0.1:3200" yaml:"grpc_address"`
+	GRPCCertFile     string `env:"GRPC_CERT_FILE" yaml:"grpc_cert_file"`
+	GRPCKeyFile      string `env:"GRPC_KEY_FILE" yaml:"grpc_key_file"`
+	GRPCClientCAFile string `env:"GRPC_CLIENT_CA_FILE" yaml:"grpc_client_ca_file"`
+	GRPCReflection   bool   `env:"GRPC_REFLECTION" yaml:"grpc_reflection"`
+
+	// AdminAddress is the listener of /metrics and /debug/pprof/.
+	AdminAddress string `env:"ADMIN_ADDRESS" envDefault:"127.0.0.1:9090" yaml:"admin_address"`
+
+	// Trace export: none, stdout or otlp. The OTLP collector is set with
+	// TraceEndpoint or with the standard OTEL_EXPORTER_OTLP_* variables.
+	TraceExporter    string  `env:"TRACE_EXPORTER" envDefault:"none" yaml:"trace_exporter"`
+	TraceEndpoint    string  `env:"TRACE_ENDPOINT" yaml:"trace_endpoint"`
+	TraceInsecure    bool    `env:"TRACE_INSECURE" yaml:"trace_insecure"`
+	TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO" envDefault:"1" yaml:"trace_sample_ratio"`
+
+	// LogLevel is the lowest logged level: debug, info, warn or error.
+	LogLevel string `env:"LOG_LEVEL" envDefault:"info" yaml:"log_level" reload:"true"`
+
+	// ShutdownTimeout is the budget of the whole graceful shutdown.
+	// ShutdownDelay is the part of it the listeners keep serving after the
+	// readiness probes fail, so that load balancers notice it.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"10s" yaml:"shutdown_timeout"`
+	ShutdownDelay   time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay"`
+
+	// Redirect status and the HTML page for unknown links of the default
+	// domain. Zero code means 307, empty page means the problem response.
+	RedirectCode int    `env:"REDIRECT_CODE" yaml:"redirect_code"`
+	NotFoundPage string `env:"NOT_FOUND_PAGE" yaml:"not_found_page"`
+
+	// Domains are the short link domains besides the default one of
+	// BaseURL. They are set in the configuration file only.
+	Domains []Domain `yaml:"domains"`
+
+	// Config is the configuration file path, it is set with the flag or
+	// the environment only.
+	Config string `env:"CONFIG" yaml:"-"`
+
+	// PrintConfig prints the effective configuration instead of running.
+	PrintConfig bool `yaml:"-"`
+}
+
+// Domain is the short link domain. The links of the domain are resolved on
+// requests to its host only.
+type Domain struct {
+	Host    string `yaml:"host"`
+	BaseURL string `yaml:"base_url"`
+
+	// RedirectCode is 301, 302, 307 or 308, zero means 307.
+	RedirectCode int `yaml:"redirect_code"`
+
+	// AllowedUsers are the only users creating links on the domain, empty
+	// means all users.
+	AllowedUsers []string `yaml:"allowed_users"`
+
+	// NotFoundPage is the HTML file responded for unknown links.
+	NotFoundPage string `yaml:"not_found_page"`
 }
 
-// Load returns structure with configuration parameters.
+// Load returns the configuration from the command line flags, the
+// environment and the configuration file.
 func Load() (*Config, error) {
-	var config Config
+	return parse(flag.CommandLine, os.Args[1:], os.Environ())
+}
+
+func parse(fs *flag.FlagSet, args, environ []string) (*Config, error) {
+	environment := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			environment[k] = v
+		}
+	}
+
+	config := new(Config)
+	if err := config.setDefaults(); err != nil {
+		return nil, err
+	}
 
-	env.Parse(&config)
+	// The flags are parsed first to find the configuration file, their
+	// values are applied again after the other layers.
+	config.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
-	flag.StringVar(&config.ServerAddress, "a", config.ServerAddress, "Server address")
-	flag.StringVar(&config.BaseURL, "b", config.BaseURL, "Base URL")
-	flag.StringVar(&config.FileStoragePath, "f", config.FileStoragePath, "File storage path")
-	flag.StringVar(&config.AuthSignKey, "k", config.AuthSignKey, "Auth sign key")
-	flag.StringVar(&config.DatabaseDSN, "d", config.DatabaseDSN, "Database DSN")
-	flag.BoolVar(&config.EnableHTTPS, "s", config.EnableHTTPS, "Enables HTTPS")
-	flag.StringVar(&config.Config, "config", config.Config, "Configuration file path")
-	flag.StringVar(&config.Config, "c", config.Config, "Configuration file path (shorthand)")
-	flag.StringVar(&config.TrustedSubnet, "t", config.TrustedSubnet, "")
-	flag.Parse()
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
 
-	if config.Config == "" {
-		return &config, nil
+	path := environment["CONFIG"]
+	if config.Config != "" {
+		path = config.Config
 	}
 
-	file, err := os.OpenFile(config.Config, os.O_RDONLY, 0777)
-	if err != nil {
+	if err := config.setDefaults(); err != nil {
 		return nil, err
 	}
 
-	fileData, err := io.ReadAll(file)
-	if err != nil {
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.readEnv(environment); err != nil {
+		return nil, err
+	}
+
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", name, err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
-	var jsonConfig Config
-	err = json.Unmarshal(fileData, &jsonConfig)
+	return config, nil
+}
+
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ServerAddress, "a", c.ServerAddress, "Server address")
+	fs.StringVar(&c.BaseURL, "b", c.BaseURL, "Base URL")
+	fs.StringVar(&c.FileStoragePath, "f", c.FileStoragePath, "File storage path")
+	fs.StringVar(&c.AuthSignKey, "k", c.AuthSignKey, "Auth sign key")
+	fs.StringVar(&c.DatabaseDSN, "d", c.DatabaseDSN, "Database DSN")
+	fs.BoolVar(&c.EnableHTTPS, "s", c.EnableHTTPS, "Enables HTTPS")
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "HTTPS certificate file")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "HTTPS key file")
+	fs.StringVar(&c.AutocertHosts, "autocert-hosts", c.AutocertHosts, "Hosts allowed for autocert (comma-separated)")
+	fs.StringVar(&c.AutocertCacheDir, "autocert-cache", c.AutocertCacheDir, "Autocert cache directory")
+	fs.StringVar(&c.AutocertDirectoryURL, "autocert-dir-url", c.AutocertDirectoryURL, "ACME directory URL")
+	fs.StringVar(&c.AutocertEmail, "autocert-email", c.AutocertEmail, "ACME account contact email")
+	fs.StringVar(&c.HTTPRedirectAddress, "http-redirect", c.HTTPRedirectAddress, "Plain HTTP address redirecting to HTTPS")
+	fs.IntVar(&c.RedirectCode, "redirect-code", c.RedirectCode, "Redirect status of the default domain")
+	fs.StringVar(&c.NotFoundPage, "not-found-page", c.NotFoundPage, "HTML file for unknown links of the default domain")
+	fs.StringVar(&c.Config, "config", c.Config, "Configuration file path (JSON, YAML or TOML)")
+	fs.StringVar(&c.Config, "c", c.Config, "Configuration file path (shorthand)")
+	fs.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "Trusted subnets (comma-separated CIDRs)")
+	fs.StringVar(&c.TrustedProxies, "trusted-proxies", c.TrustedProxies, "Trusted proxies (comma-separated CIDRs)")
+	fs.StringVar(&c.RateLimitShorten, "rl-shorten", c.RateLimitShorten, "Shorten rate limit (rate:burst)")
+	fs.StringVar(&c.RateLimitBatch, "rl-batch", c.RateLimitBatch, "Batch shorten rate limit (rate:burst)")
+	fs.StringVar(&c.RateLimitRedirect, "rl-redirect", c.RateLimitRedirect, "Redirect rate limit (rate:burst)")
+	fs.StringVar(&c.RateLimitDelete, "rl-delete", c.RateLimitDelete, "Delete rate limit (rate:burst)")
+	fs.IntVar(&c.MaxLinksPerUser, "max-links", c.MaxLinksPerUser, "Max active links per user")
+	fs.IntVar(&c.MaxBatchSize, "max-batch", c.MaxBatchSize, "Max batch size")
+	fs.IntVar(&c.MaxDeleteIDs, "max-delete", c.MaxDeleteIDs, "Max IDs per delete request")
+	fs.StringVar(&c.AuditLogPath, "audit", c.AuditLogPath, "Audit log file path")
+	fs.StringVar(&c.OutboxFilePath, "outbox", c.OutboxFilePath, "Outbox events file path")
+	fs.StringVar(&c.WebhookAllowedSubnets, "webhook-allowed-subnets", c.WebhookAllowedSubnets, "Internal subnets allowed for webhooks (comma-separated CIDRs)")
+	fs.StringVar(&c.GRPCAddress, "g", c.GRPCAddress, "gRPC server address")
+	fs.StringVar(&c.GRPCCertFile, "grpc-cert", c.GRPCCertFile, "gRPC TLS certificate file")
+	fs.StringVar(&c.GRPCKeyFile, "grpc-key", c.GRPCKeyFile, "gRPC TLS key file")
+	fs.StringVar(&c.GRPCClientCAFile, "grpc-client-ca", c.GRPCClientCAFile, "gRPC client CA file for mTLS")
+	fs.BoolVar(&c.GRPCReflection, "grpc-reflection", c.GRPCReflection, "Enables gRPC server reflection")
+	fs.StringVar(&c.AdminAddress, "admin", c.AdminAddress, "Admin server address (metrics and pprof)")
+	fs.StringVar(&c.TraceExporter, "trace", c.TraceExporter, "Trace exporter: none, stdout or otlp")
+	fs.StringVar(&c.TraceEndpoint, "trace-endpoint", c.TraceEndpoint, "OTLP gRPC collector address")
+	fs.BoolVar(&c.TraceInsecure, "trace-insecure", c.TraceInsecure, "Disables TLS to OTLP collector")
+	fs.Float64Var(&c.TraceSampleRatio, "trace-sample", c.TraceSampleRatio, "Share of sampled traces started by the service")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level: debug, info, warn or error")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Graceful shutdown budget")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-delay", c.ShutdownDelay, "Delay of listeners shutdown after readiness probes fail")
+	fs.BoolVar(&c.PrintConfig, "print-config", c.PrintConfig, "Prints the effective configuration with masked secrets and exits")
+}
+
+// setDefaults resets the fields to the defaults of the env tags.
+func (c *Config) setDefaults() error {
+	*c = Config{}
+
+	return env.Parse(c, env.Options{Environment: map[string]string{}})
+}
+
+// readFile applies the configuration file. JSON and TOML are decoded
+// through YAML, so that all formats share the keys and the duration format.
+// Unknown keys are rejected.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	var doc map[string]any
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s: unknown format, want .json, .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if doc != nil {
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readEnv applies the variables set in the environment, the defaults of
+// unset variables are not applied.
+func (c *Config) readEnv(environment map[string]string) error {
+	environment, err := readSecretFiles(environment)
 	if err != nil {
+		return err
+	}
+
+	var parsed Config
+	if err = env.Parse(&parsed, env.Options{Environment: environment}); err != nil {
+		return err
+	}
+
+	dst := reflect.ValueOf(c).Elem()
+	src := reflect.ValueOf(&parsed).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if _, ok := environment[envName(dst.Type().Field(i))]; ok {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	return nil
+}
+
+// readSecretFiles returns the copy of environment with the secrets read
+// from the files named by the _FILE variables.
+func readSecretFiles(environment map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(environment))
+	for k, v := range environment {
+		result[k] = v
+	}
+
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+
+		name := envName(field)
+		path, ok := environment[name+"_FILE"]
+		if !ok {
+			continue
+		}
+
+		if _, ok = environment[name]; ok {
+			return nil, fmt.Errorf("both %s and %s_FILE are set", name, name)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		result[name] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return result, nil
+}
+
+func envName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+// Validate checks the addresses, URLs, subnets, limits and levels.
+func (c *Config) Validate() error {
+	addresses := []struct {
+		name, addr string
+	}{
+		{"server address", c.ServerAddress},
+		{"gRPC address", c.GRPCAddress},
+		{"admin address", c.AdminAddress},
+	}
+	for _, a := range addresses {
+		if err := validateAddress(a.addr); err != nil {
+			return fmt.Errorf("%s %q: %w", a.name, a.addr, err)
+		}
+	}
+
+	if err := validateBaseURL(c.BaseURL); err != nil {
+		return fmt.Errorf("base URL %q: %w", c.BaseURL, err)
+	}
+
+	if err := c.validateDomains(); err != nil {
+		return err
+	}
+
+	if c.AuthSignKey == "" {
+		return errors.New("auth sign key is empty")
+	}
+
+	if _, err := access.ParseCIDRs(c.TrustedSubnet); err != nil {
+		return fmt.Errorf("trusted subnet: %w", err)
+	}
+
+	if _, err := access.ParseCIDRs(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	if _, err := access.ParseCIDRs(c.WebhookAllowedSubnets); err != nil {
+		return fmt.Errorf("webhook allowed subnets: %w", err)
+	}
+
+	if _, err := c.RateLimitRules(); err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+
+	if c.MaxLinksPerUser < 0 || c.MaxBatchSize < 0 || c.MaxDeleteIDs < 0 {
+		return errors.New("user quotas must not be negative")
+	}
+
+	if err := c.validateHTTPS(); err != nil {
+		return err
+	}
+
+	if _, err := c.GRPCTLS(); err != nil {
+		return err
+	}
+
+	switch c.TraceExporter {
+	case "", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		return fmt.Errorf("unknown trace exporter %q", c.TraceExporter)
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return fmt.Errorf("trace sample ratio %v is out of [0, 1]", c.TraceSampleRatio)
+	}
+
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("shutdown timeout must be positive")
+	}
+
+	if c.ShutdownDelay < 0 || c.ShutdownDelay >= c.ShutdownTimeout {
+		return errors.New("shutdown delay must be less than shutdown timeout")
+	}
+
+	return nil
+}
+
+func validateAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	return nil
+}
+
+func validateBaseURL(rawURL string) error {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+
+	if u.Host == "" {
+		return errors.New("host is empty")
+	}
+
+	return nil
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Masked returns the copy of the configuration with the masked secrets.
+// The database DSN keeps everything but the password.
+func (c *Config) Masked() Config {
+	masked := *c
+
+	v := reflect.ValueOf(&masked).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("secret") == "true" && v.Field(i).String() != "" {
+			v.Field(i).SetString(logger.Redacted)
+		}
+	}
+
+	if c.DatabaseDSN != "" {
+		masked.DatabaseDSN = maskDSN(c.DatabaseDSN)
+	}
+
+	return masked
+}
+
+// maskDSN masks the password of URL and keyword/value DSN.
+func maskDSN(dsn string) string {
+	u, err := neturl.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return dsnPassword.ReplaceAllString(dsn, "${1}"+logger.Redacted)
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = neturl.UserPassword(u.User.Username(), logger.Redacted)
+	}
+
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", logger.Redacted)
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
+
+// Print writes the masked configuration in YAML, it is a valid
+// configuration file.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(c.Masked()); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func (c *Config) validateDomains() error {
+	if err := (url.Redirect{Code: c.RedirectCode}).Validate(); err != nil {
+		return fmt.Errorf("redirect code: %w", err)
+	}
+
+	hosts := make(map[string]bool, len(c.Domains)+1)
+	if u, err := neturl.Parse(c.BaseURL); err == nil {
+		hosts[strings.ToLower(u.Hostname())] = true
+	}
+
+	for _, d := range c.Domains {
+		host := strings.ToLower(d.Host)
+		if host == "" || strings.ContainsAny(host, ":/") {
+			return fmt.Errorf("domain host %q must be a host name", d.Host)
+		}
+		if hosts[host] {
+			return fmt.Errorf("domain %s is set twice", d.Host)
+		}
+		hosts[host] = true
+
+		if err := validateBaseURL(d.BaseURL); err != nil {
+			return fmt.Errorf("domain %s base URL %q: %w", d.Host, d.BaseURL, err)
+		}
+
+		if err := (url.Redirect{Code: d.RedirectCode}).Validate(); err != nil {
+			return fmt.Errorf("domain %s redirect code: %w", d.Host, err)
+		}
+	}
+
+	return nil
+}
+
+// ShortDomains returns the short link domains with the not found pages read
+// from their files.
+func (c *Config) ShortDomains() (*url.Domains, error) {
+	def := url.Domain{BaseURL: c.BaseURL, RedirectCode: c.RedirectCode}
+
+	var err error
+	if def.NotFoundPage, err = readPage(c.NotFoundPage); err != nil {
 		return nil, err
 	}
 
-	if config.ServerAddress == "" {
-		config.ServerAddress = jsonConfig.ServerAddress
+	others := make([]url.Domain, 0, len(c.Domains))
+	for _, d := range c.Domains {
+		page, err := readPage(d.NotFoundPage)
+		if err != nil {
+			return nil, fmt.Errorf("domain %s: %w", d.Host, err)
+		}
+
+		others = append(others, url.Domain{
+			Name:         d.Host,
+			BaseURL:      d.BaseURL,
+			RedirectCode: d.RedirectCode,
+			AllowedUsers: d.AllowedUsers,
+			NotFoundPage: page,
+		})
 	}
 
-	if config.BaseURL == "" {
-		config.BaseURL = jsonConfig.BaseURL
+	return url.NewDomains(def, others...), nil
+}
+
+func readPage(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
 	}
 
-	if config.FileStoragePath == "" {
-		config.FileStoragePath = jsonConfig.FileStoragePath
+	page, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("not found page: %w", err)
 	}
 
-	if config.AuthSignKey == "" {
-		config.AuthSignKey = jsonConfig.AuthSignKey
+	return page, nil
+}
+
+// Quota returns default user quota.
+func (c *Config) Quota() url.Quota {
+	return url.Quota{
+		MaxLinks:     c.MaxLinksPerUser,
+		MaxBatchSize: c.MaxBatchSize,
+		MaxDeleteIDs: c.MaxDeleteIDs,
+	}
+}
+
+func (c *Config) validateHTTPS() error {
+	if !c.EnableHTTPS {
+		if c.TLSCertFile != "" || c.TLSKeyFile != "" || c.AutocertHosts != "" || c.HTTPRedirectAddress != "" {
+			return errors.New("TLS certificate and HTTP redirect settings require enable_https")
+		}
+		return nil
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("both TLS cert and key files must be set")
+	}
+
+	if c.TLSCertFile == "" && len(c.Hosts()) == 0 {
+		return errors.New("HTTPS requires TLS cert and key files or autocert hosts")
 	}
 
-	if config.DatabaseDSN == "" {
-		config.DatabaseDSN = jsonConfig.DatabaseDSN
+	if c.AutocertDirectoryURL != "" {
+		if err := validateBaseURL(c.AutocertDirectoryURL); err != nil {
+			return fmt.Errorf("autocert directory URL %q: %w", c.AutocertDirectoryURL, err)
+		}
 	}
 
-	if !config.EnableHTTPS {
-		config.EnableHTTPS = jsonConfig.EnableHTTPS
+	if c.HTTPRedirectAddress != "" {
+		if err := validateAddress(c.HTTPRedirectAddress); err != nil {
+			return fmt.Errorf("HTTP redirect address %q: %w", c.HTTPRedirectAddress, err)
+		}
+	}
+
+	return nil
+}
+
+// Hosts returns the hosts allowed for autocert.
+func (c *Config) Hosts() []string {
+	var hosts []string
+	for _, h := range strings.Split(c.AutocertHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts
+}
+
+// GRPCTLS reports whether the gRPC listener uses TLS. Cert and key files
+// must be set together.
+func (c *Config) GRPCTLS() (bool, error) {
+	if (c.GRPCCertFile == "") != (c.GRPCKeyFile == "") {
+		return false, errors.New("both gRPC cert and key files must be set")
+	}
+
+	if c.GRPCCertFile == "" && c.GRPCClientCAFile != "" {
+		return false, errors.New("gRPC client CA file requires cert and key files")
+	}
+
+	return c.GRPCCertFile != "", nil
+}
+
+// RateLimitRules returns parsed rate limit rules for all route classes.
+func (c *Config) RateLimitRules() (map[ratelimit.Class]ratelimit.Rule, error) {
+	raw := map[ratelimit.Class]string{
+		ratelimit.Shorten:  c.RateLimitShorten,
+		ratelimit.Batch:    c.RateLimitBatch,
+		ratelimit.Redirect: c.RateLimitRedirect,
+		ratelimit.Delete:   c.RateLimitDelete,
 	}
 
-	if config.TrustedSubnet == "" {
-		config.TrustedSubnet = jsonConfig.TrustedSubnet
+	rules := make(map[ratelimit.Class]ratelimit.Rule, len(raw))
+	for class, s := range raw {
+		rule, err := ratelimit.ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules[class] = rule
 	}
 
-	return &config, nil
+	return rules, nil
 }
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Reload returns the configuration from the same flags, environment and
+// configuration file as Load. The file and the _FILE secrets are read again.
+func Reload() (*Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	return parse(fs, os.Args[1:], os.Environ())
+}
+
+// ReloadReport is the result of the configuration reload.
+type ReloadReport struct {
+	// Applied are the keys of the changed fields applied to the running
+	// service.
+	Applied []string `json:"applied"`
+
+	// RestartRequired are the keys of the changed fields applied after
+	// restart only.
+	RestartRequired []string `json:"restart_required"`
+}
+
+type subscriber struct {
+	name  string
+	apply func(c *Config) error
+}
+
+// Reloader keeps the current configuration and applies the changes of the
+// fields tagged as reloadable to the subscribers.
+type Reloader struct {
+	load func() (*Config, error)
+	log  *zap.Logger
+
+	mu      sync.Mutex
+	current *Config
+	subs    []subscriber
+}
+
+// NewReloader returns reloader of the configuration c loaded again with
+// load, nil means Reload. Reloads are logged to l, nil discards them.
+func NewReloader(c *Config, load func() (*Config, error), l *zap.Logger) *Reloader {
+	if load == nil {
+		load = Reload
+	}
+
+	return &Reloader{
+		load:    load,
+		log:     logger.OrNop(l),
+		current: c,
+	}
+}
+
+// Subscribe adds the component applying the configuration. apply is called
+// with the whole configuration when any reloadable field is changed.
+func (r *Reloader) Subscribe(name string, apply func(c *Config) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subs = append(r.subs, subscriber{name: name, apply: apply})
+}
+
+// Current returns the configuration applied to the running service.
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// Reload loads the configuration and applies the reloadable changes. The
+// current configuration is kept if the new one is not valid. If a
+// subscriber fails, the next reload applies the changes again.
+func (r *Reloader) Reload() (*ReloadReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		r.log.Error("configuration reload error", zap.Error(err))
+		return nil, err
+	}
+
+	applied := *r.current
+	report := &ReloadReport{Applied: []string{}, RestartRequired: []string{}}
+
+	cur := reflect.ValueOf(r.current).Elem()
+	nv := reflect.ValueOf(next).Elem()
+	av := reflect.ValueOf(&applied).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		field := cur.Type().Field(i)
+		key := fileKey(field)
+		if key == "" || reflect.DeepEqual(cur.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+
+		if field.Tag.Get("reload") != "true" {
+			report.RestartRequired = append(report.RestartRequired, key)
+			continue
+		}
+
+		av.Field(i).Set(nv.Field(i))
+		report.Applied = append(report.Applied, key)
+	}
+
+	if len(report.RestartRequired) > 0 {
+		r.log.Warn("configuration changes require restart", zap.Strings("keys", report.RestartRequired))
+	}
+
+	if len(report.Applied) == 0 {
+		r.log.Info("configuration reloaded without changes")
+		return report, nil
+	}
+
+	for _, s := range r.subs {
+		if e := s.apply(&applied); e != nil {
+			r.log.Error("configuration apply error", zap.String("component", s.name), zap.Error(e))
+			if err == nil {
+				err = fmt.Errorf("%s: %w", s.name, e)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.current = &applied
+	r.log.Info("configuration reloaded", zap.Strings("applied", report.Applied))
+
+	return report, nil
+}
+
+// ServeHTTP reloads the configuration on POST request and responds with
+// the report.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := r.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// fileKey returns the configuration file key of the field, empty for the
+// fields not set in the file.
+func fileKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if key == "-" {
+		return ""
+	}
+
+	return key
+}
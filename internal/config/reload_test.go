@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	current, err := testParse(nil, nil)
+	require.NoError(t, err)
+
+	var next *Config
+	var loadErr error
+	r := NewReloader(current, func() (*Config, error) { return next, loadErr }, nil)
+
+	var applied []*Config
+	var applyErr error
+	r.Subscribe("test", func(c *Config) error {
+		applied = append(applied, c)
+		return applyErr
+	})
+
+	t.Run("applied and restart required", func(t *testing.T) {
+		next, err = testParse([]string{"-t", "10.0.0.0/8", "-log-level", "debug", "-a", "localhost:8081"}, nil)
+		require.NoError(t, err)
+
+		report, err := r.Reload()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"trusted_subnet", "log_level"}, report.Applied)
+		assert.Equal(t, []string{"server_address"}, report.RestartRequired)
+
+		require.Len(t, applied, 1)
+		assert.Equal(t, "10.0.0.0/8", applied[0].TrustedSubnet)
+		assert.Equal(t, "localhost:8080", applied[0].ServerAddress)
+		assert.Equal(t, applied[0], r.Current())
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		report, err := r.Reload()
+		require.NoError(t, err)
+		assert.Empty(t, report.Applied)
+		assert.Len(t, applied, 1)
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		loadErr = errors.New("trusted subnet: invalid CIDR address")
+		defer func() { loadErr = nil }()
+
+		_, err := r.Reload()
+		assert.Error(t, err)
+		assert.Equal(t, "10.0.0.0/8", r.Current().TrustedSubnet)
+	})
+
+	t.Run("apply error", func(t *testing.T) {
+		applyErr = errors.New("apply failed")
+
+		next, err = testParse([]string{"-t", "192.168.0.0/16"}, nil)
+		require.NoError(t, err)
+
+		_, err := r.Reload()
+		assert.Error(t, err)
+		assert.Equal(t, "10.0.0.0/8", r.Current().TrustedSubnet)
+
+		applyErr = nil
+		_, err = r.Reload()
+		assert.NoError(t, err)
+		assert.Equal(t, "192.168.0.0/16", r.Current().TrustedSubnet)
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config/reload", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+		next, err = testParse([]string{"-rl-shorten", "5:20"}, nil)
+		require.NoError(t, err)
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report ReloadReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Contains(t, report.Applied, "rate_limit_shorten")
+	})
+}
@@ -0,0 +1,259 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
+)
+
+// NewAuditSink returns object that implements url.AuditSink interface.
+//
+// If databaseDSN provided, NewAuditSink returns DB table implementation.
+// If filePath provided, it returns JSON lines file implementation.
+// Otherwise all events are discarded.
+func NewAuditSink(databaseDSN, filePath string, l *zap.Logger) (url.AuditSink, error) {
+	if databaseDSN != "" {
+		return newDBAuditSink(databaseDSN, l)
+	}
+
+	if filePath != "" {
+		return newFileAuditSink(filePath, l)
+	}
+
+	return url.NewNopAuditSink(), nil
+}
+
+type fileAuditSink struct {
+	file *os.File
+	log  *zap.Logger
+	mu   sync.Mutex
+}
+
+func newFileAuditSink(filePath string, l *zap.Logger) (*fileAuditSink, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit file: %w", err)
+	}
+
+	return &fileAuditSink{file: file, log: logger.OrNop(l)}, nil
+}
+
+// Write appends events to the file, one JSON object per line.
+func (f *fileAuditSink) Write(ctx context.Context, events ...url.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var b []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("JSON encoding error: %w", err)
+		}
+		b = append(append(b, line...), '\n')
+	}
+
+	if _, err := f.file.Write(b); err != nil {
+		return fmt.Errorf("cannot write audit file: %w", err)
+	}
+
+	return nil
+}
+
+// Query reads the whole file and returns the matching events.
+func (f *fileAuditSink) Query(ctx context.Context, filter url.AuditFilter) ([]url.AuditEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit file: %w", err)
+	}
+	defer closeFile(ctx, f.log, file)
+
+	var events []url.AuditEvent
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		select {
+		default:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		var event url.AuditEvent
+		if err = json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("cannot parse audit file: %w", err)
+		}
+
+		if !filter.Match(&event) {
+			continue
+		}
+
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read audit file: %w", err)
+	}
+
+	return events, nil
+}
+
+// Close closes the file.
+func (f *fileAuditSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+type dbAuditSink struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+func newDBAuditSink(dsn string, l *zap.Logger) (*dbAuditSink, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id bigserial PRIMARY KEY,
+			time timestamptz NOT NULL,
+			action varchar NOT NULL,
+			"user" varchar NOT NULL,
+			link_id varchar,
+			url varchar,
+			ip varchar,
+			transport varchar
+		);`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create audit table: %w", err)
+	}
+
+	return &dbAuditSink{db: db, log: logger.OrNop(l)}, nil
+}
+
+// Write inserts events into the audit table.
+func (d *dbAuditSink) Write(ctx context.Context, events ...url.AuditEvent) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	stmt, err := tx.PrepareContext(
+		ctx,
+		`INSERT INTO audit_log (time, action, "user", link_id, url, ip, transport) VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+	)
+	if err != nil {
+		return fmt.Errorf("statement error: %w", err)
+	}
+	defer closeStmt(ctx, d.log, stmt)
+
+	for _, event := range events {
+		_, err = stmt.ExecContext(ctx, event.Time, event.Action, event.UserID, event.LinkID, event.URL, event.IP, event.Transport)
+		if err != nil {
+			return fmt.Errorf("cannot insert audit event: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns the matching events from the audit table.
+func (d *dbAuditSink) Query(ctx context.Context, f url.AuditFilter) ([]url.AuditEvent, error) {
+	var conds []string
+	var args []any
+
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID != "" {
+		addCond(`"user" = $%d`, f.UserID)
+	}
+	if f.Action != "" {
+		addCond(`action = $%d`, f.Action)
+	}
+	if f.LinkID != "" {
+		addCond(`link_id = $%d`, f.LinkID)
+	}
+	if !f.From.IsZero() {
+		addCond(`time >= $%d`, f.From)
+	}
+	if !f.To.IsZero() {
+		addCond(`time < $%d`, f.To)
+	}
+
+	query := `SELECT time, action, "user", link_id, url, ip, transport FROM audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := d.db.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find audit events: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	var events []url.AuditEvent
+
+	for rows.Next() {
+		var event url.AuditEvent
+		err = rows.Scan(&event.Time, &event.Action, &event.UserID, &event.LinkID, &event.URL, &event.IP, &event.Transport)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return events, nil
+}
+
+// Close closes the DB connection.
+func (d *dbAuditSink) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileAuditSink(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := newFileAuditSink(filePath, nil)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	events := []url.AuditEvent{
+		{Time: now, Action: url.ActionCreated, UserID: "user1", LinkID: "1", URL: "http://shortener.com", IP: "10.0.0.1", Transport: url.TransportHTTP},
+		{Time: now.Add(time.Minute), Action: url.ActionCreated, UserID: "user2", LinkID: "2", URL: "http://shortener.ru", Transport: url.TransportGRPC},
+		{Time: now.Add(2 * time.Minute), Action: url.ActionDeleted, UserID: "user1", LinkID: "1", IP: "10.0.0.1", Transport: url.TransportHTTP},
+	}
+
+	err = sink.Write(context.Background(), events[:2]...)
+	require.NoError(t, err)
+	err = sink.Write(context.Background(), events[2])
+	require.NoError(t, err)
+
+	got, err := sink.Query(context.Background(), url.AuditFilter{UserID: "user1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []url.AuditEvent{events[0], events[2]}, got)
+
+	got, err = sink.Query(context.Background(), url.AuditFilter{Action: url.ActionCreated, From: now.Add(time.Second)})
+	assert.NoError(t, err)
+	assert.Equal(t, []url.AuditEvent{events[1]}, got)
+
+	got, err = sink.Query(context.Background(), url.AuditFilter{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []url.AuditEvent{events[0]}, got)
+
+	require.NoError(t, sink.Close())
+
+	fileData, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(fileData), `"action":"deleted"`)
+}
@@ -5,21 +5,54 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"sort"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ruskiiamov/shortener/internal/logger"
 	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
 )
 
-const pgx = "pgx"
+const (
+	outboxLease  = 30 * time.Second
+	outboxInsert = `INSERT INTO outbox (type, "user", url_id, url) VALUES ($1, $2, $3, $4);`
+
+	insertURL   = `INSERT INTO urls (url, "user", domain, redirect_code, cache_control) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (domain, url) DO NOTHING RETURNING id;`
+	selectURLID = `SELECT id FROM urls WHERE domain=$1 AND url=$2;`
+	urlColumns  = `id, url, "user", deleted, domain, redirect_code, cache_control`
+
+	// urlsSequence is the sequence of the urls serial id.
+	urlsSequence = "urls_id_seq"
+	nextIDQuery  = `SELECT CASE WHEN is_called THEN last_value + 1 ELSE last_value END FROM ` + urlsSequence
+
+	// schemaVersion is the version of the tables created by this build.
+	schemaVersion = 3
+)
+
+// migrations upgrade the tables, migrations[v-1] upgrades version v to v+1.
+// The statements are idempotent, so the tables of the builds before the
+// schema version are upgraded from version 1.
+var migrations = [][]string{
+	// Links belong to domains, URLs are unique per domain.
+	{
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain varchar NOT NULL DEFAULT '';`,
+		`DROP INDEX IF EXISTS url_idx;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS domain_url_idx ON urls (domain, url);`,
+	},
+	// Links have their own redirect semantics.
+	{
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_code integer NOT NULL DEFAULT 0;`,
+		`ALTER TABLE urls ADD COLUMN IF NOT EXISTS cache_control varchar NOT NULL DEFAULT '';`,
+	},
+}
 
 type dbKeeper struct {
-	db *sql.DB
+	db  *sql.DB
+	log *zap.Logger
 }
 
-func newDBKeeper(dsn string) (*dbKeeper, error) {
-	db, err := sql.Open(pgx, dsn)
+func newDBKeeper(dsn string, l *zap.Logger) (*dbKeeper, error) {
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +66,31 @@ func newDBKeeper(dsn string) (*dbKeeper, error) {
 		}
 	}
 
-	return &dbKeeper{db: db}, nil
+	if err := createQuotaTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if err := createOutboxTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if err := setSchemaVersion(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return &dbKeeper{db: db, log: logger.OrNop(l)}, nil
+}
+
+func rollback(ctx context.Context, l *zap.Logger, tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Request(ctx, l).Warn("transaction rollback error", zap.Error(err))
+	}
+}
+
+func closeStmt(ctx context.Context, l *zap.Logger, stmt *sql.Stmt) {
+	if err := stmt.Close(); err != nil {
+		logger.Request(ctx, l).Warn("statement close error", zap.Error(err))
+	}
 }
 
 func tableDoesntExist(ctx context.Context, db *sql.DB) bool {
@@ -49,14 +106,17 @@ func createTable(ctx context.Context, db *sql.DB) error {
 			id serial PRIMARY KEY, 
 			url varchar, 
 			"user" varchar,
-			deleted boolean DEFAULT FALSE
+			deleted boolean DEFAULT FALSE,
+			domain varchar NOT NULL DEFAULT '',
+			redirect_code integer NOT NULL DEFAULT 0,
+			cache_control varchar NOT NULL DEFAULT ''
 		);`,
 	)
 	if err != nil {
 		return fmt.Errorf("cannot create db table: %w", err)
 	}
 
-	_, err = db.ExecContext(ctx, "CREATE UNIQUE INDEX url_idx ON urls (url);")
+	_, err = db.ExecContext(ctx, "CREATE UNIQUE INDEX domain_url_idx ON urls (domain, url);")
 	if err != nil {
 		return fmt.Errorf("cannot create index for url: %w", err)
 	}
@@ -64,19 +124,114 @@ func createTable(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
-// Add saves URL for one user and returns URL id in DB.
-func (d *dbKeeper) Add(ctx context.Context, userID, original string) (int, error) {
-	var id int
+func createQuotaTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS quotas (
+			"user" varchar PRIMARY KEY,
+			max_links integer NOT NULL DEFAULT 0,
+			max_batch_size integer NOT NULL DEFAULT 0,
+			max_delete_ids integer NOT NULL DEFAULT 0
+		);`,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create quotas table: %w", err)
+	}
 
-	err := d.db.QueryRowContext(
+	return nil
+}
+
+func createOutboxTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(
 		ctx,
-		`INSERT INTO urls (url, "user") VALUES ($1, $2) ON CONFLICT (url) DO NOTHING RETURNING id;`,
-		original,
-		userID,
-	).Scan(&id)
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id bigserial PRIMARY KEY,
+			type varchar NOT NULL,
+			time timestamptz NOT NULL DEFAULT now(),
+			"user" varchar NOT NULL,
+			url_id integer NOT NULL,
+			url varchar NOT NULL,
+			locked_until timestamptz
+		);`,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create outbox table: %w", err)
+	}
+
+	return nil
+}
+
+// setSchemaVersion upgrades the tables and records their version. It fails
+// if the tables belong to a newer build.
+func setSchemaVersion(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version integer NOT NULL);`)
+	if err != nil {
+		return fmt.Errorf("cannot create schema version table: %w", err)
+	}
+
+	version, err := getSchemaVersion(ctx, db)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if err = migrate(ctx, db, 1); err == nil {
+			_, err = db.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES ($1);`, schemaVersion)
+		}
+	case err != nil:
+	case version > schemaVersion:
+		err = fmt.Errorf("schema version %d is newer than supported %d", version, schemaVersion)
+	case version < schemaVersion:
+		if err = migrate(ctx, db, version); err == nil {
+			_, err = db.ExecContext(ctx, `UPDATE schema_version SET version = $1;`, schemaVersion)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("schema version error: %w", err)
+	}
+
+	return nil
+}
+
+// migrate upgrades the tables from version to schemaVersion in one
+// transaction.
+func migrate(ctx context.Context, db *sql.DB, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, zap.NewNop(), tx)
+
+	for v := version; v < schemaVersion; v++ {
+		for _, stmt := range migrations[v-1] {
+			if _, err = tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration to version %d: %w", v+1, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func getSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT version FROM schema_version;`).Scan(&version)
+
+	return version, err
+}
+
+// Add saves URL for one user on the domain with the redirect and returns URL
+// id in DB.
+func (d *dbKeeper) Add(ctx context.Context, userID, domain, original string, r url.Redirect) (int, error) {
+	var id int
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	err = tx.QueryRowContext(ctx, insertURL, original, userID, domain, r.Code, r.CacheControl).Scan(&id)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		err = d.db.QueryRowContext(ctx, `SELECT id FROM urls WHERE url=$1;`, original).Scan(&id)
+		err = tx.QueryRowContext(ctx, selectURLID, domain, original).Scan(&id)
 		if err != nil {
 			return 0, fmt.Errorf("cannot find url: %w", err)
 		}
@@ -87,161 +242,510 @@ func (d *dbKeeper) Add(ctx context.Context, userID, original string) (int, error
 		return 0, fmt.Errorf("cannot add url: %w", err)
 	}
 
+	_, err = tx.ExecContext(ctx, outboxInsert, url.EventLinkCreated, userID, id, original)
+	if err != nil {
+		return 0, fmt.Errorf("cannot add outbox event: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("transaction commit error: %w", err)
+	}
+
 	return id, nil
 }
 
-// AddBatch saves the URL batch for one user and returns the map whith URL id in DB.
-func (d *dbKeeper) AddBatch(ctx context.Context, userID string, originals []string) (map[string]int, error) {
+// AddBatch saves the URL batch for one user on the domain and returns the map
+// whith URL id in DB and the IDs of the new URLs.
+func (d *dbKeeper) AddBatch(ctx context.Context, userID, domain string, originals []string) (map[string]int, []int, error) {
 	added := make(map[string]int)
+	var created []int
 
 	tx, err := d.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("transaction error: %w", err)
+		return nil, nil, fmt.Errorf("transaction error: %w", err)
 	}
-	defer func() {
-		e := tx.Rollback()
-		if e != nil {
-			log.Println(e)
-		}
-	}()
+	defer rollback(ctx, d.log, tx)
 
-	insStmt, err := tx.PrepareContext(
-		ctx,
-		`INSERT INTO urls (url, "user") VALUES ($1, $2) ON CONFLICT (url) DO NOTHING RETURNING id;`,
-	)
+	insStmt, err := tx.PrepareContext(ctx, insertURL)
 	if err != nil {
-		return nil, fmt.Errorf("statement error: %w", err)
+		return nil, nil, fmt.Errorf("statement error: %w", err)
 	}
-	defer func() {
-		e := insStmt.Close()
-		if e != nil {
-			log.Println(err)
-		}
-	}()
+	defer closeStmt(ctx, d.log, insStmt)
 
-	selStmt, err := tx.PrepareContext(ctx, `SELECT id FROM urls WHERE url=$1;`)
+	selStmt, err := tx.PrepareContext(ctx, selectURLID)
 	if err != nil {
-		return nil, fmt.Errorf("statement error: %w", err)
+		return nil, nil, fmt.Errorf("statement error: %w", err)
 	}
-	defer func() {
-		e := selStmt.Close()
-		if e != nil {
-			log.Println(e)
-		}
-	}()
+	defer closeStmt(ctx, d.log, selStmt)
+
+	outStmt, err := tx.PrepareContext(ctx, outboxInsert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("statement error: %w", err)
+	}
+	defer closeStmt(ctx, d.log, outStmt)
 
 	var id int
 
 	for _, original := range originals {
-		err = insStmt.QueryRowContext(ctx, original, userID).Scan(&id)
+		err = insStmt.QueryRowContext(ctx, original, userID, domain, 0, "").Scan(&id)
 
 		if errors.Is(err, sql.ErrNoRows) {
-			err = selStmt.QueryRowContext(ctx, original).Scan(&id)
+			err = selStmt.QueryRowContext(ctx, domain, original).Scan(&id)
 			if err != nil {
-				return nil, fmt.Errorf("cannot find url: %w", err)
+				return nil, nil, fmt.Errorf("cannot find url: %w", err)
 			}
+			added[original] = id
+			continue
 		}
 
 		if err != nil {
-			return nil, fmt.Errorf("cannot add url: %w", err)
+			return nil, nil, fmt.Errorf("cannot add url: %w", err)
+		}
+
+		_, err = outStmt.ExecContext(ctx, url.EventLinkCreated, userID, id, original)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot add outbox event: %w", err)
 		}
 
 		added[original] = id
+		created = append(created, id)
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, fmt.Errorf("transaction commit error: %w", err)
+		return nil, nil, fmt.Errorf("transaction commit error: %w", err)
 	}
 
-	return added, nil
+	return added, created, nil
 }
 
-// Get returns URL by id from DB.
-func (d *dbKeeper) Get(ctx context.Context, id int) (string, error) {
-	var original string
-	var deleted bool
+// SetRedirect changes the redirect of URL in DB.
+func (d *dbKeeper) SetRedirect(ctx context.Context, id int, r url.Redirect) error {
+	res, err := d.db.ExecContext(
+		ctx,
+		`UPDATE urls SET redirect_code = $1, cache_control = $2 WHERE id = $3;`,
+		r.Code,
+		r.CacheControl,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot update url: %w", err)
+	}
 
-	err := d.db.QueryRowContext(ctx, "SELECT url, deleted FROM urls WHERE id=$1;", id).Scan(&original, &deleted)
+	n, err := res.RowsAffected()
 	if err != nil {
-		return "", fmt.Errorf("cannot find url: %w", err)
+		return fmt.Errorf("cannot update url: %w", err)
+	}
+	if n == 0 {
+		return url.ErrNotFound
+	}
+
+	return nil
+}
+
+// Get returns URL record by id from DB.
+func (d *dbKeeper) Get(ctx context.Context, id int) (*url.Record, error) {
+	var r url.Record
+
+	err := scanRecord(d.db.QueryRowContext(ctx, `SELECT `+urlColumns+` FROM urls WHERE id=$1;`, id), &r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, url.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find url: %w", err)
+	}
+
+	return &r, nil
+}
+
+// FindIDs returns ids of the originals already shortened on the domain in DB.
+func (d *dbKeeper) FindIDs(ctx context.Context, domain string, originals []string) (map[string]int, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, url FROM urls WHERE domain = $1 AND url = ANY($2::text[]);`, domain, originals)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find urls: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	ids := make(map[string]int, len(originals))
+
+	for rows.Next() {
+		var id int
+		var original string
+		if err = rows.Scan(&id, &original); err != nil {
+			return nil, fmt.Errorf("cannot scan url: %w", err)
+		}
+		ids[original] = id
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot find urls: %w", err)
 	}
 
-	if deleted {
-		return "", new(url.ErrURLDeleted)
+	return ids, nil
+}
+
+// GetOwner returns user ID of the URL owner from DB.
+func (d *dbKeeper) GetOwner(ctx context.Context, id int) (string, error) {
+	var userID string
+
+	err := d.db.QueryRowContext(ctx, `SELECT "user" FROM urls WHERE id=$1;`, id).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", url.ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot find url: %w", err)
 	}
 
-	return original, nil
+	return userID, nil
 }
 
-// GetAllByUser returns all URLs and IDs for ine user from DB.
-func (d *dbKeeper) GetAllByUser(ctx context.Context, userID string) (map[string]int, error) {
-	urls := make(map[string]int)
+// GetAllByUser returns all URLs for one user in id order from DB.
+func (d *dbKeeper) GetAllByUser(ctx context.Context, userID string) ([]url.Record, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT `+urlColumns+` FROM urls WHERE "user" = $1 AND deleted = false ORDER BY id;`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find urls: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
 
-	rows, err := d.db.QueryContext(ctx, `SELECT id, url FROM urls WHERE "user" = $1 AND deleted = false;`, userID)
+	return scanRecords(rows)
+}
+
+// GetPageByUser returns up to limit user URLs with id greater than afterID
+// in id order from DB.
+func (d *dbKeeper) GetPageByUser(ctx context.Context, userID string, afterID, limit int) ([]url.Record, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT `+urlColumns+` FROM urls WHERE "user" = $1 AND deleted = false AND id > $2 ORDER BY id LIMIT $3;`,
+		userID,
+		afterID,
+		limit,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find urls: %w", err)
 	}
+	defer closeRows(ctx, d.log, rows)
 
-	var id int
-	var original string
+	return scanRecords(rows)
+}
+
+// scanRecord scans the row of urlColumns to r.
+func scanRecord(row interface{ Scan(dest ...any) error }, r *url.Record) error {
+	return row.Scan(&r.ID, &r.URL, &r.UserID, &r.Deleted, &r.Domain, &r.Redirect.Code, &r.Redirect.CacheControl)
+}
+
+func scanRecords(rows *sql.Rows) ([]url.Record, error) {
+	var records []url.Record
 
 	for rows.Next() {
-		err = rows.Scan(&id, &original)
-		if err != nil {
+		var r url.Record
+		if err := scanRecord(rows, &r); err != nil {
 			return nil, fmt.Errorf("cannot scan values: %w", err)
 		}
 
-		urls[original] = id
+		records = append(records, r)
 	}
 
-	err = rows.Err()
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("db error: %w", err)
 	}
 
-	return urls, nil
+	return records, nil
 }
 
-// DeleteBatch deletes URL batch for each provided user from DB.
-func (d *dbKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) error {
+// DeleteBatch deletes URL batch for each provided user from DB and returns
+// the IDs of the deleted URLs.
+func (d *dbKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) (map[string][]int, error) {
 	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	updStmt, err := tx.PrepareContext(
+		ctx,
+		`WITH deleted AS (
+			UPDATE urls SET deleted = TRUE WHERE "user" = $1 AND id = ANY($2::int[]) AND deleted = FALSE RETURNING id, url
+		)
+		INSERT INTO outbox (type, "user", url_id, url) SELECT $3, $1, id, url FROM deleted RETURNING url_id;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("statement error: %w", err)
+	}
+	defer closeStmt(ctx, d.log, updStmt)
+
+	deleted := make(map[string][]int)
+
+	for userID, IDs := range batch {
+		ids, err := deletedIDs(ctx, d.log, updStmt, userID, IDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			deleted[userID] = ids
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// deletedIDs runs the delete statement for the user and returns the IDs of
+// the deleted URLs.
+func deletedIDs(ctx context.Context, l *zap.Logger, stmt *sql.Stmt, userID string, IDs []int) ([]int, error) {
+	rows, err := stmt.QueryContext(ctx, userID, IDs, url.EventLinkDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+	defer closeRows(ctx, l, rows)
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Export calls fn for all URLs in DB in id order. URLs are read in one
+// repeatable read transaction.
+func (d *dbKeeper) Export(ctx context.Context, fn func(url.Record) error) error {
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
 		return fmt.Errorf("transaction error: %w", err)
 	}
-	defer func() {
-		e := tx.Rollback()
-		if e != nil {
-			log.Println(e)
+	defer rollback(ctx, d.log, tx)
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+urlColumns+` FROM urls ORDER BY id;`)
+	if err != nil {
+		return fmt.Errorf("cannot find urls: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	for rows.Next() {
+		var r url.Record
+		if err = scanRecord(rows, &r); err != nil {
+			return fmt.Errorf("cannot scan values: %w", err)
 		}
-	}()
 
-	updStmt, err := tx.PrepareContext(ctx, `UPDATE urls SET deleted = TRUE WHERE "user" = $1 AND id = ANY($2::int[]);`)
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Import saves records with their ids in DB and moves the id sequence past
+// them. Nothing is saved if any record conflicts with the stored URLs.
+func (d *dbKeeper) Import(ctx context.Context, records []url.Record) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	stmt, err := tx.PrepareContext(
+		ctx,
+		`INSERT INTO urls (`+urlColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING;`,
+	)
 	if err != nil {
 		return fmt.Errorf("statement error: %w", err)
 	}
-	defer func() {
-		e := updStmt.Close()
-		if e != nil {
-			log.Println(e)
+	defer stmt.Close()
+
+	for _, r := range records {
+		res, err := stmt.ExecContext(ctx, r.ID, r.URL, r.UserID, r.Deleted, r.Domain, r.Redirect.Code, r.Redirect.CacheControl)
+		if err != nil {
+			return fmt.Errorf("insert error: %w", err)
 		}
-	}()
 
-	for userID, IDs := range batch {
-		_, err = updStmt.ExecContext(ctx, userID, IDs)
+		n, err := res.RowsAffected()
 		if err != nil {
-			return fmt.Errorf("update error: %w", err)
+			return fmt.Errorf("insert error: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: id %d or URL %s", url.ErrImportConflict, r.ID, r.URL)
 		}
 	}
 
-	err = tx.Commit()
+	maxID := 0
+	for _, r := range records {
+		if r.ID > maxID {
+			maxID = r.ID
+		}
+	}
+
+	if err = advanceSequence(ctx, tx, maxID+1); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	return nil
+}
+
+// NextID returns the id of the next URL saved in DB.
+func (d *dbKeeper) NextID(ctx context.Context) (int, error) {
+	var id int
+
+	err := d.db.QueryRowContext(ctx, nextIDQuery).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("sequence error: %w", err)
+	}
+
+	return id, nil
+}
+
+// SetNextID moves the id sequence of DB forward to id.
+func (d *dbKeeper) SetNextID(ctx context.Context, id int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	if err = advanceSequence(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("transaction commit error: %w", err)
 	}
 
 	return nil
 }
 
+// Snapshot writes the copy of DB to w. The data is read in one repeatable
+// read transaction.
+func (d *dbKeeper) Snapshot(ctx context.Context, w url.SnapshotWriter) error {
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	// The sequence is not transactional, it is read first so that the next
+	// id is past all ids in the snapshot.
+	var nextID int
+	if err = tx.QueryRowContext(ctx, nextIDQuery).Scan(&nextID); err != nil {
+		return fmt.Errorf("sequence error: %w", err)
+	}
+
+	if err = w.WriteNextID(nextID); err != nil {
+		return err
+	}
+
+	if err = d.snapshotURLs(ctx, tx, w); err != nil {
+		return err
+	}
+
+	if err = d.snapshotQuotas(ctx, tx, w); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *dbKeeper) snapshotURLs(ctx context.Context, tx *sql.Tx, w url.SnapshotWriter) error {
+	rows, err := tx.QueryContext(ctx, `SELECT `+urlColumns+` FROM urls ORDER BY id;`)
+	if err != nil {
+		return fmt.Errorf("cannot find urls: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	for rows.Next() {
+		var r url.Record
+		if err = scanRecord(rows, &r); err != nil {
+			return fmt.Errorf("cannot scan values: %w", err)
+		}
+
+		if err = w.WriteRecord(r); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return nil
+}
+
+func (d *dbKeeper) snapshotQuotas(ctx context.Context, tx *sql.Tx, w url.SnapshotWriter) error {
+	rows, err := tx.QueryContext(ctx, `SELECT "user", max_links, max_batch_size, max_delete_ids FROM quotas ORDER BY "user";`)
+	if err != nil {
+		return fmt.Errorf("cannot find quotas: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	for rows.Next() {
+		var userID string
+		var q url.Quota
+		if err = rows.Scan(&userID, &q.MaxLinks, &q.MaxBatchSize, &q.MaxDeleteIDs); err != nil {
+			return fmt.Errorf("cannot scan values: %w", err)
+		}
+
+		if err = w.WriteQuota(userID, q); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	return nil
+}
+
+// Clear removes all URLs, quotas and outbox events from DB.
+func (d *dbKeeper) Clear(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `TRUNCATE urls, quotas, outbox RESTART IDENTITY;`)
+	if err != nil {
+		return fmt.Errorf("cannot clear tables: %w", err)
+	}
+
+	return nil
+}
+
+// advanceSequence moves the URL id sequence forward so that id is the next
+// value. Lower ids are ignored.
+func advanceSequence(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`SELECT setval('`+urlsSequence+`', $1, false) WHERE $1 > (`+nextIDQuery+`);`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("sequence error: %w", err)
+	}
+
+	return nil
+}
+
 // GetStats returns URL and user number for the whole service.
 func (d *dbKeeper) GetStats(ctx context.Context) (urls, users int, err error) {
 	err = d.db.QueryRowContext(ctx, `SELECT COUNT(url) FROM urls WHERE deleted=FALSE GROUP BY url;`).Scan(&urls)
@@ -257,6 +761,104 @@ func (d *dbKeeper) GetStats(ctx context.Context) (urls, users int, err error) {
 	return urls, users, nil
 }
 
+// CountByUser returns the number of active user URLs in DB.
+func (d *dbKeeper) CountByUser(ctx context.Context, userID string) (int, error) {
+	var count int
+
+	err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM urls WHERE "user" = $1 AND deleted = FALSE;`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("cannot count urls: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetQuota returns user quota override from DB or nil if not set.
+func (d *dbKeeper) GetQuota(ctx context.Context, userID string) (*url.Quota, error) {
+	var q url.Quota
+
+	err := d.db.QueryRowContext(
+		ctx,
+		`SELECT max_links, max_batch_size, max_delete_ids FROM quotas WHERE "user" = $1;`,
+		userID,
+	).Scan(&q.MaxLinks, &q.MaxBatchSize, &q.MaxDeleteIDs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find quota: %w", err)
+	}
+
+	return &q, nil
+}
+
+// SetQuota saves user quota override in DB.
+func (d *dbKeeper) SetQuota(ctx context.Context, userID string, q url.Quota) error {
+	_, err := d.db.ExecContext(
+		ctx,
+		`INSERT INTO quotas ("user", max_links, max_batch_size, max_delete_ids) VALUES ($1, $2, $3, $4)
+		ON CONFLICT ("user") DO UPDATE SET max_links = $2, max_batch_size = $3, max_delete_ids = $4;`,
+		userID,
+		q.MaxLinks,
+		q.MaxBatchSize,
+		q.MaxDeleteIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot save quota: %w", err)
+	}
+
+	return nil
+}
+
+// FetchOutbox returns the oldest unpublished events from DB. Returned events
+// are leased for outboxLease, so other instances do not fetch them until the
+// lease expires.
+func (d *dbKeeper) FetchOutbox(ctx context.Context, limit int) ([]url.OutboxEvent, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`UPDATE outbox SET locked_until = now() + $2::interval WHERE id IN (
+			SELECT id FROM outbox WHERE locked_until IS NULL OR locked_until < now()
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		) RETURNING id, type, time, "user", url_id, url;`,
+		limit,
+		outboxLease.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch outbox: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	var events []url.OutboxEvent
+
+	for rows.Next() {
+		var e url.OutboxEvent
+		err = rows.Scan(&e.ID, &e.Type, &e.Time, &e.UserID, &e.URLID, &e.URL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	return events, nil
+}
+
+// AckOutbox removes published events from DB.
+func (d *dbKeeper) AckOutbox(ctx context.Context, ids []int64) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1::bigint[]);`, ids)
+	if err != nil {
+		return fmt.Errorf("cannot ack outbox: %w", err)
+	}
+
+	return nil
+}
+
 // Ping returns error if DB connection is broken.
 func (d *dbKeeper) Ping(ctx context.Context) error {
 	if err := d.db.PingContext(ctx); err != nil {
@@ -268,7 +870,7 @@ func (d *dbKeeper) Ping(ctx context.Context) error {
 
 // Close colses the DB connection and returns error if occurs.
 func (d *dbKeeper) Close(ctx context.Context) error {
-	closed := make(chan error)
+	closed := make(chan error, 1)
 
 	go func() {
 		closed <- d.db.Close()
@@ -277,10 +879,8 @@ func (d *dbKeeper) Close(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			close(closed)
 			return ctx.Err()
 		case err := <-closed:
-			close(closed)
 			if err != nil {
 				return fmt.Errorf("cannot close DB: %w", err)
 			}
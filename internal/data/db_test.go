@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowDriver opens connections that block in Close until release is closed.
+type slowDriver struct {
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (d *slowDriver) Open(string) (driver.Conn, error) {
+	return &slowConn{d: d}, nil
+}
+
+type slowConn struct {
+	d *slowDriver
+}
+
+func (c *slowConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *slowConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *slowConn) Close() error {
+	<-c.d.release
+	close(c.d.closed)
+	return nil
+}
+
+func TestDBCloseExpired(t *testing.T) {
+	d := &slowDriver{release: make(chan struct{}), closed: make(chan struct{})}
+	sql.Register("slow", d)
+
+	db, err := sql.Open("slow", "")
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+
+	keeper := &dbKeeper{db: db}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = keeper.Close(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The pool is closed after Close returned, the result must be
+	// dropped without panic.
+	close(d.release)
+
+	select {
+	case <-d.closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection is not closed")
+	}
+
+	// Let the close goroutine send the result.
+	time.Sleep(10 * time.Millisecond)
+}
@@ -1,17 +1,36 @@
 // Package data is the data storage abstraction for URLs.
 package data
 
-import "github.com/ruskiiamov/shortener/internal/url"
+import (
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
+)
 
 // NewKeeper returns object that implements url.DataKeeper interface.
 //
 // If databaseDSN provided, NewKeeper returns DB implementation.
 // Otherwise NewKeeper returns in-memory implementation with dumps
-// to filePath.
-func NewKeeper(databaseDSN, filePath string) (url.DataKeeper, error) {
+// to filePath. l logs the storage errors, nil discards them.
+func NewKeeper(databaseDSN, filePath string, l *zap.Logger) (url.DataKeeper, error) {
 	if databaseDSN != "" {
-		return newDBKeeper(databaseDSN)
+		return newDBKeeper(databaseDSN, l)
 	}
 
-	return newMemKeeper(filePath)
+	return newMemKeeper(filePath, l)
+}
+
+// Backend names.
+const (
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+// Backend returns the name of the data storage NewKeeper returns for
+// databaseDSN.
+func Backend(databaseDSN string) string {
+	if databaseDSN != "" {
+		return BackendPostgres
+	}
+
+	return BackendMemory
 }
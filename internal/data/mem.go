@@ -6,12 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ruskiiamov/shortener/internal/logger"
 	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
 )
 
 const (
@@ -23,25 +26,58 @@ type memURL struct {
 	Original string `json:"original"`
 	User     string `json:"user"`
 	Deleted  bool   `json:"deleted"`
+	Domain   string `json:"domain,omitempty"`
+
+	url.Redirect
+}
+
+func (u memURL) record(id int) url.Record {
+	return url.Record{ID: id, URL: u.Original, UserID: u.User, Deleted: u.Deleted, Domain: u.Domain, Redirect: u.Redirect}
 }
 
 type urlData struct {
-	URLs   map[int]memURL `json:"urls"`
-	NextID int            `json:"next_id"`
+	URLs   map[int]memURL       `json:"urls"`
+	NextID int                  `json:"next_id"`
+	Quotas map[string]url.Quota `json:"quotas"`
+
+	// Outbox is saved to the file together with URLs it describes.
+	Outbox       []url.OutboxEvent `json:"outbox"`
+	NextOutboxID int64             `json:"next_outbox_id"`
 }
 
 type memKeeper struct {
 	filePath string
+	log      *zap.Logger
 	data     urlData
 	mu       sync.RWMutex
+	onSave   atomic.Pointer[func(d time.Duration, size int, err error)]
+
+	// saved is the result of the last file save.
+	saved atomic.Pointer[saveResult]
+
+	// saveMu serializes the file saves.
+	saveMu sync.Mutex
+
+	// stop stops the periodic file save.
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type saveResult struct {
+	time time.Time
+	err  error
 }
 
-func newMemKeeper(filePath string) (m *memKeeper, err error) {
+func newMemKeeper(filePath string, l *zap.Logger) (m *memKeeper, err error) {
+	l = logger.OrNop(l)
+
 	if filePath == "" {
 		m = &memKeeper{
+			log: l,
 			data: urlData{
 				URLs:   make(map[int]memURL),
 				NextID: defaultNextID,
+				Quotas: make(map[string]url.Quota),
 			},
 		}
 		return m, nil
@@ -51,12 +87,7 @@ func newMemKeeper(filePath string) (m *memKeeper, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot open file: %w", err)
 	}
-	defer func() {
-		e := file.Close()
-		if e != nil {
-			log.Println(e)
-		}
-	}()
+	defer closeFile(context.Background(), l, file)
 
 	fileData, err := io.ReadAll(file)
 	if err != nil {
@@ -66,11 +97,14 @@ func newMemKeeper(filePath string) (m *memKeeper, err error) {
 	if len(fileData) == 0 {
 		m = &memKeeper{
 			filePath: filePath,
+			log:      l,
 			data: urlData{
 				URLs:   make(map[int]memURL),
 				NextID: defaultNextID,
+				Quotas: make(map[string]url.Quota),
 			},
 		}
+		startPeriodicFileSave(m)
 		return m, nil
 	}
 
@@ -80,8 +114,13 @@ func newMemKeeper(filePath string) (m *memKeeper, err error) {
 		return nil, fmt.Errorf("cannot parse file data: %w", err)
 	}
 
+	if data.Quotas == nil {
+		data.Quotas = make(map[string]url.Quota)
+	}
+
 	m = &memKeeper{
 		filePath: filePath,
+		log:      l,
 		data:     data,
 	}
 
@@ -95,21 +134,32 @@ func startPeriodicFileSave(m *memKeeper) {
 		return
 	}
 
+	m.saved.Store(&saveResult{time: time.Now()})
+	m.stop = make(chan struct{})
+
 	t := time.NewTimer(fileSavePeriod)
 
 	go func() {
-		for range t.C {
-			err := m.saveFile()
-			if err != nil {
-				log.Println("keeper file save error", err)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-t.C:
+				err := m.saveFile()
+				if err != nil {
+					m.log.Error("keeper file save error", zap.String("file", m.filePath), zap.Error(err))
+				}
+				t.Reset(fileSavePeriod)
 			}
-			t.Reset(fileSavePeriod)
 		}
 	}()
 }
 
-// Add saves URL for user in memory storage and returns URL id.
-func (m *memKeeper) Add(ctx context.Context, userID, original string) (int, error) {
+// Add saves URL for user on the domain with the redirect in memory storage
+// and returns URL id.
+func (m *memKeeper) Add(ctx context.Context, userID, domain, original string, r url.Redirect) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -119,7 +169,7 @@ func (m *memKeeper) Add(ctx context.Context, userID, original string) (int, erro
 		return 0, ctx.Err()
 	}
 
-	matches := m.findMatches([]string{original})
+	matches := m.findMatches(domain, []string{original})
 	if len(matches) != 0 {
 		id := matches[original]
 		return 0, url.NewErrURLDuplicate(id, original)
@@ -130,25 +180,52 @@ func (m *memKeeper) Add(ctx context.Context, userID, original string) (int, erro
 	m.data.URLs[id] = memURL{
 		Original: original,
 		User:     userID,
+		Domain:   domain,
+		Redirect: r,
 	}
+	m.addOutbox(url.EventLinkCreated, userID, id, original)
 
 	return id, nil
 }
 
-// AddBatch saves URL batch for user in memory storage and returns URL IDs.
-func (m *memKeeper) AddBatch(ctx context.Context, userID string, originals []string) (map[string]int, error) {
+// SetRedirect changes the redirect of URL in memory storage.
+func (m *memKeeper) SetRedirect(ctx context.Context, id int, r url.Redirect) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	select {
 	default:
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return ctx.Err()
+	}
+
+	mURL, ok := m.data.URLs[id]
+	if !ok {
+		return url.ErrNotFound
+	}
+
+	mURL.Redirect = r
+	m.data.URLs[id] = mURL
+
+	return nil
+}
+
+// AddBatch saves URL batch for user on the domain in memory storage and
+// returns URL IDs and IDs of the new URLs.
+func (m *memKeeper) AddBatch(ctx context.Context, userID, domain string, originals []string) (map[string]int, []int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
 	}
 
 	added := make(map[string]int, len(originals))
+	var created []int
 
-	matches := m.findMatches(originals)
+	matches := m.findMatches(domain, originals)
 
 	for _, original := range originals {
 		if id, ok := matches[original]; ok {
@@ -160,15 +237,39 @@ func (m *memKeeper) AddBatch(ctx context.Context, userID string, originals []str
 		m.data.URLs[id] = memURL{
 			Original: original,
 			User:     userID,
+			Domain:   domain,
 		}
+		m.addOutbox(url.EventLinkCreated, userID, id, original)
 		added[original] = id
+		created = append(created, id)
 	}
 
-	return added, nil
+	return added, created, nil
 }
 
-// Get returns URL by id from memory storage.
-func (m *memKeeper) Get(ctx context.Context, id int) (string, error) {
+// Get returns URL record by id from memory storage.
+func (m *memKeeper) Get(ctx context.Context, id int) (*url.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	mURL, ok := m.data.URLs[id]
+	if !ok {
+		return nil, url.ErrNotFound
+	}
+
+	r := mURL.record(id)
+
+	return &r, nil
+}
+
+// GetOwner returns user ID of the URL owner from memory storage.
+func (m *memKeeper) GetOwner(ctx context.Context, id int) (string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -180,18 +281,29 @@ func (m *memKeeper) Get(ctx context.Context, id int) (string, error) {
 
 	mURL, ok := m.data.URLs[id]
 	if !ok {
-		return "", errors.New("wrong id")
+		return "", url.ErrNotFound
 	}
 
-	if mURL.Deleted {
-		return "", new(url.ErrURLDeleted)
+	return mURL.User, nil
+}
+
+// GetAllByUser returns all user URLs in id order from memory storage.
+func (m *memKeeper) GetAllByUser(ctx context.Context, userID string) ([]url.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 
-	return mURL.Original, nil
+	return m.userURLs(userID, 0, 0), nil
 }
 
-// GetAllByUser returns all URL IDs for user from memory storage.
-func (m *memKeeper) GetAllByUser(ctx context.Context, userID string) (map[string]int, error) {
+// GetPageByUser returns up to limit user URLs with id greater than afterID
+// in id order from memory storage.
+func (m *memKeeper) GetPageByUser(ctx context.Context, userID string, afterID, limit int) ([]url.Record, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -201,28 +313,47 @@ func (m *memKeeper) GetAllByUser(ctx context.Context, userID string) (map[string
 		return nil, ctx.Err()
 	}
 
-	urls := make(map[string]int)
+	return m.userURLs(userID, afterID, limit), nil
+}
+
+// userURLs returns up to limit active user URLs with id greater than afterID
+// in id order, zero limit means all of them.
+func (m *memKeeper) userURLs(userID string, afterID, limit int) []url.Record {
+	var ids []int
 
 	for id, mURL := range m.data.URLs {
-		if mURL.User == userID && !mURL.Deleted {
-			urls[mURL.Original] = id
+		if id > afterID && mURL.User == userID && !mURL.Deleted {
+			ids = append(ids, id)
 		}
 	}
 
-	return urls, nil
+	sort.Ints(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	urls := make([]url.Record, 0, len(ids))
+	for _, id := range ids {
+		urls = append(urls, m.data.URLs[id].record(id))
+	}
+
+	return urls
 }
 
-// DeleteBatch deletes URL batch from memory storage.
-func (m *memKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) error {
+// DeleteBatch deletes URL batch from memory storage and returns the IDs of
+// the deleted URLs.
+func (m *memKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) (map[string][]int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	select {
 	default:
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	}
 
+	deleted := make(map[string][]int)
+
 	for userID, IDs := range batch {
 		for _, id := range IDs {
 			mURL, ok := m.data.URLs[id]
@@ -230,14 +361,16 @@ func (m *memKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) err
 				continue
 			}
 
-			if mURL.User == userID {
+			if mURL.User == userID && !mURL.Deleted {
 				mURL.Deleted = true
 				m.data.URLs[id] = mURL
+				m.addOutbox(url.EventLinkDeleted, userID, id, mURL.Original)
+				deleted[userID] = append(deleted[userID], id)
 			}
 		}
 	}
 
-	return nil
+	return deleted, nil
 }
 
 // GetStats returns URL and user number for the whole service.
@@ -265,6 +398,296 @@ func (m *memKeeper) GetStats(ctx context.Context) (urls, users int, err error) {
 	return len(urlSet), len(userSet), nil
 }
 
+// FindIDs returns ids of the originals already shortened on the domain in
+// memory storage.
+func (m *memKeeper) FindIDs(ctx context.Context, domain string, originals []string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return m.findMatches(domain, originals), nil
+}
+
+// CountByUser returns the number of active user URLs in memory storage.
+func (m *memKeeper) CountByUser(ctx context.Context, userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	var count int
+
+	for _, mURL := range m.data.URLs {
+		if mURL.User == userID && !mURL.Deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetQuota returns user quota override from memory storage or nil if not set.
+func (m *memKeeper) GetQuota(ctx context.Context, userID string) (*url.Quota, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	q, ok := m.data.Quotas[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &q, nil
+}
+
+// SetQuota saves user quota override in memory storage.
+func (m *memKeeper) SetQuota(ctx context.Context, userID string, q url.Quota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if m.data.Quotas == nil {
+		m.data.Quotas = make(map[string]url.Quota)
+	}
+
+	m.data.Quotas[userID] = q
+
+	return nil
+}
+
+// FetchOutbox returns the oldest unpublished events from memory storage.
+func (m *memKeeper) FetchOutbox(ctx context.Context, limit int) ([]url.OutboxEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	n := len(m.data.Outbox)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	return append([]url.OutboxEvent(nil), m.data.Outbox[:n]...), nil
+}
+
+// AckOutbox removes published events from memory storage.
+func (m *memKeeper) AckOutbox(ctx context.Context, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	acked := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		acked[id] = true
+	}
+
+	outbox := m.data.Outbox[:0]
+	for _, e := range m.data.Outbox {
+		if !acked[e.ID] {
+			outbox = append(outbox, e)
+		}
+	}
+	m.data.Outbox = outbox
+
+	return nil
+}
+
+// Export calls fn for all URLs in memory storage in id order.
+func (m *memKeeper) Export(ctx context.Context, fn func(url.Record) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]int, 0, len(m.data.URLs))
+	for id := range m.data.URLs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		select {
+		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := fn(m.data.URLs[id].record(id)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import saves records with their ids in memory storage. Nothing is saved
+// if any record conflicts with the stored URLs.
+func (m *memKeeper) Import(ctx context.Context, records []url.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	originals := make(map[string][]string)
+	ids := make(map[int]bool, len(records))
+	for _, r := range records {
+		if _, ok := m.data.URLs[r.ID]; ok || ids[r.ID] || r.ID < defaultNextID {
+			return fmt.Errorf("%w: id %d", url.ErrImportConflict, r.ID)
+		}
+		ids[r.ID] = true
+		originals[r.Domain] = append(originals[r.Domain], r.URL)
+	}
+
+	for domain := range originals {
+		for original := range m.findMatches(domain, originals[domain]) {
+			return fmt.Errorf("%w: URL %s", url.ErrImportConflict, original)
+		}
+	}
+
+	for _, r := range records {
+		m.data.URLs[r.ID] = memURL{Original: r.URL, User: r.UserID, Deleted: r.Deleted, Domain: r.Domain, Redirect: r.Redirect}
+		if r.ID >= m.data.NextID {
+			m.data.NextID = r.ID + 1
+		}
+	}
+
+	return nil
+}
+
+// NextID returns the id of the next URL saved in memory storage.
+func (m *memKeeper) NextID(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	return m.data.NextID, nil
+}
+
+// SetNextID moves the id sequence of memory storage forward to id.
+func (m *memKeeper) SetNextID(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if id > m.data.NextID {
+		m.data.NextID = id
+	}
+
+	return nil
+}
+
+// Snapshot writes the copy of memory storage to w. The data is copied
+// under the read lock and written after it is released.
+func (m *memKeeper) Snapshot(ctx context.Context, w url.SnapshotWriter) error {
+	m.mu.RLock()
+
+	nextID := m.data.NextID
+
+	records := make([]url.Record, 0, len(m.data.URLs))
+	for id, mURL := range m.data.URLs {
+		records = append(records, mURL.record(id))
+	}
+
+	quotas := make(map[string]url.Quota, len(m.data.Quotas))
+	for userID, q := range m.data.Quotas {
+		quotas[userID] = q
+	}
+
+	m.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	userIDs := make([]string, 0, len(quotas))
+	for userID := range quotas {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+
+	if err := w.WriteNextID(nextID); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		select {
+		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := w.WriteRecord(r); err != nil {
+			return err
+		}
+	}
+
+	for _, userID := range userIDs {
+		if err := w.WriteQuota(userID, quotas[userID]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clear removes all data from memory storage.
+func (m *memKeeper) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.data = urlData{
+		URLs:   make(map[int]memURL),
+		NextID: defaultNextID,
+		Quotas: make(map[string]url.Quota),
+	}
+
+	return nil
+}
+
 // Ping always returns error because it is not a DB connection.
 func (m *memKeeper) Ping(ctx context.Context) error {
 	select {
@@ -276,9 +699,15 @@ func (m *memKeeper) Ping(ctx context.Context) error {
 	return errors.New("memory data keeper is used")
 }
 
-// Close dumps all data to the file.
+// Close stops the periodic file save and dumps all data to the file.
 func (m *memKeeper) Close(ctx context.Context) error {
-	closed := make(chan error)
+	m.stopOnce.Do(func() {
+		if m.stop != nil {
+			close(m.stop)
+		}
+	})
+
+	closed := make(chan error, 1)
 
 	go func() {
 		closed <- m.saveFile()
@@ -304,41 +733,85 @@ func (m *memKeeper) getNextID() int {
 	return id
 }
 
+func (m *memKeeper) addOutbox(eventType, userID string, id int, original string) {
+	if m.data.NextOutboxID == 0 {
+		m.data.NextOutboxID = 1
+	}
+
+	m.data.Outbox = append(m.data.Outbox, url.OutboxEvent{
+		ID:     m.data.NextOutboxID,
+		Type:   eventType,
+		Time:   time.Now().UTC(),
+		UserID: userID,
+		URLID:  id,
+		URL:    original,
+	})
+	m.data.NextOutboxID++
+}
+
+// OnSave sets fn called after every save of the file storage with the save
+// duration and the file size.
+func (m *memKeeper) OnSave(fn func(d time.Duration, size int, err error)) {
+	m.onSave.Store(&fn)
+}
+
 func (m *memKeeper) saveFile() error {
 	if m.filePath == "" {
 		return nil
 	}
 
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	start := time.Now()
+	size, err := m.writeFile()
+	m.saved.Store(&saveResult{time: time.Now(), err: err})
+
+	if fn := m.onSave.Load(); fn != nil {
+		(*fn)(time.Since(start), size, err)
+	}
+
+	return err
+}
+
+func (m *memKeeper) writeFile() (int, error) {
 	file, err := os.OpenFile(m.filePath, os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		return fmt.Errorf("cannot open file: %w", err)
+		return 0, fmt.Errorf("cannot open file: %w", err)
 	}
-	defer func() {
-		e := file.Close()
-		if e != nil {
-			log.Println(e)
-		}
-	}()
+	defer closeFile(context.Background(), m.log, file)
 
+	m.mu.RLock()
 	fileData, err := json.Marshal(m.data)
+	m.mu.RUnlock()
 	if err != nil {
-		return fmt.Errorf("JSON encoding error: %w", err)
+		return 0, fmt.Errorf("JSON encoding error: %w", err)
 	}
 
 	_, err = file.Write(fileData)
 	if err != nil {
-		return fmt.Errorf("cannot save file: %w", err)
+		return 0, fmt.Errorf("cannot save file: %w", err)
 	}
 
-	log.Println("keeper file saved")
+	m.log.Debug("keeper file saved", zap.String("file", m.filePath), zap.Int("size", len(fileData)))
 
-	return nil
+	return len(fileData), nil
+}
+
+func closeFile(ctx context.Context, l *zap.Logger, file *os.File) {
+	if err := file.Close(); err != nil {
+		logger.Request(ctx, l).Warn("file close error", zap.String("file", file.Name()), zap.Error(err))
+	}
 }
 
-func (m *memKeeper) findMatches(originals []string) map[string]int {
+// findMatches returns ids of the originals already shortened on the domain.
+func (m *memKeeper) findMatches(domain string, originals []string) map[string]int {
 	matches := make(map[string]int, len(originals))
 
 	for id, mURL := range m.data.URLs {
+		if mURL.Domain != domain {
+			continue
+		}
 		for _, original := range originals {
 			if mURL.Original == original {
 				matches[original] = id
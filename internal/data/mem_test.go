@@ -2,17 +2,20 @@ package data
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ruskiiamov/shortener/internal/url"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const fileName = "test_file_storage"
 
 func init() {
-	k, _ := newMemKeeper(fileName)
+	k, _ := newMemKeeper(fileName, nil)
 	k.Close(context.Background())
 	os.Remove(fileName)
 }
@@ -48,6 +51,7 @@ func TestMemAdd(t *testing.T) {
 		name     string
 		original string
 		userID   string
+		domain   string
 		id       int
 		wantErr  bool
 		err      error
@@ -66,11 +70,27 @@ func TestMemAdd(t *testing.T) {
 			id:       1,
 			wantErr:  true,
 		},
+		{
+			name:     "other domain",
+			original: "http://shortener.com",
+			userID:   "1770aae6-caaf-4578-b27e-ffa967927a1b",
+			domain:   "go.brand.com",
+			id:       5,
+			wantErr:  false,
+		},
+		{
+			name:     "duplicate on domain",
+			original: "http://shortener.com",
+			userID:   "c7cbe16d-034e-40b9-a2a5-e936851c4282",
+			domain:   "go.brand.com",
+			id:       5,
+			wantErr:  true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			id, err := keeper.Add(context.Background(), tt.userID, tt.original)
+			id, err := keeper.Add(context.Background(), tt.userID, tt.domain, tt.original, url.Redirect{})
 
 			if tt.wantErr {
 				var errDupl *url.ErrURLDuplicate
@@ -92,7 +112,7 @@ func BenchmarkMemAdd(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		keeper.Add(context.Background(), "some_user_id", "http://shortener777.com")
+		keeper.Add(context.Background(), "some_user_id", "", "http://shortener777.com", url.Redirect{})
 	}
 }
 
@@ -104,6 +124,7 @@ func TestMemAddBatch(t *testing.T) {
 		userID    string
 		originals []string
 		added     map[string]int
+		created   []int
 	}{
 		{
 			name:      "ok",
@@ -113,15 +134,17 @@ func TestMemAddBatch(t *testing.T) {
 				"http://shortener.com":       1,
 				"http://shortener.com/other": 4,
 			},
+			created: []int{4},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			added, err := keeper.AddBatch(context.Background(), tt.userID, tt.originals)
+			added, created, err := keeper.AddBatch(context.Background(), tt.userID, "", tt.originals)
 
 			assert.NoError(t, err)
 			assert.Equal(t, tt.added, added)
+			assert.Equal(t, tt.created, created)
 		})
 	}
 }
@@ -159,7 +182,7 @@ func TestMemGet(t *testing.T) {
 			}
 
 			assert.NoError(t, err)
-			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want, got.URL)
 		})
 	}
 }
@@ -174,19 +197,46 @@ func BenchmarkMemGet(b *testing.B) {
 	}
 }
 
+func TestMemRedirect(t *testing.T) {
+	keeper := getKeeper()
+	ctx := context.Background()
+
+	redirect := url.Redirect{Code: http.StatusMovedPermanently, CacheControl: "max-age=86400"}
+
+	id, err := keeper.Add(ctx, "c7cbe16d-034e-40b9-a2a5-e936851c4282", "", "http://shortener.com/seo", redirect)
+	require.NoError(t, err)
+
+	got, err := keeper.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, redirect, got.Redirect)
+
+	redirect = url.Redirect{Code: http.StatusFound, CacheControl: "no-store"}
+	require.NoError(t, keeper.SetRedirect(ctx, id, redirect))
+
+	got, err = keeper.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, redirect, got.Redirect)
+	assert.Equal(t, "http://shortener.com/seo", got.URL)
+
+	assert.ErrorIs(t, keeper.SetRedirect(ctx, 100, redirect), url.ErrNotFound)
+}
+
 func TestMemGetAllByUser(t *testing.T) {
 	keeper := getKeeper()
 
 	tests := []struct {
 		name    string
 		userID  string
-		want    map[string]int
+		want    []url.Record
 		wantErr bool
 	}{
 		{
-			name:    "ok",
-			userID:  "b01ad148-d4da-4b08-9c75-9eb66899119f",
-			want:    map[string]int{"http://shortener.com/info": 2, "http://shortener.com/stat": 3},
+			name:   "ok",
+			userID: "b01ad148-d4da-4b08-9c75-9eb66899119f",
+			want: []url.Record{
+				{ID: 2, URL: "http://shortener.com/info", UserID: "b01ad148-d4da-4b08-9c75-9eb66899119f"},
+				{ID: 3, URL: "http://shortener.com/stat", UserID: "b01ad148-d4da-4b08-9c75-9eb66899119f"},
+			},
 			wantErr: false,
 		},
 	}
@@ -204,11 +254,18 @@ func TestMemGetAllByUser(t *testing.T) {
 func TestMemDeleteBatch(t *testing.T) {
 	keeper := getKeeper()
 
-	batch := map[string][]int{"b01ad148-d4da-4b08-9c75-9eb66899119f": {2, 3}}
+	userID := "b01ad148-d4da-4b08-9c75-9eb66899119f"
+	batch := map[string][]int{userID: {1, 2, 3, 99}}
+
+	deleted, err := keeper.DeleteBatch(context.Background(), batch)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]int{userID: {2, 3}}, deleted)
 
-	err := keeper.DeleteBatch(context.Background(), batch)
+	deleted, err = keeper.DeleteBatch(context.Background(), batch)
 
 	assert.NoError(t, err)
+	assert.Empty(t, deleted)
 }
 
 func TestMemGetStats(t *testing.T) {
@@ -228,3 +285,116 @@ func TestMemPing(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestMemQuota(t *testing.T) {
+	keeper := getKeeper()
+	userID := "b01ad148-d4da-4b08-9c75-9eb66899119f"
+
+	q, err := keeper.GetQuota(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Nil(t, q)
+
+	err = keeper.SetQuota(context.Background(), userID, url.Quota{MaxLinks: 5})
+	assert.NoError(t, err)
+
+	q, err = keeper.GetQuota(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, &url.Quota{MaxLinks: 5}, q)
+
+	count, err := keeper.CountByUser(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemFindIDs(t *testing.T) {
+	keeper := getKeeper()
+
+	ids, err := keeper.FindIDs(context.Background(), "", []string{"http://shortener.com/info", "http://shortener.com/new"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"http://shortener.com/info": 2}, ids)
+
+	ids, err = keeper.FindIDs(context.Background(), "other.com", []string{"http://shortener.com/info"})
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestMemOutbox(t *testing.T) {
+	keeper := getKeeper()
+	userID := "b01ad148-d4da-4b08-9c75-9eb66899119f"
+
+	_, _, err := keeper.AddBatch(context.Background(), userID, "", []string{"http://shortener.com/info", "http://shortener.com/new"})
+	assert.NoError(t, err)
+
+	batch := map[string][]int{userID: {2}}
+	_, err = keeper.DeleteBatch(context.Background(), batch)
+	assert.NoError(t, err)
+	_, err = keeper.DeleteBatch(context.Background(), batch)
+	assert.NoError(t, err)
+
+	events, err := keeper.FetchOutbox(context.Background(), 0)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, url.EventLinkCreated, events[0].Type)
+		assert.Equal(t, "http://shortener.com/new", events[0].URL)
+		assert.Equal(t, url.EventLinkDeleted, events[1].Type)
+		assert.Equal(t, 2, events[1].URLID)
+	}
+
+	assert.NoError(t, keeper.AckOutbox(context.Background(), []int64{events[0].ID}))
+
+	events, err = keeper.FetchOutbox(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestMemExportImport(t *testing.T) {
+	src := getKeeper()
+	src.data.URLs[2] = memURL{Original: "http://shortener.com/info", User: "b01ad148-d4da-4b08-9c75-9eb66899119f", Deleted: true}
+
+	var records []url.Record
+	err := src.Export(context.Background(), func(r url.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, 1, records[0].ID)
+		assert.True(t, records[1].Deleted)
+	}
+
+	dst, err := newMemKeeper("", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dst.Import(context.Background(), records))
+	assert.Equal(t, src.data.URLs, dst.data.URLs)
+	assert.Equal(t, 4, dst.data.NextID)
+	assert.Empty(t, dst.data.Outbox)
+
+	err = dst.Import(context.Background(), records[:1])
+	assert.ErrorIs(t, err, url.ErrImportConflict)
+
+	err = dst.Import(context.Background(), []url.Record{{ID: 10, URL: "http://shortener.com", UserID: "c7cbe16d"}})
+	assert.ErrorIs(t, err, url.ErrImportConflict)
+	assert.Len(t, dst.data.URLs, 3)
+}
+
+func TestCheckSnapshot(t *testing.T) {
+	file := t.TempDir() + "/storage"
+
+	k, err := newMemKeeper(file, nil)
+	assert.NoError(t, err)
+	assert.Len(t, Checks(k), 2)
+	assert.NoError(t, k.checkSnapshot(context.Background()))
+
+	k.saved.Store(&saveResult{time: time.Now().Add(-maxSaveDelay - time.Second)})
+	assert.ErrorContains(t, k.checkSnapshot(context.Background()), "is not saved for")
+
+	assert.NoError(t, os.Remove(file))
+	assert.NoError(t, os.Mkdir(file, 0755))
+	assert.Error(t, k.saveFile())
+	assert.ErrorContains(t, k.checkSnapshot(context.Background()), "last file save failed")
+
+	memOnly, err := newMemKeeper("", nil)
+	assert.NoError(t, err)
+	assert.Len(t, Checks(memOnly), 1)
+}
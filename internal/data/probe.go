@@ -0,0 +1,76 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/probe"
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// Readiness check names.
+const (
+	CheckKeeper   = "keeper"
+	CheckSchema   = "schema"
+	CheckSnapshot = "snapshot"
+)
+
+// maxSaveDelay is the age of the last file save the snapshot check accepts.
+const maxSaveDelay = 3 * fileSavePeriod
+
+// Checks returns the readiness checks of k returned by NewKeeper: the
+// connection and the schema version for DB, the periodic file save for the
+// memory storage with the file.
+func Checks(k url.DataKeeper) []probe.Check {
+	switch k := k.(type) {
+	case *dbKeeper:
+		return []probe.Check{
+			{Name: CheckKeeper, Func: k.Ping},
+			{Name: CheckSchema, Func: k.checkSchema},
+		}
+	case *memKeeper:
+		checks := []probe.Check{{Name: CheckKeeper, Func: checkMemory}}
+		if k.filePath != "" {
+			checks = append(checks, probe.Check{Name: CheckSnapshot, Func: k.checkSnapshot})
+		}
+		return checks
+	default:
+		return nil
+	}
+}
+
+func (d *dbKeeper) checkSchema(ctx context.Context) error {
+	version, err := getSchemaVersion(ctx, d.db)
+	if err != nil {
+		return fmt.Errorf("schema version error: %w", err)
+	}
+
+	if version != schemaVersion {
+		return fmt.Errorf("schema version %d, want %d", version, schemaVersion)
+	}
+
+	return nil
+}
+
+// checkMemory passes while ctx is alive, the memory storage is in-process.
+func checkMemory(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *memKeeper) checkSnapshot(ctx context.Context) error {
+	saved := m.saved.Load()
+	if saved == nil {
+		return fmt.Errorf("file %s is not saved", m.filePath)
+	}
+
+	if saved.err != nil {
+		return fmt.Errorf("last file save failed: %w", saved.err)
+	}
+
+	if age := time.Since(saved.time); age > maxSaveDelay {
+		return fmt.Errorf("file %s is not saved for %s", m.filePath, age.Round(time.Second))
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// limitSweepEvery is the number of takes between the sweeps of the idle
+// buckets.
+const limitSweepEvery = 1024
+
+type dbLimitBackend struct {
+	db    *sql.DB
+	log   *zap.Logger
+	takes atomic.Int64
+}
+
+// NewLimitBackend returns object that implements ratelimit.Backend interface.
+//
+// If databaseDSN provided, NewLimitBackend returns DB implementation shared
+// by all service instances. Otherwise it returns in-memory implementation.
+func NewLimitBackend(databaseDSN string, l *zap.Logger) (ratelimit.Backend, error) {
+	if databaseDSN == "" {
+		return ratelimit.NewMemBackend(), nil
+	}
+
+	return newDBLimitBackend(databaseDSN, l)
+}
+
+func newDBLimitBackend(dsn string, l *zap.Logger) (*dbLimitBackend, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS rate_limits (
+			key varchar PRIMARY KEY,
+			tokens double precision NOT NULL,
+			updated_at timestamptz NOT NULL
+		);`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rate limits table: %w", err)
+	}
+
+	return &dbLimitBackend{db: db, log: logger.OrNop(l)}, nil
+}
+
+// Close closes the DB connection pool.
+func (d *dbLimitBackend) Close() error {
+	return d.db.Close()
+}
+
+// Take takes one token from the bucket stored in DB.
+func (d *dbLimitBackend) Take(ctx context.Context, key string, rule ratelimit.Rule, now time.Time) (*ratelimit.Result, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("transaction error: %w", err)
+	}
+	defer rollback(ctx, d.log, tx)
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING;`,
+		key,
+		float64(rule.Burst),
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert bucket: %w", err)
+	}
+
+	var tokens float64
+	var updated time.Time
+
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE;`,
+		key,
+	).Scan(&tokens, &updated)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find bucket: %w", err)
+	}
+
+	tokens, res := ratelimit.Refill(tokens, updated, rule, now)
+
+	_, err = tx.ExecContext(ctx, `UPDATE rate_limits SET tokens = $2, updated_at = $3 WHERE key = $1;`, key, tokens, now)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update bucket: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("transaction commit error: %w", err)
+	}
+
+	if d.takes.Add(1)%limitSweepEvery == 0 {
+		d.sweep(ctx, now)
+	}
+
+	return res, nil
+}
+
+// sweep removes the buckets idle longer than ratelimit.IdleTTL. Errors are
+// only logged, the next sweep removes the rest.
+func (d *dbLimitBackend) sweep(ctx context.Context, now time.Time) {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE updated_at < $1;`, now.Add(-ratelimit.IdleTTL))
+	if err != nil {
+		d.log.Error("rate limits sweep error", zap.Error(err))
+	}
+}
@@ -0,0 +1,426 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/webhook"
+	"go.uber.org/zap"
+)
+
+type dbWebhookStore struct {
+	db  *sql.DB
+	log *zap.Logger
+}
+
+// webhookFileSuffix is appended to the file storage path for the webhook
+// endpoints file.
+const webhookFileSuffix = ".webhooks"
+
+// NewWebhookStore returns object that implements webhook.Store interface.
+//
+// If databaseDSN provided, NewWebhookStore returns DB implementation.
+// If fileStoragePath provided, it returns in-memory implementation with the
+// endpoints saved in the file next to the file storage. Otherwise it returns
+// in-memory implementation.
+func NewWebhookStore(databaseDSN, fileStoragePath string, l *zap.Logger) (webhook.Store, error) {
+	if databaseDSN != "" {
+		return newDBWebhookStore(databaseDSN, l)
+	}
+
+	if fileStoragePath != "" {
+		return newFileWebhookStore(fileStoragePath+webhookFileSuffix, l)
+	}
+
+	return webhook.NewMemStore(), nil
+}
+
+// fileWebhookStore keeps the endpoints by user ID in the JSON file rewritten
+// on every change. Delivery log and dead letters are kept in memory.
+type fileWebhookStore struct {
+	webhook.Store
+
+	filePath  string
+	endpoints map[string][]webhook.Endpoint
+	log       *zap.Logger
+	mu        sync.RWMutex
+}
+
+func newFileWebhookStore(filePath string, l *zap.Logger) (*fileWebhookStore, error) {
+	f := &fileWebhookStore{
+		Store:     webhook.NewMemStore(),
+		filePath:  filePath,
+		endpoints: make(map[string][]webhook.Endpoint),
+		log:       logger.OrNop(l),
+	}
+
+	fileData, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read webhooks file: %w", err)
+	}
+
+	if len(fileData) == 0 {
+		return f, nil
+	}
+
+	err = json.Unmarshal(fileData, &f.endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse webhooks file: %w", err)
+	}
+
+	for userID, endpoints := range f.endpoints {
+		for i := range endpoints {
+			endpoints[i].UserID = userID
+		}
+	}
+
+	return f, nil
+}
+
+// AddEndpoint saves endpoint in the file.
+func (f *fileWebhookStore) AddEndpoint(ctx context.Context, e webhook.Endpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoints := f.endpoints[e.UserID]
+
+	return f.update(e.UserID, append(endpoints[:len(endpoints):len(endpoints)], e))
+}
+
+// GetEndpoints returns all user endpoints.
+func (f *fileWebhookStore) GetEndpoints(ctx context.Context, userID string) ([]webhook.Endpoint, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return append([]webhook.Endpoint(nil), f.endpoints[userID]...), nil
+}
+
+// DeleteEndpoint removes user endpoint from the file.
+func (f *fileWebhookStore) DeleteEndpoint(ctx context.Context, userID, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoints := f.endpoints[userID]
+	for i, e := range endpoints {
+		if e.ID == id {
+			return f.update(userID, append(endpoints[:i:i], endpoints[i+1:]...))
+		}
+	}
+
+	return webhook.ErrNotFound
+}
+
+// Close implements webhook.Store interface, the file is saved on every
+// change.
+func (f *fileWebhookStore) Close() error {
+	return nil
+}
+
+// update saves the file with the new user endpoints and keeps them in memory
+// only if the file is saved. The file is written next to the old one and
+// renamed, so it is never left partially written.
+func (f *fileWebhookStore) update(userID string, endpoints []webhook.Endpoint) error {
+	all := make(map[string][]webhook.Endpoint, len(f.endpoints)+1)
+	for id, e := range f.endpoints {
+		all[id] = e
+	}
+
+	if len(endpoints) == 0 {
+		delete(all, userID)
+	} else {
+		all[userID] = endpoints
+	}
+
+	fileData, err := json.Marshal(all)
+	if err != nil {
+		return fmt.Errorf("JSON encoding error: %w", err)
+	}
+
+	tmpPath := f.filePath + ".tmp"
+
+	err = os.WriteFile(tmpPath, fileData, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot save webhooks file: %w", err)
+	}
+
+	err = os.Rename(tmpPath, f.filePath)
+	if err != nil {
+		return fmt.Errorf("cannot save webhooks file: %w", err)
+	}
+
+	f.log.Debug("webhooks file saved", zap.String("file", f.filePath), zap.Int("users", len(all)))
+
+	f.endpoints = all
+
+	return nil
+}
+
+func newDBWebhookStore(dsn string, l *zap.Logger) (*dbWebhookStore, error) {
+	db, err := openDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id varchar PRIMARY KEY,
+			"user" varchar NOT NULL,
+			url varchar NOT NULL,
+			events varchar NOT NULL,
+			secret varchar NOT NULL,
+			created_at timestamptz NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id bigserial PRIMARY KEY,
+			webhook_id varchar NOT NULL,
+			"user" varchar NOT NULL,
+			event_id varchar NOT NULL,
+			event_type varchar NOT NULL,
+			attempt integer NOT NULL,
+			status_code integer NOT NULL,
+			error varchar NOT NULL,
+			time timestamptz NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id bigserial PRIMARY KEY,
+			webhook_id varchar NOT NULL,
+			"user" varchar NOT NULL,
+			payload jsonb NOT NULL,
+			attempts integer NOT NULL,
+			error varchar NOT NULL,
+			time timestamptz NOT NULL
+		);`,
+	}
+
+	for _, query := range queries {
+		if _, err = db.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("cannot create webhook tables: %w", err)
+		}
+	}
+
+	return &dbWebhookStore{db: db, log: logger.OrNop(l)}, nil
+}
+
+// Close closes the DB connection pool.
+func (d *dbWebhookStore) Close() error {
+	return d.db.Close()
+}
+
+// AddEndpoint saves endpoint in DB.
+func (d *dbWebhookStore) AddEndpoint(ctx context.Context, e webhook.Endpoint) error {
+	_, err := d.db.ExecContext(
+		ctx,
+		`INSERT INTO webhooks (id, "user", url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5, $6);`,
+		e.ID,
+		e.UserID,
+		e.URL,
+		strings.Join(e.Events, ","),
+		e.Secret,
+		e.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot add webhook: %w", err)
+	}
+
+	return nil
+}
+
+// GetEndpoints returns all user endpoints from DB.
+func (d *dbWebhookStore) GetEndpoints(ctx context.Context, userID string) ([]webhook.Endpoint, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT id, url, events, secret, created_at FROM webhooks WHERE "user" = $1 ORDER BY created_at;`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find webhooks: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	var endpoints []webhook.Endpoint
+
+	for rows.Next() {
+		e := webhook.Endpoint{UserID: userID}
+		var events string
+
+		err = rows.Scan(&e.ID, &e.URL, &events, &e.Secret, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+
+		if events != "" {
+			e.Events = strings.Split(events, ",")
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// DeleteEndpoint removes user endpoint from DB.
+func (d *dbWebhookStore) DeleteEndpoint(ctx context.Context, userID, id string) error {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM webhooks WHERE "user" = $1 AND id = $2;`, userID, id)
+	if err != nil {
+		return fmt.Errorf("cannot delete webhook: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	if n == 0 {
+		return webhook.ErrNotFound
+	}
+
+	return nil
+}
+
+// AddDelivery saves delivery attempt in DB.
+func (d *dbWebhookStore) AddDelivery(ctx context.Context, dl webhook.Delivery) error {
+	_, err := d.db.ExecContext(
+		ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, "user", event_id, event_type, attempt, status_code, error, time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`,
+		dl.EndpointID,
+		dl.UserID,
+		dl.EventID,
+		dl.EventType,
+		dl.Attempt,
+		dl.StatusCode,
+		dl.Error,
+		dl.Time,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot add delivery: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the last user deliveries from DB in chronological order.
+func (d *dbWebhookStore) GetDeliveries(ctx context.Context, userID string, limit int) ([]webhook.Delivery, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT webhook_id, event_id, event_type, attempt, status_code, error, time FROM (
+			SELECT * FROM webhook_deliveries WHERE "user" = $1 ORDER BY id DESC LIMIT NULLIF($2, 0)
+		) t ORDER BY id;`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find deliveries: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	var deliveries []webhook.Delivery
+
+	for rows.Next() {
+		dl := webhook.Delivery{UserID: userID}
+
+		err = rows.Scan(&dl.EndpointID, &dl.EventID, &dl.EventType, &dl.Attempt, &dl.StatusCode, &dl.Error, &dl.Time)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+
+		deliveries = append(deliveries, dl)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// AddDeadLetter saves undelivered payload in DB.
+func (d *dbWebhookStore) AddDeadLetter(ctx context.Context, dl webhook.DeadLetter) error {
+	payload, err := json.Marshal(dl.Payload)
+	if err != nil {
+		return fmt.Errorf("JSON encoding error: %w", err)
+	}
+
+	_, err = d.db.ExecContext(
+		ctx,
+		`INSERT INTO webhook_dead_letters (webhook_id, "user", payload, attempts, error, time) VALUES ($1, $2, $3, $4, $5, $6);`,
+		dl.EndpointID,
+		dl.UserID,
+		payload,
+		dl.Attempts,
+		dl.Error,
+		dl.Time,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot add dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeadLetters returns the last user dead letters from DB in chronological order.
+func (d *dbWebhookStore) GetDeadLetters(ctx context.Context, userID string, limit int) ([]webhook.DeadLetter, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`SELECT webhook_id, payload, attempts, error, time FROM (
+			SELECT * FROM webhook_dead_letters WHERE "user" = $1 ORDER BY id DESC LIMIT NULLIF($2, 0)
+		) t ORDER BY id;`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find dead letters: %w", err)
+	}
+	defer closeRows(ctx, d.log, rows)
+
+	var deadLetters []webhook.DeadLetter
+
+	for rows.Next() {
+		dl := webhook.DeadLetter{UserID: userID}
+		var payload []byte
+
+		err = rows.Scan(&dl.EndpointID, &payload, &dl.Attempts, &dl.Error, &dl.Time)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan values: %w", err)
+		}
+
+		if err = json.Unmarshal(payload, &dl.Payload); err != nil {
+			return nil, fmt.Errorf("JSON decoding error: %w", err)
+		}
+
+		deadLetters = append(deadLetters, dl)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return deadLetters, nil
+}
+
+func closeRows(ctx context.Context, l *zap.Logger, rows *sql.Rows) {
+	if err := rows.Close(); err != nil {
+		logger.Request(ctx, l).Warn("rows close error", zap.Error(err))
+	}
+}
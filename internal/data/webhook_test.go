@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWebhookStore(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "storage.json")
+
+	store, err := NewWebhookStore("", filePath, nil)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	endpoints := []webhook.Endpoint{
+		{ID: "1", UserID: "user1", URL: "https://example.com/hook", Events: []string{"link.created"}, Secret: "secret1", CreatedAt: now},
+		{ID: "2", UserID: "user1", URL: "https://example.com/other", Secret: "secret2", CreatedAt: now},
+		{ID: "3", UserID: "user2", URL: "https://example.org/hook", Secret: "secret3", CreatedAt: now},
+	}
+
+	for _, e := range endpoints {
+		require.NoError(t, store.AddEndpoint(context.Background(), e))
+	}
+
+	require.NoError(t, store.DeleteEndpoint(context.Background(), "user1", "2"))
+	assert.ErrorIs(t, store.DeleteEndpoint(context.Background(), "user2", "1"), webhook.ErrNotFound)
+	require.NoError(t, store.Close())
+
+	info, err := os.Stat(filePath + webhookFileSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reopened, err := NewWebhookStore("", filePath, nil)
+	require.NoError(t, err)
+
+	got, err := reopened.GetEndpoints(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, endpoints[:1], got)
+
+	got, err = reopened.GetEndpoints(context.Background(), "user2")
+	assert.NoError(t, err)
+	assert.Equal(t, endpoints[2:], got)
+
+	require.NoError(t, reopened.AddDelivery(context.Background(), webhook.Delivery{EndpointID: "1", UserID: "user1", Attempt: 1}))
+	deliveries, err := reopened.GetDeliveries(context.Background(), "user1", 0)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+}
@@ -0,0 +1,79 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	pb "github.com/ruskiiamov/shortener/internal/proto"
+	pbv2 "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// internalMethods are methods for trusted subnets only.
+var internalMethods = map[string]bool{
+	pb.Shortener_GetStats_FullMethodName:   true,
+	pbv2.Shortener_GetStats_FullMethodName: true,
+}
+
+// NewAccessInterceptor returns interceptor that allows internal methods for
+// trusted clients only. All internal methods are forbidden if ac is nil. It
+// must be chained first.
+func NewAccessInterceptor(ac *access.Checker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if err = checkAccess(ctx, ac, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewAccessStreamInterceptor returns stream interceptor with the same
+// semantics as NewAccessInterceptor.
+func NewAccessStreamInterceptor(ac *access.Checker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkAccess(ss.Context(), ac, info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func checkAccess(ctx context.Context, ac *access.Checker, method string) error {
+	if !internalMethods[method] {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if err := ac.Check(peerAddr(ctx), md.Get); err != nil {
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	return nil
+}
+
+// clientIP returns the client address ac resolves from the peer and the
+// proxy metadata, nil ac trusts no proxy metadata. The peer address is
+// returned if it is not an IP.
+func clientIP(ctx context.Context, ac *access.Checker) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if ip := ac.ClientIP(peerAddr(ctx), md.Get); ip != nil {
+		return ip.String()
+	}
+
+	return peerIP(ctx)
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+
+	return ""
+}
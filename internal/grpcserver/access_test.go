@@ -0,0 +1,123 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withPeer returns interceptor that replaces the bufconn peer with addr,
+// bufconn addresses are not IPs.
+func withPeer(addr string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(peer.NewContext(ctx, &peer.Peer{Addr: tcpAddr}), req)
+	}
+}
+
+func TestAccessInterceptor(t *testing.T) {
+	getStats := func(ctx context.Context, c pb.ShortenerClient) error {
+		_, err := c.GetStats(ctx, &pb.GetStatsRequest{})
+		return err
+	}
+
+	tests := []struct {
+		name     string
+		subnets  string
+		proxies  string
+		peer     string
+		md       metadata.MD
+		run      func(ctx context.Context, c pb.ShortenerClient) error
+		wantCode codes.Code
+	}{
+		{
+			name:     "trusted",
+			subnets:  "192.168.1.0/24",
+			peer:     "192.168.1.5:4000",
+			run:      getStats,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "not trusted",
+			subnets:  "192.168.1.0/24",
+			peer:     "10.1.1.1:4000",
+			run:      getStats,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "subnet not set",
+			peer:     "192.168.1.5:4000",
+			run:      getStats,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "real ip from proxy",
+			subnets:  "192.168.1.0/24",
+			proxies:  "127.0.0.1/32",
+			peer:     "127.0.0.1:4000",
+			md:       metadata.Pairs(access.RealIPHeader, "192.168.1.5"),
+			run:      getStats,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "real ip not from proxy",
+			subnets:  "192.168.1.0/24",
+			peer:     "10.1.1.1:4000",
+			md:       metadata.Pairs(access.RealIPHeader, "192.168.1.5"),
+			run:      getStats,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:    "public method",
+			subnets: "192.168.1.0/24",
+			peer:    "10.1.1.1:4000",
+			run: func(ctx context.Context, c pb.ShortenerClient) error {
+				_, err := c.GetURL(ctx, &pb.GetURLRequest{Id: "1"})
+				return err
+			},
+			wantCode: codes.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac, err := access.NewChecker(tt.subnets, tt.proxies)
+			require.NoError(t, err)
+
+			conn := newTestConn(t, nil, []grpc.ServerOption{
+				grpc.ChainUnaryInterceptor(withPeer(tt.peer), NewAccessInterceptor(ac)),
+			})
+
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewOutgoingContext(ctx, tt.md)
+			}
+
+			err = tt.run(ctx, pb.NewShortenerClient(conn))
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestAccessInterceptorNilChecker(t *testing.T) {
+	conn := newTestConn(t, nil, []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(withPeer("192.168.1.5:4000"), NewAccessInterceptor(nil)),
+	})
+
+	_, err := pb.NewShortenerClient(conn).GetStats(context.Background(), &pb.GetStatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -4,15 +4,19 @@ package grpcserver
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
-	pb "github.com/ruskiiamov/shortener/internal/proto"
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
 	"github.com/ruskiiamov/shortener/internal/url"
 	"github.com/ruskiiamov/shortener/internal/user"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 const userIDctxKey ctxKey = "user_id"
@@ -20,13 +24,18 @@ const authHeader = "auth"
 
 type ctxKey string
 
+// publicPrefixes are method prefixes of the services without auth.
+var publicPrefixes = []string{"/grpc.health.v1.", "/grpc.reflection."}
+
+var errNoUserID = errors.New("user ID not found in context")
+
 type grpcServer struct {
 	pb.UnimplementedShortenerServer
 	urlConverter url.Converter
 	delBuf       chan *url.DelBatch
 }
 
-// NewGRPCServer returns gRPC server implementation.
+// NewGRPCServer returns implementation of the Shortener v2 gRPC service.
 func NewGRPCServer(u url.Converter, delBuf chan *url.DelBatch) *grpcServer {
 	return &grpcServer{
 		urlConverter: u,
@@ -34,35 +43,96 @@ func NewGRPCServer(u url.Converter, delBuf chan *url.DelBatch) *grpcServer {
 	}
 }
 
-// NewAuthInterceptor returns interceptor for auth.
-func NewAuthInterceptor(ua user.Authorizer) grpc.UnaryServerInterceptor {
+// NewAuthInterceptor returns interceptor for auth. The actor address is
+// resolved with ac, nil ac trusts no proxy metadata.
+func NewAuthInterceptor(ua user.Authorizer, ac *access.Checker) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		var token string
+		if public(info.FullMethod) {
+			return handler(ctx, req)
+		}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if ok {
-			values := md.Get(authHeader)
-			if len(values) > 0 {
-				token = values[0]
-			}
+		ctxAuth, err := authenticate(ctx, ua, ac, func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		})
+		if err != nil {
+			return nil, err
 		}
 
-		userID, err := ua.GetUserID(token)
+		return handler(ctxAuth, req)
+	}
+}
+
+// NewAuthStreamInterceptor returns stream interceptor for auth with the same
+// semantics as NewAuthInterceptor.
+func NewAuthStreamInterceptor(ua user.Authorizer, ac *access.Checker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if public(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		ctxAuth, err := authenticate(ss.Context(), ua, ac, ss.SetHeader)
 		if err != nil {
-			userID, token, err = ua.CreateUser()
-			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
-			}
-			err = grpc.SetHeader(ctx, metadata.Pairs(authHeader, token))
-			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
-			}
+			return err
 		}
 
-		ctxAuth := context.WithValue(ctx, userIDctxKey, userID)
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctxAuth})
+	}
+}
 
-		return handler(ctxAuth, req)
+// public reports whether the method belongs to the infrastructure services
+// that are called without auth, e.g. health checks of load balancers.
+func public(method string) bool {
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
 	}
+
+	return false
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context with user ID.
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate returns context with user ID from the auth token. A new user
+// is created for empty or wrong token, the new token is sent with setHeader.
+func authenticate(ctx context.Context, ua user.Authorizer, ac *access.Checker, setHeader func(metadata.MD) error) (context.Context, error) {
+	var token string
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		values := md.Get(authHeader)
+		if len(values) > 0 {
+			token = values[0]
+		}
+	}
+
+	userID, err := ua.GetUserID(token)
+	if err != nil {
+		userID, token, err = ua.CreateUser()
+		if err != nil {
+			return nil, problem.GRPCStatus(ctx, err)
+		}
+		err = setHeader(metadata.Pairs(authHeader, token))
+		if err != nil {
+			return nil, problem.GRPCStatus(ctx, err)
+		}
+	}
+
+	ctxAuth := context.WithValue(ctx, userIDctxKey, userID)
+	ctxAuth = url.WithActor(ctxAuth, url.Actor{
+		IP:        clientIP(ctx, ac),
+		Transport: url.TransportGRPC,
+	})
+
+	return ctxAuth, nil
 }
 
 // GetURL implements interface of getting URL.
@@ -70,12 +140,16 @@ func (g *grpcServer) GetURL(ctx context.Context, in *pb.GetURLRequest) (*pb.GetU
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	shortURL, err := g.urlConverter.GetOriginal(ctx, in.Id)
+	shortURL, err := g.urlConverter.GetOriginal(ctx, in.Domain, in.Id)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, err.Error())
+		return nil, statusError(ctx, err, "id")
 	}
 
-	return &pb.GetURLResponse{Url: shortURL.Original}, nil
+	return &pb.GetURLResponse{
+		Url:          shortURL.Original,
+		RedirectCode: int32(shortURL.Redirect.Code),
+		CacheControl: shortURL.Redirect.CacheControl,
+	}, nil
 }
 
 // AddURL implements interface of saving new URL.
@@ -85,20 +159,43 @@ func (g *grpcServer) AddURL(ctx context.Context, in *pb.AddURLRequest) (*pb.AddU
 
 	userID, ok := ctx.Value(userIDctxKey).(string)
 	if !ok || userID == "" {
-		return nil, status.Error(codes.Internal, "User ID error")
+		return nil, problem.GRPCStatus(ctx, errNoUserID)
 	}
 
-	var errDupl *url.ErrURLDuplicate
+	redirect := url.Redirect{Code: int(in.RedirectCode), CacheControl: in.CacheControl}
 
-	url, err := g.urlConverter.Shorten(ctx, userID, in.Url)
-	if errors.As(err, &errDupl) {
-		return nil, status.Error(codes.AlreadyExists, "URL ID is "+errDupl.EncodedID)
+	shortURL, err := g.urlConverter.Shorten(ctx, userID, in.Domain, in.Url, redirect)
+	if errors.Is(err, url.ErrInvalidRedirect) {
+		return nil, statusError(ctx, err, redirectField(redirect))
 	}
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, statusError(ctx, err, "url")
 	}
 
-	return &pb.AddURLResponse{Id: url.EncodedID}, nil
+	return &pb.AddURLResponse{Id: shortURL.EncodedID}, nil
+}
+
+// SetRedirect implements interface of changing URL redirect.
+func (g *grpcServer) SetRedirect(ctx context.Context, in *pb.SetRedirectRequest) (*pb.SetRedirectResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	userID, ok := ctx.Value(userIDctxKey).(string)
+	if !ok || userID == "" {
+		return nil, problem.GRPCStatus(ctx, errNoUserID)
+	}
+
+	redirect := url.Redirect{Code: int(in.RedirectCode), CacheControl: in.CacheControl}
+
+	_, err := g.urlConverter.SetRedirect(ctx, userID, in.Id, redirect)
+	if errors.Is(err, url.ErrInvalidRedirect) {
+		return nil, statusError(ctx, err, redirectField(redirect))
+	}
+	if err != nil {
+		return nil, statusError(ctx, err, "id")
+	}
+
+	return &pb.SetRedirectResponse{}, nil
 }
 
 // AddURLBatch implements interface of saving URL batch.
@@ -108,16 +205,17 @@ func (g *grpcServer) AddURLBatch(ctx context.Context, in *pb.AddURLBatchRequest)
 
 	userID, ok := ctx.Value(userIDctxKey).(string)
 	if !ok || userID == "" {
-		return nil, status.Error(codes.Internal, "User ID error")
+		return nil, problem.GRPCStatus(ctx, errNoUserID)
 	}
 
 	var originals []string
 	for _, item := range in.Urls {
 		originals = append(originals, item.Url)
 	}
-	shortURLs, err := g.urlConverter.ShortenBatch(ctx, userID, originals)
+
+	shortURLs, err := g.urlConverter.ShortenBatch(ctx, userID, in.Domain, originals)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, statusError(ctx, err, "urls")
 	}
 
 	var ids []*pb.AddURLBatchResponseItem
@@ -134,7 +232,7 @@ func (g *grpcServer) AddURLBatch(ctx context.Context, in *pb.AddURLBatchRequest)
 	}
 
 	if len(in.Urls) != len(ids) {
-		return nil, status.Error(codes.Internal, "Shorten Batch error")
+		return nil, problem.GRPCStatus(ctx, errors.New("shorten batch error"))
 	}
 
 	return &pb.AddURLBatchResponse{Ids: ids}, nil
@@ -147,19 +245,20 @@ func (g *grpcServer) GetAllURL(ctx context.Context, in *pb.GetAllURLRequest) (*p
 
 	userID, ok := ctx.Value(userIDctxKey).(string)
 	if !ok || userID == "" {
-		return nil, status.Error(codes.Internal, "User ID error")
+		return nil, problem.GRPCStatus(ctx, errNoUserID)
 	}
 
 	shortURLs, err := g.urlConverter.GetAllByUser(ctx, userID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, problem.GRPCStatus(ctx, err)
 	}
 
 	var urls []*pb.GetAllURLResponseItem
 	for _, shortURL := range shortURLs {
 		urls = append(urls, &pb.GetAllURLResponseItem{
-			Id:  shortURL.EncodedID,
-			Url: shortURL.Original,
+			Id:     shortURL.EncodedID,
+			Url:    shortURL.Original,
+			Domain: shortURL.Domain,
 		})
 	}
 
@@ -173,17 +272,27 @@ func (g *grpcServer) DeleteURLBatch(ctx context.Context, in *pb.DeleteURLBatchRe
 
 	userID, ok := ctx.Value(userIDctxKey).(string)
 	if !ok || userID == "" {
-		return nil, status.Error(codes.Internal, "User ID error")
+		return nil, problem.GRPCStatus(ctx, errNoUserID)
+	}
+
+	err := g.urlConverter.ValidateDelete(ctx, userID, in.Ids)
+	if err != nil {
+		return nil, statusError(ctx, problem.WithDefault(problem.BadRequest, err), "ids")
+	}
+
+	batch := &url.DelBatch{
+		UserID:     userID,
+		EncodedIDs: in.Ids,
+		Actor:      url.ActorFromContext(ctx),
+		Trace:      trace.SpanContextFromContext(ctx),
 	}
 
+	// The delete worker stops receiving on shutdown, the send is abandoned
+	// with the call.
 	select {
 	case <-ctx.Done():
-		return nil, status.Error(codes.Internal, "Context canceled")
-	default:
-		g.delBuf <- &url.DelBatch{
-			UserID:     userID,
-			EncodedIDs: in.Ids,
-		}
+		return nil, problem.GRPCStatus(ctx, ctx.Err())
+	case g.delBuf <- batch:
 	}
 
 	return &pb.DeleteURLBatchResponse{}, nil
@@ -196,7 +305,7 @@ func (g *grpcServer) GetStats(ctx context.Context, in *pb.GetStatsRequest) (*pb.
 
 	urls, users, err := g.urlConverter.GetStats(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, problem.GRPCStatus(ctx, err)
 	}
 
 	return &pb.GetStatsResponse{
@@ -211,8 +320,31 @@ func (g *grpcServer) PingDB(ctx context.Context, in *pb.PingDBRequest) (*pb.Ping
 	defer cancel()
 
 	if err := g.urlConverter.PingKeeper(ctx); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, problem.GRPCStatus(ctx, err)
 	}
 
 	return &pb.PingDBResponse{}, nil
 }
+
+// redirectField returns the request field of the redirect not valid.
+func redirectField(r url.Redirect) string {
+	if (url.Redirect{Code: r.Code}).Validate() != nil {
+		return "redirect_code"
+	}
+
+	return "cache_control"
+}
+
+// statusError returns gRPC status error with google.rpc.BadRequest details
+// for invalid request field.
+func statusError(ctx context.Context, err error, field string) error {
+	if problem.Classify(err).GRPCCode != codes.InvalidArgument {
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	return problem.GRPCStatus(ctx, err, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: err.Error()},
+		},
+	})
+}
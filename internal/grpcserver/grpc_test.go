@@ -0,0 +1,50 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthActorIP(t *testing.T) {
+	tests := []struct {
+		name string
+		peer string
+		want string
+	}{
+		{name: "trusted proxy", peer: "127.0.0.1:4000", want: "203.0.113.1"},
+		{name: "untrusted peer", peer: "10.1.1.1:4000", want: "10.1.1.1"},
+	}
+
+	ac, err := access.NewChecker("", "127.0.0.1/32")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actor url.Actor
+			capture := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				actor = url.ActorFromContext(ctx)
+				return handler(ctx, req)
+			}
+
+			conn := newTestConn(t, nil, []grpc.ServerOption{
+				grpc.ChainUnaryInterceptor(withPeer(tt.peer), NewAuthInterceptor(user.NewAuthorizer([]byte("secret")), ac), capture),
+			})
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "x-real-ip", "203.0.113.1")
+			_, err := pb.NewShortenerClient(conn).AddURL(ctx, &pb.AddURLRequest{Url: "http://example.com"})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, actor.IP)
+			assert.Equal(t, url.TransportGRPC, actor.Transport)
+		})
+	}
+}
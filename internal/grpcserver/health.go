@@ -0,0 +1,95 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/probe"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthCheckTimeout limits one run of the readiness checks.
+const healthCheckTimeout = time.Second
+
+// CheckServicePrefix prefixes the readiness check names to get the health
+// service names of the checks, e.g. "check/keeper".
+const CheckServicePrefix = "check/"
+
+// Health is the grpc.health.v1 service with the status of the server and
+// the Shortener service driven by the readiness checks. Each check has its
+// own service named with CheckServicePrefix.
+type Health struct {
+	*health.Server
+	checker  *probe.Checker
+	interval time.Duration
+	done     chan struct{}
+}
+
+// NewHealth returns health service that runs the checks every interval.
+func NewHealth(c *probe.Checker, interval time.Duration) *Health {
+	return &Health{
+		Server:   health.NewServer(),
+		checker:  c,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the check loop until ctx is done or Shutdown is called.
+func (h *Health) Start(ctx context.Context) {
+	h.check(ctx)
+
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.done:
+				return
+			case <-ticker.C:
+				h.check(ctx)
+			}
+		}
+	}()
+}
+
+// Shutdown stops the check loop and reports NOT_SERVING for all services
+// so load balancers stop sending new RPCs.
+func (h *Health) Shutdown() {
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+
+	h.Server.Shutdown()
+}
+
+func (h *Health) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := h.checker.Check(ctx)
+
+	// SetServingStatus is ignored after Shutdown.
+	for _, r := range report.Checks {
+		h.SetServingStatus(CheckServicePrefix+r.Name, servingStatus(r.Status))
+	}
+
+	status := servingStatus(report.Status)
+	h.SetServingStatus("", status)
+	h.SetServingStatus(pb.Shortener_ServiceDesc.ServiceName, status)
+}
+
+func servingStatus(status string) healthpb.HealthCheckResponse_ServingStatus {
+	if status == probe.StatusPass {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,81 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/probe"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealth(t *testing.T) {
+	var ready atomic.Bool
+
+	checker := probe.NewChecker(time.Second, nil)
+	checker.Add(probe.Check{Name: "keeper", Func: func(ctx context.Context) error {
+		if !ready.Load() {
+			return errors.New("not ready")
+		}
+		return nil
+	}})
+
+	h := NewHealth(checker, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn := newTestConn(t, func(s *grpc.Server) { healthpb.RegisterHealthServer(s, h) }, nil)
+	client := healthpb.NewHealthClient(conn)
+
+	services := []string{"", pb.Shortener_ServiceDesc.ServiceName, CheckServicePrefix + "keeper"}
+
+	statusOf := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	tests := []struct {
+		name   string
+		action func()
+		want   healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name:   "check failing",
+			action: func() { h.Start(ctx) },
+			want:   healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+		{
+			name:   "check passing",
+			action: func() { ready.Store(true) },
+			want:   healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name:   "shutdown",
+			action: h.Shutdown,
+			want:   healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.action()
+
+			for _, service := range services {
+				assert.Eventually(t, func() bool { return statusOf(service) == tt.want }, time.Second, 10*time.Millisecond, service)
+			}
+		})
+	}
+
+	// The check after Shutdown doesn't bring the services back.
+	h.check(ctx)
+	for _, service := range services {
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, statusOf(service), service)
+	}
+}
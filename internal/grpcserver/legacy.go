@@ -0,0 +1,113 @@
+package grpcserver
+
+import (
+	"context"
+
+	pb "github.com/ruskiiamov/shortener/internal/proto"
+	pbv2 "github.com/ruskiiamov/shortener/internal/proto/v2"
+)
+
+// legacyServer serves the first version of the Shortener service with the
+// v2 implementation. The error fields of v1 responses are never set, errors
+// are returned as gRPC statuses.
+type legacyServer struct {
+	pb.UnimplementedShortenerServer
+	s *grpcServer
+}
+
+// NewLegacyServer returns implementation of the Shortener v1 gRPC service.
+func NewLegacyServer(s *grpcServer) *legacyServer {
+	return &legacyServer{s: s}
+}
+
+// GetURL implements interface of getting URL.
+func (l *legacyServer) GetURL(ctx context.Context, in *pb.GetURLRequest) (*pb.GetURLResponse, error) {
+	res, err := l.s.GetURL(ctx, &pbv2.GetURLRequest{Id: in.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetURLResponse{Url: res.Url}, nil
+}
+
+// AddURL implements interface of saving new URL.
+func (l *legacyServer) AddURL(ctx context.Context, in *pb.AddURLRequest) (*pb.AddURLResponse, error) {
+	res, err := l.s.AddURL(ctx, &pbv2.AddURLRequest{Url: in.Url})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AddURLResponse{Id: res.Id}, nil
+}
+
+// AddURLBatch implements interface of saving URL batch.
+func (l *legacyServer) AddURLBatch(ctx context.Context, in *pb.AddURLBatchRequest) (*pb.AddURLBatchResponse, error) {
+	req := &pbv2.AddURLBatchRequest{}
+	for _, item := range in.Urls {
+		req.Urls = append(req.Urls, &pbv2.AddURLBatchRequestItem{
+			CorrelationId: item.CorrelationId,
+			Url:           item.Url,
+		})
+	}
+
+	res, err := l.s.AddURLBatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []*pb.AddURLBatchResponseItem
+	for _, item := range res.Ids {
+		ids = append(ids, &pb.AddURLBatchResponseItem{
+			CorrelationId: item.CorrelationId,
+			Id:            item.Id,
+		})
+	}
+
+	return &pb.AddURLBatchResponse{Ids: ids}, nil
+}
+
+// GetAllURL implements interface of getting all URL by user.
+func (l *legacyServer) GetAllURL(ctx context.Context, in *pb.GetAllURLRequest) (*pb.GetAllURLResponse, error) {
+	res, err := l.s.GetAllURL(ctx, &pbv2.GetAllURLRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []*pb.GetAllURLResponseItem
+	for _, item := range res.Urls {
+		urls = append(urls, &pb.GetAllURLResponseItem{
+			Id:  item.Id,
+			Url: item.Url,
+		})
+	}
+
+	return &pb.GetAllURLResponse{Urls: urls}, nil
+}
+
+// DeleteURLBatch implements interface of deleting URL batch.
+func (l *legacyServer) DeleteURLBatch(ctx context.Context, in *pb.DeleteURLBatchRequest) (*pb.DeleteURLBatchResponse, error) {
+	if _, err := l.s.DeleteURLBatch(ctx, &pbv2.DeleteURLBatchRequest{Ids: in.Ids}); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteURLBatchResponse{}, nil
+}
+
+// GetStats implements interface of getting service statistics.
+func (l *legacyServer) GetStats(ctx context.Context, in *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+	res, err := l.s.GetStats(ctx, &pbv2.GetStatsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetStatsResponse{Urls: res.Urls, Users: res.Users}, nil
+}
+
+// PingDB implements interface of the databease ping.
+func (l *legacyServer) PingDB(ctx context.Context, in *pb.PingDBRequest) (*pb.PingDBResponse, error) {
+	if _, err := l.s.PingDB(ctx, &pbv2.PingDBRequest{}); err != nil {
+		return nil, err
+	}
+
+	return &pb.PingDBResponse{}, nil
+}
@@ -0,0 +1,98 @@
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/requestid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader is the metadata key of the request ID.
+var requestIDHeader = strings.ToLower(requestid.Header)
+
+// NewLoggingInterceptor returns interceptor that accepts the client request
+// ID or generates a new one and sends it in the response header. The call
+// is logged to l with the ID when it is served, nil discards the log.
+func NewLoggingInterceptor(l *zap.Logger) grpc.UnaryServerInterceptor {
+	l = logger.OrNop(l)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		ctx, rl := requestContext(ctx, l)
+		if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestid.FromContext(ctx))); err != nil {
+			rl.Warn("request ID header error", zap.Error(err))
+		}
+
+		resp, err := handler(ctx, req)
+		logCall(ctx, rl, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// NewLoggingStreamInterceptor returns stream interceptor with the same
+// semantics as NewLoggingInterceptor.
+func NewLoggingStreamInterceptor(l *zap.Logger) grpc.StreamServerInterceptor {
+	l = logger.OrNop(l)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		ctx, rl := requestContext(ss.Context(), l)
+		if err := ss.SetHeader(metadata.Pairs(requestIDHeader, requestid.FromContext(ctx))); err != nil {
+			rl.Warn("request ID header error", zap.Error(err))
+		}
+
+		err := handler(srv, &loggingStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, rl, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+// requestContext returns context with the request ID and the request logger.
+func requestContext(ctx context.Context, l *zap.Logger) (context.Context, *zap.Logger) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDHeader); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	id = requestid.Ensure(id)
+
+	rl := l.With(zap.String("request_id", id))
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		rl = rl.With(zap.String("trace_id", sc.TraceID().String()))
+	}
+
+	ctx = requestid.NewContext(ctx, id)
+
+	return logger.NewContext(ctx, rl), rl
+}
+
+func logCall(ctx context.Context, l *zap.Logger, method string, start time.Time, err error) {
+	l.Info("grpc request",
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("remote_addr", peerIP(ctx)),
+	)
+}
+
+type loggingStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context with the request logger.
+func (s *loggingStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,154 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	pb "github.com/ruskiiamov/shortener/internal/proto"
+	pbv2 "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const retryAfterHeader = "retry-after"
+
+var methodClasses = map[string]ratelimit.Class{
+	pb.Shortener_AddURL_FullMethodName:         ratelimit.Shorten,
+	pb.Shortener_AddURLBatch_FullMethodName:    ratelimit.Batch,
+	pb.Shortener_GetURL_FullMethodName:         ratelimit.Redirect,
+	pb.Shortener_DeleteURLBatch_FullMethodName: ratelimit.Delete,
+
+	pbv2.Shortener_AddURL_FullMethodName:         ratelimit.Shorten,
+	pbv2.Shortener_AddURLBatch_FullMethodName:    ratelimit.Batch,
+	pbv2.Shortener_GetURL_FullMethodName:         ratelimit.Redirect,
+	pbv2.Shortener_DeleteURLBatch_FullMethodName: ratelimit.Delete,
+}
+
+// streamClasses are the classes charged for every message received by the
+// streams.
+var streamClasses = map[string]ratelimit.Class{
+	pbv2.Shortener_ShortenStream_FullMethodName: ratelimit.Shorten,
+	pbv2.Shortener_ResolveStream_FullMethodName: ratelimit.Redirect,
+}
+
+// NewRateLimitInterceptor returns interceptor for rate limiting. Anonymous
+// clients are limited by the address ac resolves, nil ac trusts no proxy
+// metadata. It must be chained before the auth interceptor.
+func NewRateLimitInterceptor(l ratelimit.Limiter, ua user.Authorizer, ac *access.Checker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		class, ok := methodClasses[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		err = allow(ctx, l, class, clientKey(ctx, ua, ac), func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewRateLimitStreamInterceptor returns stream interceptor for rate limiting.
+// Every received message is charged, the stream fails when the limit is
+// exceeded. It must be chained before the auth stream interceptor.
+func NewRateLimitStreamInterceptor(l ratelimit.Limiter, ua user.Authorizer, ac *access.Checker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		class, ok := streamClasses[info.FullMethod]
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, &rateLimitStream{
+			ServerStream: ss,
+			limiter:      l,
+			class:        class,
+			key:          clientKey(ss.Context(), ua, ac),
+		})
+	}
+}
+
+type rateLimitStream struct {
+	grpc.ServerStream
+	limiter ratelimit.Limiter
+	class   ratelimit.Class
+	key     string
+}
+
+// RecvMsg receives the message and charges it to the rate limit.
+func (s *rateLimitStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	// The headers are sent with the first response, the later limit
+	// errors have the retry delay in the status details only.
+	return allow(s.Context(), s.limiter, s.class, s.key, func(md metadata.MD) error {
+		s.SetHeader(md)
+		return nil
+	})
+}
+
+// allow takes a token of the client and returns the status error if the
+// limit is exceeded. The retry delay is sent with setHeader and in the
+// status details.
+func allow(ctx context.Context, l ratelimit.Limiter, class ratelimit.Class, key string, setHeader func(metadata.MD) error) error {
+	res, err := l.Allow(ctx, class, key)
+	if err != nil {
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	if res == nil || res.Allowed {
+		return nil
+	}
+
+	retry := int(math.Ceil(res.RetryAfter.Seconds()))
+	if err = setHeader(metadata.Pairs(retryAfterHeader, fmt.Sprint(retry))); err != nil {
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	return problem.GRPCStatus(
+		ctx,
+		problem.Errorf(problem.RateLimited, "rate limit exceeded, retry after %ds", retry),
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(res.RetryAfter)},
+	)
+}
+
+func clientKey(ctx context.Context, ua user.Authorizer, ac *access.Checker) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		if values := md.Get(authHeader); len(values) > 0 {
+			if userID, err := ua.GetUserID(values[0]); err == nil {
+				return "user:" + userID
+			}
+		}
+	}
+
+	return "ip:" + clientIP(ctx, ac)
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
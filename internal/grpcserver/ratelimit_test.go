@@ -0,0 +1,176 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/data"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestConn starts the server with the memory storage on bufconn and
+// returns the client connection to it. register adds the services to the
+// server, nil registers the Shortener service.
+func newTestConn(t *testing.T, register func(s *grpc.Server), serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	if register == nil {
+		keeper, err := data.NewKeeper("", "", nil)
+		require.NoError(t, err)
+
+		uc := url.NewConverter(keeper, url.Quota{}, nil, nil, url.NewDomains(url.Domain{BaseURL: "http://short.test"}), nil)
+		register = func(s *grpc.Server) {
+			pb.RegisterShortenerServer(s, NewGRPCServer(uc, make(chan *url.DelBatch, 1)))
+		}
+	}
+
+	listener := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer(serverOpts...)
+	register(s)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+
+	conn, err := grpc.Dial("bufnet", dialOpts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestRateLimitStreamInterceptor(t *testing.T) {
+	tests := []struct {
+		name  string
+		class ratelimit.Class
+		run   func(ctx context.Context, c pb.ShortenerClient) error
+	}{
+		{
+			name:  "shorten stream",
+			class: ratelimit.Shorten,
+			run: func(ctx context.Context, c pb.ShortenerClient) error {
+				stream, err := c.ShortenStream(ctx)
+				if err != nil {
+					return err
+				}
+				for _, u := range []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"} {
+					if err = stream.Send(&pb.ShortenStreamRequest{Url: u}); err != nil {
+						break
+					}
+				}
+				stream.CloseSend()
+				for {
+					if _, err = stream.Recv(); err != nil {
+						return err
+					}
+				}
+			},
+		},
+		{
+			name:  "resolve stream",
+			class: ratelimit.Redirect,
+			run: func(ctx context.Context, c pb.ShortenerClient) error {
+				stream, err := c.ResolveStream(ctx)
+				if err != nil {
+					return err
+				}
+				for i := 0; i < 3; i++ {
+					if err = stream.Send(&pb.ResolveStreamRequest{Id: "1"}); err != nil {
+						break
+					}
+					if _, err = stream.Recv(); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+
+	ua := user.NewAuthorizer([]byte("secret"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := ratelimit.NewLimiter(ratelimit.NewMemBackend(), map[ratelimit.Class]ratelimit.Rule{
+				tt.class: {Rate: 0.001, Burst: 2},
+			})
+
+			conn := newTestConn(t, nil, []grpc.ServerOption{
+				grpc.ChainStreamInterceptor(NewRateLimitStreamInterceptor(rl, ua, nil), NewAuthStreamInterceptor(ua, nil)),
+			})
+
+			err := tt.run(context.Background(), pb.NewShortenerClient(conn))
+
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, codes.ResourceExhausted, st.Code())
+
+			var retry *errdetails.RetryInfo
+			for _, d := range st.Details() {
+				if r, ok := d.(*errdetails.RetryInfo); ok {
+					retry = r
+				}
+			}
+			require.NotNil(t, retry)
+			assert.Positive(t, retry.RetryDelay.AsDuration())
+		})
+	}
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		peer       string
+		wantSecond codes.Code
+	}{
+		{name: "trusted proxy", peer: "127.0.0.1:4000", wantSecond: codes.NotFound},
+		{name: "untrusted peer", peer: "10.1.1.1:4000", wantSecond: codes.ResourceExhausted},
+	}
+
+	ua := user.NewAuthorizer([]byte("secret"))
+
+	ac, err := access.NewChecker("", "127.0.0.1/32")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := ratelimit.NewLimiter(ratelimit.NewMemBackend(), map[ratelimit.Class]ratelimit.Rule{
+				ratelimit.Redirect: {Rate: 0.001, Burst: 1},
+			})
+
+			conn := newTestConn(t, nil, []grpc.ServerOption{
+				grpc.ChainUnaryInterceptor(withPeer(tt.peer), NewRateLimitInterceptor(rl, ua, ac)),
+			})
+			client := pb.NewShortenerClient(conn)
+
+			getURL := func(realIP string) error {
+				ctx := metadata.AppendToOutgoingContext(context.Background(), "x-real-ip", realIP)
+				_, err := client.GetURL(ctx, &pb.GetURLRequest{Id: "1"})
+				return err
+			}
+
+			assert.Equal(t, codes.NotFound, status.Code(getURL("203.0.113.1")))
+			assert.Equal(t, tt.wantSecond, status.Code(getURL("203.0.113.2")))
+		})
+	}
+}
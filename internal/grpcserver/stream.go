@@ -0,0 +1,244 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/problem"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/url"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// streamChunkSize is the number of URLs stored at once by ShortenStream.
+	streamChunkSize = 100
+
+	// streamChunkTimeout limits one storage call of a stream, the stream
+	// itself has no deadline.
+	streamChunkTimeout = 5 * time.Second
+)
+
+// ShortenStream stores streamed URLs in chunks. Results of a chunk are sent
+// after it is stored or after the client closes its side of the stream.
+func (g *grpcServer) ShortenStream(stream pb.Shortener_ShortenStreamServer) error {
+	ctx := stream.Context()
+
+	userID, ok := ctx.Value(userIDctxKey).(string)
+	if !ok || userID == "" {
+		return problem.GRPCStatus(ctx, errNoUserID)
+	}
+
+	chunkSize, err := g.chunkSize(ctx, userID)
+	if err != nil {
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	chunk := make([]*pb.ShortenStreamRequest, 0, chunkSize)
+
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return g.shortenChunk(stream, userID, chunk)
+		}
+		if err != nil {
+			return err
+		}
+
+		chunk = append(chunk, in)
+		if len(chunk) < chunkSize {
+			continue
+		}
+
+		if err = g.shortenChunk(stream, userID, chunk); err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+	}
+}
+
+// ListURLs streams all user URLs.
+func (g *grpcServer) ListURLs(in *pb.ListURLsRequest, stream pb.Shortener_ListURLsServer) error {
+	ctx := stream.Context()
+
+	userID, ok := ctx.Value(userIDctxKey).(string)
+	if !ok || userID == "" {
+		return problem.GRPCStatus(ctx, errNoUserID)
+	}
+
+	err := g.urlConverter.ListByUser(ctx, userID, func(u url.URL) error {
+		return stream.Send(&pb.ListURLsResponse{Id: u.EncodedID, Url: u.Original, Domain: u.Domain})
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	return nil
+}
+
+// ResolveStream returns original URLs for streamed IDs in the request order.
+func (g *grpcServer) ResolveStream(stream pb.Shortener_ResolveStreamServer) error {
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		res, err := g.resolve(stream.Context(), in.Domain, in.Id)
+		if err != nil {
+			return err
+		}
+
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *grpcServer) resolve(ctx context.Context, domain, id string) (*pb.ResolveStreamResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamChunkTimeout)
+	defer cancel()
+
+	res := &pb.ResolveStreamResponse{Id: id}
+
+	shortURL, err := g.urlConverter.GetOriginal(ctx, domain, id)
+	if err != nil {
+		st, fatal := itemStatus(ctx, err, "id")
+		if fatal != nil {
+			return nil, fatal
+		}
+		res.Status = st
+		return res, nil
+	}
+
+	res.Url = shortURL.Original
+
+	return res, nil
+}
+
+func (g *grpcServer) shortenChunk(stream pb.Shortener_ShortenStreamServer, userID string, chunk []*pb.ShortenStreamRequest) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(stream.Context(), streamChunkTimeout)
+	defer cancel()
+
+	originals := make(map[string][]string)
+	for _, in := range chunk {
+		originals[in.Domain] = append(originals[in.Domain], in.Url)
+	}
+
+	// ids are the encoded ids of the originals by domain.
+	ids := make(map[string]map[string]string, len(originals))
+
+	var err error
+	for domain := range originals {
+		var shortURLs []url.URL
+		if shortURLs, err = g.urlConverter.ShortenBatch(ctx, userID, domain, originals[domain]); err != nil {
+			break
+		}
+
+		ids[domain] = make(map[string]string, len(shortURLs))
+		for _, shortURL := range shortURLs {
+			ids[domain][shortURL.Original] = shortURL.EncodedID
+		}
+	}
+
+	if err == nil {
+		return sendStored(stream, chunk, ids)
+	}
+
+	if problem.Classify(err).Status >= http.StatusInternalServerError {
+		// The links stored with the batches of other domains are reported
+		// before the stream fails.
+		if sendErr := sendStored(stream, chunk, ids); sendErr != nil {
+			return sendErr
+		}
+		return problem.GRPCStatus(ctx, err)
+	}
+
+	// Some items of the chunk are rejected, e.g. URLs or domains not valid
+	// or the links quota exceeded, so they are stored one by one to report
+	// the item errors. The URLs stored with the batches of other domains
+	// are reported as existing.
+	for _, in := range chunk {
+		res := &pb.ShortenStreamResponse{CorrelationId: in.CorrelationId}
+
+		var errDupl *url.ErrURLDuplicate
+
+		shortURL, err := g.urlConverter.Shorten(ctx, userID, in.Domain, in.Url, url.Redirect{})
+		switch {
+		case err == nil:
+			res.Id = shortURL.EncodedID
+		case errors.As(err, &errDupl):
+			res.Id = errDupl.EncodedID
+		default:
+			st, fatal := itemStatus(ctx, err, "url")
+			if fatal != nil {
+				return fatal
+			}
+			res.Status = st
+		}
+
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendStored sends the results of the chunk items stored on their domains,
+// ids are the encoded ids of the originals by domain.
+func sendStored(stream pb.Shortener_ShortenStreamServer, chunk []*pb.ShortenStreamRequest, ids map[string]map[string]string) error {
+	for _, in := range chunk {
+		id, ok := ids[in.Domain][in.Url]
+		if !ok {
+			continue
+		}
+
+		if err := stream.Send(&pb.ShortenStreamResponse{CorrelationId: in.CorrelationId, Id: id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chunkSize returns ShortenStream chunk size within the user batch quota.
+func (g *grpcServer) chunkSize(ctx context.Context, userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamChunkTimeout)
+	defer cancel()
+
+	usage, err := g.urlConverter.GetQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if usage.MaxBatchSize > 0 && usage.MaxBatchSize < streamChunkSize {
+		return usage.MaxBatchSize, nil
+	}
+
+	return streamChunkSize, nil
+}
+
+// itemStatus returns status of the failed stream item. Server errors are
+// returned as fatal and stop the stream.
+func itemStatus(ctx context.Context, err error, field string) (*spb.Status, error) {
+	if problem.Classify(err).Status >= http.StatusInternalServerError {
+		return nil, problem.GRPCStatus(ctx, err)
+	}
+
+	return status.Convert(statusError(ctx, err, field)).Proto(), nil
+}
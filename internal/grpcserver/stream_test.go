@@ -0,0 +1,75 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/data"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestShortenStreamDomainsQuota(t *testing.T) {
+	keeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+
+	domains := url.NewDomains(url.Domain{BaseURL: "http://short.test"}, url.Domain{Name: "go.brand.com", BaseURL: "https://go.brand.com"})
+	uc := url.NewConverter(keeper, url.Quota{MaxLinks: 2}, nil, nil, domains, nil)
+
+	ua := user.NewAuthorizer([]byte("secret"))
+	conn := newTestConn(t, func(s *grpc.Server) {
+		pb.RegisterShortenerServer(s, NewGRPCServer(uc, make(chan *url.DelBatch, 1)))
+	}, []grpc.ServerOption{grpc.ChainStreamInterceptor(NewAuthStreamInterceptor(ua, nil))})
+
+	stream, err := pb.NewShortenerClient(conn).ShortenStream(context.Background())
+	require.NoError(t, err)
+
+	// One of the domain batches exceeds the links quota, whichever is
+	// stored first.
+	requests := []*pb.ShortenStreamRequest{
+		{CorrelationId: "1", Url: "http://example.com/a"},
+		{CorrelationId: "2", Url: "http://example.com/b"},
+		{CorrelationId: "3", Url: "http://example.com/c", Domain: "go.brand.com"},
+	}
+	for _, in := range requests {
+		require.NoError(t, stream.Send(in))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	var stored, exceeded int
+	correlationIDs := make(map[string]bool)
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		correlationIDs[res.CorrelationId] = true
+		if res.Id != "" {
+			stored++
+		}
+		if res.Status != nil && codes.Code(res.Status.Code) == codes.ResourceExhausted {
+			exceeded++
+		}
+	}
+
+	assert.Len(t, correlationIDs, len(requests), "every item is reported")
+	assert.Equal(t, 2, stored)
+	assert.Equal(t, 1, exceeded)
+
+	var links []url.Record
+	err = keeper.Export(context.Background(), func(r url.Record) error {
+		links = append(links, r)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, links, stored, "every stored link is reported")
+}
@@ -0,0 +1,190 @@
+// Package lifecycle starts the service components in dependency order and
+// stops them in the reverse order within the shutdown budget.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Hook is the component of the service. All functions are optional.
+type Hook struct {
+	Name string
+
+	// DependsOn names the components this one uses. The component is
+	// started after them and stopped before them.
+	DependsOn []string
+
+	// Start prepares the component, it must not block.
+	Start func(ctx context.Context) error
+
+	// Serve runs the component until Stop is called. The service shuts down
+	// when Serve returns before the shutdown.
+	Serve func() error
+
+	// Stop stops the component within ctx.
+	Stop func(ctx context.Context) error
+}
+
+// Manager runs the components.
+type Manager struct {
+	budget time.Duration
+	log    *zap.Logger
+	hooks  []Hook
+}
+
+// New returns manager stopping all components within budget. The phases are
+// logged to l, nil discards the log.
+func New(budget time.Duration, l *zap.Logger) *Manager {
+	return &Manager{
+		budget: budget,
+		log:    logger.OrNop(l),
+	}
+}
+
+// Add registers the component. Components without dependencies between
+// them are started in the registration order.
+func (m *Manager) Add(h Hook) {
+	m.hooks = append(m.hooks, h)
+}
+
+// Run starts the components and serves until ctx is done or a component
+// stops serving. Then it stops the started components in the reverse
+// order. Run returns the first serve, start or stop error.
+func (m *Manager) Run(ctx context.Context) error {
+	hooks, err := m.order()
+	if err != nil {
+		return err
+	}
+
+	var started []Hook
+	for _, h := range hooks {
+		if h.Start != nil {
+			if err = h.Start(ctx); err != nil {
+				err = fmt.Errorf("%s start: %w", h.Name, err)
+				m.log.Error("start failed", zap.String("component", h.Name), zap.Error(err))
+				return m.stop(started, err)
+			}
+		}
+		started = append(started, h)
+		m.log.Debug("started", zap.String("component", h.Name))
+	}
+
+	served := make(chan error, len(hooks))
+	for _, h := range hooks {
+		if h.Serve == nil {
+			continue
+		}
+		go func(h Hook) {
+			if err := h.Serve(); err != nil {
+				served <- fmt.Errorf("%s serve: %w", h.Name, err)
+				return
+			}
+			served <- nil
+		}(h)
+	}
+
+	select {
+	case <-ctx.Done():
+		m.log.Info("shutdown started", zap.String("reason", "signal"))
+	case err = <-served:
+		m.log.Info("shutdown started", zap.String("reason", "component stopped serving"), zap.Error(err))
+	}
+
+	return m.stop(started, err)
+}
+
+// stop stops hooks in the reverse order. All hooks are called even after
+// the budget is spent, so that resources are released.
+func (m *Manager) stop(hooks []Hook, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.budget)
+	defer cancel()
+
+	start := time.Now()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.Stop == nil {
+			continue
+		}
+
+		phaseStart := time.Now()
+		e := h.Stop(ctx)
+		fields := []zap.Field{
+			zap.String("component", h.Name),
+			zap.Duration("duration", time.Since(phaseStart)),
+		}
+
+		if e != nil {
+			m.log.Error("stop failed", append(fields, zap.Error(e))...)
+			if err == nil {
+				err = fmt.Errorf("%s stop: %w", h.Name, e)
+			}
+			continue
+		}
+		m.log.Info("stopped", fields...)
+	}
+
+	m.log.Info("shutdown finished", zap.Duration("duration", time.Since(start)), zap.Bool("in_budget", ctx.Err() == nil))
+
+	return err
+}
+
+// order returns hooks sorted so that every hook follows its dependencies.
+func (m *Manager) order() ([]Hook, error) {
+	byName := make(map[string]Hook, len(m.hooks))
+	for _, h := range m.hooks {
+		if _, ok := byName[h.Name]; ok {
+			return nil, fmt.Errorf("component %s is added twice", h.Name)
+		}
+		byName[h.Name] = h
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(m.hooks))
+	sorted := make([]Hook, 0, len(m.hooks))
+
+	var visit func(h Hook) error
+	visit = func(h Hook) error {
+		switch state[h.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w at %s", errCycle, h.Name)
+		}
+		state[h.Name] = visiting
+
+		for _, name := range h.DependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown %s", h.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		state[h.Name] = visited
+		sorted = append(sorted, h)
+
+		return nil
+	}
+
+	for _, h := range m.hooks {
+		if err := visit(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+var errCycle = errors.New("dependency cycle")
@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) hook(name string, deps ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: deps,
+		Start: func(ctx context.Context) error {
+			r.add("start " + name)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := new(recorder)
+
+	m := New(time.Second, nil)
+	m.Add(r.hook("http", "worker", "storage"))
+	m.Add(r.hook("storage"))
+	m.Add(r.hook("worker", "storage"))
+	m.Add(r.hook("tracing"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.NoError(t, m.Run(ctx))
+	assert.Equal(t, []string{
+		"start storage",
+		"start worker",
+		"start http",
+		"start tracing",
+		"stop tracing",
+		"stop http",
+		"stop worker",
+		"stop storage",
+	}, r.calls)
+}
+
+func TestRunServeError(t *testing.T) {
+	r := new(recorder)
+	serveErr := errors.New("address already in use")
+
+	m := New(time.Second, nil)
+	m.Add(r.hook("storage"))
+
+	h := r.hook("http", "storage")
+	h.Serve = func() error { return serveErr }
+	m.Add(h)
+
+	err := m.Run(context.Background())
+	assert.ErrorIs(t, err, serveErr)
+	assert.Equal(t, []string{"start storage", "start http", "stop http", "stop storage"}, r.calls)
+}
+
+func TestRunStartError(t *testing.T) {
+	r := new(recorder)
+	startErr := errors.New("connection refused")
+
+	m := New(time.Second, nil)
+	m.Add(r.hook("storage"))
+
+	h := r.hook("http", "storage")
+	h.Start = func(ctx context.Context) error { return startErr }
+	m.Add(h)
+
+	err := m.Run(context.Background())
+	assert.ErrorIs(t, err, startErr)
+	assert.Equal(t, []string{"start storage", "stop storage"}, r.calls)
+}
+
+func TestRunBudget(t *testing.T) {
+	r := new(recorder)
+
+	m := New(50*time.Millisecond, nil)
+	m.Add(r.hook("storage"))
+	m.Add(Hook{
+		Name:      "http",
+		DependsOn: []string{"storage"},
+		Stop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := m.Run(ctx)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"start storage", "stop storage"}, r.calls)
+}
+
+func TestRunOrderError(t *testing.T) {
+	tests := []struct {
+		name  string
+		hooks []Hook
+	}{
+		{
+			name:  "cycle",
+			hooks: []Hook{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}},
+		},
+		{
+			name:  "unknown dependency",
+			hooks: []Hook{{Name: "a", DependsOn: []string{"b"}}},
+		},
+		{
+			name:  "duplicate",
+			hooks: []Hook{{Name: "a"}, {Name: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(time.Second, nil)
+			for _, h := range tt.hooks {
+				m.Add(h)
+			}
+
+			assert.Error(t, m.Run(context.Background()))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package logger provides the structured JSON logger and carries the request
+// logger with the request ID through the context.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces sensitive values in the log.
+const Redacted = "REDACTED"
+
+type ctxKey struct{}
+
+// New returns JSON logger writing to stderr entries of the level and above:
+// debug, info, warn or error.
+func New(level string) (*zap.Logger, error) {
+	lvl, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("log level: %w", err)
+	}
+
+	return NewWithLevel(lvl)
+}
+
+// NewWithLevel returns JSON logger writing to stderr, the level may be
+// changed while the logger is used.
+func NewWithLevel(level zap.AtomicLevel) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.Level = level
+	config.EncoderConfig.TimeKey = "time"
+	config.EncoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	config.Sampling = nil
+
+	return config.Build()
+}
+
+// NewContext returns context with the request logger.
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the request logger or the global one.
+func FromContext(ctx context.Context) *zap.Logger {
+	return Request(ctx, zap.L())
+}
+
+// Request returns the request logger of ctx, or l outside of requests.
+func Request(ctx context.Context, l *zap.Logger) *zap.Logger {
+	if rl, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return rl
+	}
+
+	return l
+}
+
+// OrNop returns l or the logger discarding everything if l is nil.
+func OrNop(l *zap.Logger) *zap.Logger {
+	if l == nil {
+		return zap.NewNop()
+	}
+
+	return l
+}
+
+// URL returns the field with rawURL with redacted password and query
+// values, they may carry tokens.
+func URL(key, rawURL string) zap.Field {
+	return zap.String(key, RedactURL(rawURL))
+}
+
+// RedactURL returns rawURL with redacted password and query values.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Redacted
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery = RedactQuery(u.RawQuery)
+	}
+
+	return u.String()
+}
+
+// RedactQuery returns the query with redacted values, the keys are kept.
+func RedactQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		pairs = append(pairs, url.QueryEscape(key)+"="+Redacted)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		level   string
+		enabled zapcore.Level
+		wantErr bool
+	}{
+		{level: "debug", enabled: zapcore.DebugLevel},
+		{level: "info", enabled: zapcore.InfoLevel},
+		{level: "WARN", enabled: zapcore.WarnLevel},
+		{level: "error", enabled: zapcore.ErrorLevel},
+		{level: "verbose", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			l, err := New(tt.level)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.True(t, l.Core().Enabled(tt.enabled))
+			assert.False(t, l.Core().Enabled(tt.enabled-1))
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "plain", url: "http://example.com/path", want: "http://example.com/path"},
+		{name: "query", url: "http://example.com/p?token=abc&b=1&b=2", want: "http://example.com/p?b=REDACTED&token=REDACTED"},
+		{name: "password", url: "postgres://user:secret@db:5432/app", want: "postgres://user:REDACTED@db:5432/app"},
+		{name: "not valid", url: "http://a b.com/%zz", want: Redacted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RedactURL(tt.url))
+		})
+	}
+}
+
+func TestRequest(t *testing.T) {
+	l := zap.NewNop()
+	rl := zap.NewExample()
+
+	assert.Same(t, l, Request(context.Background(), l))
+	assert.Same(t, rl, Request(NewContext(context.Background(), rl), l))
+	assert.NotNil(t, OrNop(nil))
+}
+
+func TestNewWithLevel(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+	l, err := NewWithLevel(level)
+	require.NoError(t, err)
+	assert.False(t, l.Core().Enabled(zapcore.DebugLevel))
+
+	level.SetLevel(zapcore.DebugLevel)
+	assert.True(t, l.Core().Enabled(zapcore.DebugLevel))
+}
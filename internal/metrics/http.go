@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute is the route label of requests without matched route, so
+// that unknown paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// HTTPMiddleware returns middleware recording the requests. pattern returns
+// the matched route pattern after the request is served.
+func (m *Metrics) HTTPMiddleware(pattern func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			route := pattern(r)
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			m.httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+			m.httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// statusWriter keeps the response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// fileSaver is implemented by the data keepers with the file storage.
+type fileSaver interface {
+	OnSave(fn func(d time.Duration, size int, err error))
+}
+
+type dataKeeper struct {
+	next    url.DataKeeper
+	backend string
+	m       *Metrics
+}
+
+// WrapDataKeeper returns the data keeper recording latency and failures of
+// k calls. Expected errors like duplicate or deleted URL are not failures.
+// The file storage saves of k are recorded too.
+func (m *Metrics) WrapDataKeeper(k url.DataKeeper, backend string) url.DataKeeper {
+	if fs, ok := k.(fileSaver); ok {
+		fs.OnSave(m.FileSaved)
+	}
+
+	return &dataKeeper{next: k, backend: backend, m: m}
+}
+
+func (d *dataKeeper) observe(method string, start time.Time, err *error) {
+	d.m.storageDuration.WithLabelValues(d.backend, method).Observe(time.Since(start).Seconds())
+	if *err != nil && problem.Classify(*err).Status >= http.StatusInternalServerError {
+		d.m.storageErrors.WithLabelValues(d.backend, method).Inc()
+	}
+}
+
+// Add implements url.DataKeeper interface.
+func (d *dataKeeper) Add(ctx context.Context, userID, domain, original string, r url.Redirect) (id int, err error) {
+	defer d.observe("Add", time.Now(), &err)
+	return d.next.Add(ctx, userID, domain, original, r)
+}
+
+// SetRedirect implements url.DataKeeper interface.
+func (d *dataKeeper) SetRedirect(ctx context.Context, id int, r url.Redirect) (err error) {
+	defer d.observe("SetRedirect", time.Now(), &err)
+	return d.next.SetRedirect(ctx, id, r)
+}
+
+// AddBatch implements url.DataKeeper interface.
+func (d *dataKeeper) AddBatch(ctx context.Context, userID, domain string, originals []string) (added map[string]int, created []int, err error) {
+	defer d.observe("AddBatch", time.Now(), &err)
+	return d.next.AddBatch(ctx, userID, domain, originals)
+}
+
+// FindIDs implements url.DataKeeper interface.
+func (d *dataKeeper) FindIDs(ctx context.Context, domain string, originals []string) (ids map[string]int, err error) {
+	defer d.observe("FindIDs", time.Now(), &err)
+	return d.next.FindIDs(ctx, domain, originals)
+}
+
+// Get implements url.DataKeeper interface.
+func (d *dataKeeper) Get(ctx context.Context, id int) (r *url.Record, err error) {
+	defer d.observe("Get", time.Now(), &err)
+	return d.next.Get(ctx, id)
+}
+
+// GetAllByUser implements url.DataKeeper interface.
+func (d *dataKeeper) GetAllByUser(ctx context.Context, userID string) (urls []url.Record, err error) {
+	defer d.observe("GetAllByUser", time.Now(), &err)
+	return d.next.GetAllByUser(ctx, userID)
+}
+
+// GetPageByUser implements url.DataKeeper interface.
+func (d *dataKeeper) GetPageByUser(ctx context.Context, userID string, afterID, limit int) (urls []url.Record, err error) {
+	defer d.observe("GetPageByUser", time.Now(), &err)
+	return d.next.GetPageByUser(ctx, userID, afterID, limit)
+}
+
+// DeleteBatch implements url.DataKeeper interface.
+func (d *dataKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) (deleted map[string][]int, err error) {
+	defer d.observe("DeleteBatch", time.Now(), &err)
+	return d.next.DeleteBatch(ctx, batch)
+}
+
+// Ping implements url.DataKeeper interface.
+func (d *dataKeeper) Ping(ctx context.Context) (err error) {
+	defer d.observe("Ping", time.Now(), &err)
+	return d.next.Ping(ctx)
+}
+
+// Close implements url.DataKeeper interface.
+func (d *dataKeeper) Close(ctx context.Context) (err error) {
+	defer d.observe("Close", time.Now(), &err)
+	return d.next.Close(ctx)
+}
+
+// GetStats implements url.DataKeeper interface.
+func (d *dataKeeper) GetStats(ctx context.Context) (urls, users int, err error) {
+	defer d.observe("GetStats", time.Now(), &err)
+	return d.next.GetStats(ctx)
+}
+
+// CountByUser implements url.DataKeeper interface.
+func (d *dataKeeper) CountByUser(ctx context.Context, userID string) (count int, err error) {
+	defer d.observe("CountByUser", time.Now(), &err)
+	return d.next.CountByUser(ctx, userID)
+}
+
+// GetQuota implements url.DataKeeper interface.
+func (d *dataKeeper) GetQuota(ctx context.Context, userID string) (q *url.Quota, err error) {
+	defer d.observe("GetQuota", time.Now(), &err)
+	return d.next.GetQuota(ctx, userID)
+}
+
+// SetQuota implements url.DataKeeper interface.
+func (d *dataKeeper) SetQuota(ctx context.Context, userID string, q url.Quota) (err error) {
+	defer d.observe("SetQuota", time.Now(), &err)
+	return d.next.SetQuota(ctx, userID, q)
+}
+
+// GetOwner implements url.DataKeeper interface.
+func (d *dataKeeper) GetOwner(ctx context.Context, id int) (userID string, err error) {
+	defer d.observe("GetOwner", time.Now(), &err)
+	return d.next.GetOwner(ctx, id)
+}
+
+// FetchOutbox implements url.DataKeeper interface.
+func (d *dataKeeper) FetchOutbox(ctx context.Context, limit int) (events []url.OutboxEvent, err error) {
+	defer d.observe("FetchOutbox", time.Now(), &err)
+	return d.next.FetchOutbox(ctx, limit)
+}
+
+// AckOutbox implements url.DataKeeper interface.
+func (d *dataKeeper) AckOutbox(ctx context.Context, ids []int64) (err error) {
+	defer d.observe("AckOutbox", time.Now(), &err)
+	return d.next.AckOutbox(ctx, ids)
+}
+
+// Export implements url.DataKeeper interface.
+func (d *dataKeeper) Export(ctx context.Context, fn func(url.Record) error) (err error) {
+	defer d.observe("Export", time.Now(), &err)
+	return d.next.Export(ctx, fn)
+}
+
+// Import implements url.DataKeeper interface.
+func (d *dataKeeper) Import(ctx context.Context, records []url.Record) (err error) {
+	defer d.observe("Import", time.Now(), &err)
+	return d.next.Import(ctx, records)
+}
+
+// NextID implements url.DataKeeper interface.
+func (d *dataKeeper) NextID(ctx context.Context) (id int, err error) {
+	defer d.observe("NextID", time.Now(), &err)
+	return d.next.NextID(ctx)
+}
+
+// SetNextID implements url.DataKeeper interface.
+func (d *dataKeeper) SetNextID(ctx context.Context, id int) (err error) {
+	defer d.observe("SetNextID", time.Now(), &err)
+	return d.next.SetNextID(ctx, id)
+}
+
+// Snapshot implements url.DataKeeper interface.
+func (d *dataKeeper) Snapshot(ctx context.Context, w url.SnapshotWriter) (err error) {
+	defer d.observe("Snapshot", time.Now(), &err)
+	return d.next.Snapshot(ctx, w)
+}
+
+// Clear implements url.DataKeeper interface.
+func (d *dataKeeper) Clear(ctx context.Context) (err error) {
+	defer d.observe("Clear", time.Now(), &err)
+	return d.next.Clear(ctx)
+}
@@ -0,0 +1,179 @@
+// Package metrics collects the service metrics in Prometheus format: rate,
+// errors and latency of HTTP requests, gRPC calls and data storage calls,
+// the delete buffer and the file storage saves.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Result label values.
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+// storageBuckets are the latency buckets of the data storage calls, they
+// are finer than the default ones.
+var storageBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// Metrics is the registry of the service metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+
+	deleteQueue      prometheus.Gauge
+	deleteFlushes    *prometheus.CounterVec
+	deleteFlushedIDs *prometheus.CounterVec
+
+	saveDuration *prometheus.HistogramVec
+	saveSize     prometheus.Gauge
+}
+
+// New returns metrics registered with Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "requests_total",
+			Help:      "gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "request_duration_seconds",
+			Help:      "gRPC call latency by method, streams are measured until the end.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "call_duration_seconds",
+			Help:      "Data storage call latency by backend and method.",
+			Buckets:   storageBuckets,
+		}, []string{"backend", "method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Failed data storage calls by backend and method.",
+		}, []string{"backend", "method"}),
+
+		deleteQueue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "delete",
+			Name:      "queue_ids",
+			Help:      "Link IDs waiting in the delete buffer.",
+		}),
+		deleteFlushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "delete",
+			Name:      "flushes_total",
+			Help:      "Delete buffer flushes by result.",
+		}, []string{"result"}),
+		deleteFlushedIDs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "delete",
+			Name:      "flushed_ids_total",
+			Help:      "Link IDs in the delete buffer flushes by result.",
+		}, []string{"result"}),
+
+		saveDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "file_storage",
+			Name:      "save_duration_seconds",
+			Help:      "File storage save latency by result.",
+			Buckets:   storageBuckets,
+		}, []string{"result"}),
+		saveSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "file_storage",
+			Name:      "size_bytes",
+			Help:      "Size of the last saved file storage.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.grpcRequests,
+		m.grpcDuration,
+		m.storageDuration,
+		m.storageErrors,
+		m.deleteQueue,
+		m.deleteFlushes,
+		m.deleteFlushedIDs,
+		m.saveDuration,
+		m.saveSize,
+	)
+
+	return m
+}
+
+// Handler returns handler of the metrics in Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// DeleteQueued implements url.DeleteObserver interface.
+func (m *Metrics) DeleteQueued(ids int) {
+	m.deleteQueue.Set(float64(ids))
+}
+
+// DeleteFlushed implements url.DeleteObserver interface.
+func (m *Metrics) DeleteFlushed(ids int, err error) {
+	r := result(err)
+	m.deleteFlushes.WithLabelValues(r).Inc()
+	m.deleteFlushedIDs.WithLabelValues(r).Add(float64(ids))
+}
+
+// FileSaved records the file storage save.
+func (m *Metrics) FileSaved(d time.Duration, size int, err error) {
+	m.saveDuration.WithLabelValues(result(err)).Observe(d.Seconds())
+	if err == nil {
+		m.saveSize.Set(float64(size))
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+
+	return resultOK
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	m := New()
+
+	router := chi.NewRouter()
+	router.AddMiddlewares(m.HTTPMiddleware(router.RoutePattern))
+	router.GET("/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if router.GetURLParam(r, "id") == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/abc", "/def", "/missing", "/a/b/c"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/{id}", http.MethodGet, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/{id}", http.MethodGet, "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.httpDuration))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `shortener_http_requests_total{code="200",method="GET",route="/{id}"} 2`)
+	assert.Contains(t, rec.Body.String(), "go_goroutines")
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	m := New()
+
+	unary := m.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.v2.Shortener/GetURL"}
+
+	_, err := unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	_, err = unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Error(t, err)
+
+	stream := m.StreamInterceptor()
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/shortener.v2.Shortener/ListURLs"}
+
+	err = stream(nil, nil, streamInfo, func(srv interface{}, ss grpc.ServerStream) error {
+		return errors.New("some error")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, codes.OK.String())))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, codes.NotFound.String())))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(streamInfo.FullMethod, codes.Unknown.String())))
+}
+
+func TestWrapDataKeeper(t *testing.T) {
+	m := New()
+
+	keeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+	keeper = m.WrapDataKeeper(keeper, data.BackendMemory)
+
+	ctx := context.Background()
+
+	_, err = keeper.Add(ctx, "user", "", "http://example.com", url.Redirect{})
+	require.NoError(t, err)
+
+	// Duplicate is the expected result, not the storage failure.
+	_, err = keeper.Add(ctx, "user", "", "http://example.com", url.Redirect{})
+	assert.Error(t, err)
+
+	// The memory keeper has no connection to ping.
+	assert.Error(t, keeper.Ping(ctx))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.storageDuration))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.storageErrors.WithLabelValues(data.BackendMemory, "Add")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageErrors.WithLabelValues(data.BackendMemory, "Ping")))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `shortener_storage_call_duration_seconds_count{backend="memory",method="Add"} 2`)
+}
+
+func TestFileSaved(t *testing.T) {
+	m := New()
+
+	file := t.TempDir() + "/storage.json"
+	keeper, err := data.NewKeeper("", file, nil)
+	require.NoError(t, err)
+	keeper = m.WrapDataKeeper(keeper, data.BackendMemory)
+
+	_, err = keeper.Add(context.Background(), "user", "", "http://example.com", url.Redirect{})
+	require.NoError(t, err)
+	require.NoError(t, keeper.Close(context.Background()))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(m.saveDuration))
+	assert.Greater(t, testutil.ToFloat64(m.saveSize), 0.0)
+
+	m.FileSaved(time.Millisecond, 10, errors.New("some error"))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.saveDuration))
+}
+
+func TestDeleteObserver(t *testing.T) {
+	m := New()
+
+	m.DeleteQueued(5)
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.deleteQueue))
+
+	m.DeleteFlushed(5, nil)
+	m.DeleteFlushed(2, errors.New("some error"))
+	m.DeleteQueued(0)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.deleteQueue))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.deleteFlushes.WithLabelValues(resultOK)))
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.deleteFlushedIDs.WithLabelValues(resultOK)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.deleteFlushedIDs.WithLabelValues(resultError)))
+
+	expected := `
+# HELP shortener_delete_flushes_total Delete buffer flushes by result.
+# TYPE shortener_delete_flushes_total counter
+shortener_delete_flushes_total{result="error"} 1
+shortener_delete_flushes_total{result="ok"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(m.deleteFlushes, strings.NewReader(expected)))
+}
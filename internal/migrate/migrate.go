@@ -0,0 +1,292 @@
+// Package migrate moves URLs and user quota overrides between data
+// storages. IDs, owners, deleted state and the id sequence are kept, so the
+// printed short links work with the new data storage.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// chunkSize is the number of records saved in one Import call.
+const chunkSize = 1000
+
+// ErrNotEmpty is returned for destination data storage with URLs.
+var ErrNotEmpty = errors.New("destination data storage is not empty")
+
+// ErrMismatch is returned for destination records different from source.
+var ErrMismatch = errors.New("destination records do not match source")
+
+var errStop = errors.New("stop")
+
+// Report is the migration result.
+type Report struct {
+	Records int  `json:"records"`
+	Deleted int  `json:"deleted"`
+	Users   int  `json:"users"`
+	Quotas  int  `json:"quotas"`
+	NextID  int  `json:"next_id"`
+	DryRun  bool `json:"dry_run"`
+
+	// Verified is set after the destination records are compared with the
+	// source ones.
+	Verified bool `json:"verified"`
+}
+
+// Options are the migration parameters.
+type Options struct {
+	// DryRun reads the source and checks the destination without saving.
+	DryRun bool
+
+	// Verify compares destination records with the source ones after saving.
+	Verify bool
+}
+
+// Run copies the source snapshot with the records and the user quota
+// overrides to empty dst. Source must not be changed during the migration.
+func Run(ctx context.Context, src, dst url.DataKeeper, opts Options) (*Report, error) {
+	empty, err := isEmpty(ctx, dst)
+	if err != nil {
+		return nil, fmt.Errorf("destination: %w", err)
+	}
+	if !empty {
+		return nil, ErrNotEmpty
+	}
+
+	w := &writer{
+		ctx:    ctx,
+		dst:    dst,
+		dryRun: opts.DryRun,
+		report: &Report{DryRun: opts.DryRun},
+		users:  make(map[string]struct{}),
+		chunk:  make([]url.Record, 0, chunkSize),
+	}
+
+	if err = src.Snapshot(ctx, w); err != nil {
+		if w.err != nil {
+			return nil, w.err
+		}
+		return nil, fmt.Errorf("source: %w", err)
+	}
+
+	if err = w.flush(); err != nil {
+		return nil, err
+	}
+
+	report := w.report
+	report.Users = len(w.users)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err = dst.SetNextID(ctx, report.NextID); err != nil {
+		return nil, fmt.Errorf("destination: %w", err)
+	}
+
+	if opts.Verify {
+		if err = Verify(ctx, src, dst); err != nil {
+			return report, err
+		}
+		report.Verified = true
+	}
+
+	return report, nil
+}
+
+// writer saves the source snapshot to the destination in chunks. The
+// destination error is kept in err to tell it from the source one.
+type writer struct {
+	ctx    context.Context
+	dst    url.DataKeeper
+	dryRun bool
+	report *Report
+	users  map[string]struct{}
+	chunk  []url.Record
+	err    error
+}
+
+// WriteNextID implements url.SnapshotWriter interface.
+func (w *writer) WriteNextID(id int) error {
+	w.report.NextID = id
+	return nil
+}
+
+// WriteRecord implements url.SnapshotWriter interface.
+func (w *writer) WriteRecord(r url.Record) error {
+	w.report.Records++
+	if r.Deleted {
+		w.report.Deleted++
+	}
+	w.users[r.UserID] = struct{}{}
+
+	w.chunk = append(w.chunk, r)
+	if len(w.chunk) < chunkSize {
+		return nil
+	}
+
+	return w.flush()
+}
+
+// WriteQuota implements url.SnapshotWriter interface.
+func (w *writer) WriteQuota(userID string, q url.Quota) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	w.report.Quotas++
+	if w.dryRun {
+		return nil
+	}
+
+	if err := w.dst.SetQuota(w.ctx, userID, q); err != nil {
+		w.err = fmt.Errorf("destination quota of user %s: %w", userID, err)
+		return w.err
+	}
+
+	return nil
+}
+
+func (w *writer) flush() error {
+	if len(w.chunk) == 0 || w.dryRun {
+		w.chunk = w.chunk[:0]
+		return nil
+	}
+
+	if err := w.dst.Import(w.ctx, w.chunk); err != nil {
+		w.err = fmt.Errorf("destination after %d records: %w", w.report.Records-len(w.chunk), err)
+		return w.err
+	}
+	w.chunk = w.chunk[:0]
+
+	return nil
+}
+
+// Verify compares all records, the user quota overrides and the id sequence
+// of dst with src. Records are streamed from both data storages in id order.
+func Verify(ctx context.Context, src, dst url.DataKeeper) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dstRecords := make(chan url.Record)
+	dstErr := make(chan error, 1)
+
+	go func() {
+		defer close(dstRecords)
+		dstErr <- dst.Export(ctx, func(r url.Record) error {
+			select {
+			case dstRecords <- r:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	err := src.Export(ctx, func(r url.Record) error {
+		d, ok := <-dstRecords
+		if !ok {
+			if err := <-dstErr; err != nil {
+				return fmt.Errorf("destination: %w", err)
+			}
+			return fmt.Errorf("%w: id %d missing", ErrMismatch, r.ID)
+		}
+		if d != r {
+			return fmt.Errorf("%w: id %d is %+v, want %+v", ErrMismatch, r.ID, d, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if d, ok := <-dstRecords; ok {
+		return fmt.Errorf("%w: extra id %d", ErrMismatch, d.ID)
+	}
+
+	if err = <-dstErr; err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+
+	srcNext, err := src.NextID(ctx)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	dstNext, err := dst.NextID(ctx)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+
+	if dstNext < srcNext {
+		return fmt.Errorf("%w: next id %d, want at least %d", ErrMismatch, dstNext, srcNext)
+	}
+
+	return verifyQuotas(ctx, src, dst)
+}
+
+func verifyQuotas(ctx context.Context, src, dst url.DataKeeper) error {
+	srcQuotas := make(quotaSet)
+	if err := src.Snapshot(ctx, srcQuotas); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	dstQuotas := make(quotaSet)
+	if err := dst.Snapshot(ctx, dstQuotas); err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+
+	for userID, q := range srcQuotas {
+		d, ok := dstQuotas[userID]
+		if !ok {
+			return fmt.Errorf("%w: quota of user %s missing", ErrMismatch, userID)
+		}
+		if d != q {
+			return fmt.Errorf("%w: quota of user %s is %+v, want %+v", ErrMismatch, userID, d, q)
+		}
+	}
+
+	for userID := range dstQuotas {
+		if _, ok := srcQuotas[userID]; !ok {
+			return fmt.Errorf("%w: extra quota of user %s", ErrMismatch, userID)
+		}
+	}
+
+	return nil
+}
+
+// quotaSet collects the user quota overrides from the snapshot.
+type quotaSet map[string]url.Quota
+
+// WriteNextID implements url.SnapshotWriter interface.
+func (s quotaSet) WriteNextID(int) error {
+	return nil
+}
+
+// WriteRecord implements url.SnapshotWriter interface.
+func (s quotaSet) WriteRecord(url.Record) error {
+	return nil
+}
+
+// WriteQuota implements url.SnapshotWriter interface.
+func (s quotaSet) WriteQuota(userID string, q url.Quota) error {
+	s[userID] = q
+	return nil
+}
+
+func isEmpty(ctx context.Context, k url.DataKeeper) (bool, error) {
+	empty := true
+
+	err := k.Export(ctx, func(url.Record) error {
+		empty = false
+		return errStop
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return false, err
+	}
+
+	return empty, nil
+}
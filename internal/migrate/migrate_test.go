@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeeper(t *testing.T) url.DataKeeper {
+	t.Helper()
+
+	k, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+
+	return k
+}
+
+func newSource(t *testing.T, n int) url.DataKeeper {
+	t.Helper()
+
+	ctx := context.Background()
+	k := newKeeper(t)
+
+	for i := 0; i < n; i++ {
+		_, err := k.Add(ctx, fmt.Sprintf("user%d", i%3), "", fmt.Sprintf("http://example.com/%d", i), url.Redirect{})
+		require.NoError(t, err)
+	}
+	_, err := k.DeleteBatch(ctx, map[string][]int{"user0": {1, 4}})
+	require.NoError(t, err)
+	require.NoError(t, k.SetNextID(ctx, n+10))
+	require.NoError(t, k.SetQuota(ctx, "user1", url.Quota{MaxLinks: 5, MaxBatchSize: url.Unlimited}))
+
+	return k
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, chunkSize+5)
+	dst := newKeeper(t)
+
+	report, err := Run(ctx, src, dst, Options{Verify: true})
+	require.NoError(t, err)
+	assert.Equal(t, &Report{Records: chunkSize + 5, Deleted: 2, Users: 3, Quotas: 1, NextID: chunkSize + 15, Verified: true}, report)
+
+	q, err := dst.GetQuota(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, &url.Quota{MaxLinks: 5, MaxBatchSize: url.Unlimited}, q)
+
+	rec, err := dst.Get(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", rec.URL)
+
+	rec, err = dst.Get(ctx, 4)
+	require.NoError(t, err)
+	assert.True(t, rec.Deleted)
+
+	owner, err := dst.GetOwner(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", owner)
+
+	id, err := dst.Add(ctx, "user1", "", "http://example.com/new", url.Redirect{})
+	require.NoError(t, err)
+	assert.Equal(t, chunkSize+15, id)
+
+	_, err = Run(ctx, src, dst, Options{})
+	assert.ErrorIs(t, err, ErrNotEmpty)
+}
+
+func TestRunDryRun(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, 10)
+	dst := newKeeper(t)
+
+	report, err := Run(ctx, src, dst, Options{DryRun: true, Verify: true})
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.False(t, report.Verified)
+	assert.Equal(t, 10, report.Records)
+	assert.Equal(t, 1, report.Quotas)
+
+	empty, err := isEmpty(ctx, dst)
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	q, err := dst.GetQuota(ctx, "user1")
+	require.NoError(t, err)
+	assert.Nil(t, q)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, 10)
+
+	dst := newKeeper(t)
+	_, err := Run(ctx, src, dst, Options{})
+	require.NoError(t, err)
+	assert.NoError(t, Verify(ctx, src, dst))
+
+	_, err = src.Add(ctx, "user1", "", "http://example.com/extra", url.Redirect{})
+	require.NoError(t, err)
+	assert.ErrorIs(t, Verify(ctx, src, dst), ErrMismatch)
+	assert.ErrorIs(t, Verify(ctx, dst, src), ErrMismatch)
+
+	changed := newKeeper(t)
+	_, err = Run(ctx, dst, changed, Options{})
+	require.NoError(t, err)
+	_, err = changed.DeleteBatch(ctx, map[string][]int{"user1": {2}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, Verify(ctx, dst, changed), ErrMismatch)
+
+	quotaChanged := newKeeper(t)
+	_, err = Run(ctx, dst, quotaChanged, Options{})
+	require.NoError(t, err)
+	assert.NoError(t, Verify(ctx, dst, quotaChanged))
+	require.NoError(t, quotaChanged.SetQuota(ctx, "user1", url.Quota{MaxLinks: 6}))
+	assert.ErrorIs(t, Verify(ctx, dst, quotaChanged), ErrMismatch)
+	require.NoError(t, quotaChanged.SetQuota(ctx, "user2", url.Quota{MaxLinks: 6}))
+	assert.ErrorIs(t, Verify(ctx, quotaChanged, dst), ErrMismatch)
+}
@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
+)
+
+type logPublisher struct {
+	log *zap.Logger
+}
+
+// NewLogPublisher returns Publisher that writes events to l. Query values of
+// the event URLs are redacted.
+func NewLogPublisher(l *zap.Logger) Publisher {
+	return logPublisher{log: logger.OrNop(l)}
+}
+
+// Publish logs events.
+func (p logPublisher) Publish(ctx context.Context, events []url.OutboxEvent) error {
+	for _, e := range events {
+		p.log.Info("outbox event",
+			zap.Int64("id", e.ID),
+			zap.String("type", e.Type),
+			zap.String("user", e.UserID),
+			zap.Int("link", e.URLID),
+			logger.URL("url", e.URL),
+		)
+	}
+
+	return nil
+}
+
+type filePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher returns Publisher that appends events to the NDJSON file.
+func NewFilePublisher(path string) (*filePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open outbox file: %w", err)
+	}
+
+	return &filePublisher{file: file}, nil
+}
+
+// Publish writes events to the file, one JSON object per line.
+func (p *filePublisher) Publish(ctx context.Context, events []url.OutboxEvent) error {
+	var buf []byte
+
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("JSON encoding error: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.file.Write(buf); err != nil {
+		return fmt.Errorf("cannot write outbox file: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (p *filePublisher) Close() error {
+	return p.file.Close()
+}
+
+// Enqueuer accepts events for the delivery. Enqueue returns nil only when
+// the event is accepted, so it is not lost after the acknowledgement.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, e url.LinkEvent) error
+}
+
+type forwardPublisher struct {
+	q Enqueuer
+}
+
+// Forward returns Publisher that passes events to Enqueuer.
+func Forward(q Enqueuer) Publisher {
+	return forwardPublisher{q: q}
+}
+
+// Publish forwards events with encoded link IDs. It stops on the first event
+// not accepted, so the batch is not acknowledged and is published again.
+func (f forwardPublisher) Publish(ctx context.Context, events []url.OutboxEvent) error {
+	for i := range events {
+		if err := f.q.Enqueue(ctx, events[i].LinkEvent()); err != nil {
+			return fmt.Errorf("cannot forward event %d: %w", events[i].ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package outbox relays link events saved by DataKeeper to publishers.
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
+)
+
+const batchSize = 100
+
+// Source is the storage of unpublished events.
+type Source interface {
+	FetchOutbox(ctx context.Context, limit int) ([]url.OutboxEvent, error)
+	AckOutbox(ctx context.Context, ids []int64) error
+}
+
+// Publisher delivers events to an integration. Events are acknowledged only
+// after all publishers succeed, so delivery is at-least-once.
+type Publisher interface {
+	Publish(ctx context.Context, events []url.OutboxEvent) error
+}
+
+// Relay drains the outbox into publishers.
+type Relay struct {
+	src        Source
+	interval   time.Duration
+	publishers []Publisher
+	log        *zap.Logger
+	wg         sync.WaitGroup
+}
+
+// NewRelay returns Relay that polls src every interval. Relay errors are
+// logged to l, nil discards them.
+func NewRelay(src Source, interval time.Duration, l *zap.Logger, publishers ...Publisher) *Relay {
+	return &Relay{
+		src:        src,
+		interval:   interval,
+		publishers: publishers,
+		log:        logger.OrNop(l),
+	}
+}
+
+// Start runs relay goroutine until ctx is done.
+func (r *Relay) Start(ctx context.Context) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for r.Drain(ctx) == batchSize {
+				}
+			}
+		}
+	}()
+}
+
+// Wait blocks until relay goroutine is stopped.
+func (r *Relay) Wait() {
+	r.wg.Wait()
+}
+
+// Drain publishes one batch of events and returns number of acknowledged events.
+func (r *Relay) Drain(ctx context.Context) int {
+	events, err := r.src.FetchOutbox(ctx, batchSize)
+	if err != nil {
+		r.log.Error("outbox fetch error", zap.Error(err))
+		return 0
+	}
+
+	if len(events) == 0 {
+		return 0
+	}
+
+	for _, p := range r.publishers {
+		if err = p.Publish(ctx, events); err != nil {
+			r.log.Error("outbox publish error", zap.Error(err))
+			return 0
+		}
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	if err = r.src.AckOutbox(ctx, ids); err != nil {
+		r.log.Error("outbox ack error", zap.Error(err))
+		return 0
+	}
+
+	return len(events)
+}
@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memSource struct {
+	events []url.OutboxEvent
+	acked  []int64
+}
+
+func (s *memSource) FetchOutbox(ctx context.Context, limit int) ([]url.OutboxEvent, error) {
+	if len(s.events) < limit {
+		limit = len(s.events)
+	}
+	return s.events[:limit], nil
+}
+
+func (s *memSource) AckOutbox(ctx context.Context, ids []int64) error {
+	s.acked = append(s.acked, ids...)
+	s.events = s.events[len(ids):]
+	return nil
+}
+
+type failPublisher struct{}
+
+func (failPublisher) Publish(ctx context.Context, events []url.OutboxEvent) error {
+	return errors.New("unavailable")
+}
+
+type memEnqueuer struct {
+	events []url.LinkEvent
+	err    error
+}
+
+func (q *memEnqueuer) Enqueue(ctx context.Context, e url.LinkEvent) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.events = append(q.events, e)
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	events := []url.OutboxEvent{
+		{ID: 1, Type: url.EventLinkCreated, UserID: "user", URLID: 1, URL: "http://a.com"},
+		{ID: 2, Type: url.EventLinkDeleted, UserID: "user", URLID: 1, URL: "http://a.com"},
+	}
+
+	t.Run("failed publisher", func(t *testing.T) {
+		src := &memSource{events: events}
+		r := NewRelay(src, 0, nil, NewLogPublisher(nil), failPublisher{})
+
+		assert.Equal(t, 0, r.Drain(context.Background()))
+		assert.Empty(t, src.acked)
+		assert.Len(t, src.events, 2)
+	})
+
+	t.Run("file publisher", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outbox.ndjson")
+		p, err := NewFilePublisher(path)
+		require.NoError(t, err)
+		defer p.Close()
+
+		src := &memSource{events: events}
+		r := NewRelay(src, 0, nil, p)
+
+		assert.Equal(t, 2, r.Drain(context.Background()))
+		assert.Equal(t, []int64{1, 2}, src.acked)
+		assert.Equal(t, 0, r.Drain(context.Background()))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(t, lines, 2)
+		assert.Contains(t, lines[1], `"type":"link.deleted"`)
+	})
+	t.Run("forward", func(t *testing.T) {
+		q := &memEnqueuer{}
+		src := &memSource{events: events}
+		r := NewRelay(src, 0, nil, Forward(q))
+
+		assert.Equal(t, 2, r.Drain(context.Background()))
+		assert.Equal(t, []int64{1, 2}, src.acked)
+		require.Len(t, q.events, 2)
+		assert.Equal(t, url.EventLinkDeleted, q.events[1].Type)
+	})
+
+	t.Run("forward not accepted", func(t *testing.T) {
+		q := &memEnqueuer{err: context.DeadlineExceeded}
+		src := &memSource{events: events}
+		r := NewRelay(src, 0, nil, Forward(q))
+
+		assert.Equal(t, 0, r.Drain(context.Background()))
+		assert.Empty(t, src.acked)
+		assert.Len(t, src.events, 2)
+	})
+}
@@ -0,0 +1,162 @@
+// Package probe runs the readiness checks of the service dependencies for
+// the HTTP probes and the gRPC health service.
+package probe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Check statuses.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// CheckShutdown is the name of the built-in check failing after Shutdown.
+const CheckShutdown = "shutdown"
+
+// ErrShuttingDown is the error of the shutdown check.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// CheckFunc returns error if the dependency is not ready.
+type CheckFunc func(ctx context.Context) error
+
+// Check is the named readiness check.
+type Check struct {
+	Name string
+	Func CheckFunc
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Report is the outcome of all checks. It passes if every check passes.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether all checks pass.
+func (r Report) Ready() bool {
+	return r.Status == StatusPass
+}
+
+// Checker aggregates the readiness checks.
+type Checker struct {
+	timeout  time.Duration
+	log      *zap.Logger
+	mu       sync.RWMutex
+	checks   []Check
+	shutdown atomic.Bool
+}
+
+// NewChecker returns checker with the shutdown check. Each check is limited
+// by timeout. Check errors are logged to l, they are not reported to
+// clients. nil l discards them.
+func NewChecker(timeout time.Duration, l *zap.Logger) *Checker {
+	c := &Checker{
+		timeout: timeout,
+		log:     logger.OrNop(l),
+	}
+
+	c.Add(Check{Name: CheckShutdown, Func: func(ctx context.Context) error {
+		if c.shutdown.Load() {
+			return ErrShuttingDown
+		}
+		return nil
+	}})
+
+	return c
+}
+
+// Add registers the checks. The report keeps the registration order.
+func (c *Checker) Add(checks ...Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, checks...)
+}
+
+// Shutdown makes the readiness fail so that load balancers stop sending
+// new requests.
+func (c *Checker) Shutdown() {
+	c.shutdown.Store(true)
+}
+
+// Check runs all checks concurrently.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := Report{
+		Status: StatusPass,
+		Checks: make([]Result, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		if r.Status != StatusPass {
+			report.Status = StatusFail
+			break
+		}
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// The check may ignore ctx, its result is not awaited after timeout.
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	latency := time.Since(start)
+
+	r := Result{
+		Name:      check.Name,
+		Status:    StatusPass,
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		r.Status = StatusFail
+		if !errors.Is(err, ErrShuttingDown) {
+			logger.Request(ctx, c.log).Warn("readiness check failed", zap.String("check", check.Name), zap.Error(err))
+		}
+	}
+
+	return r
+}
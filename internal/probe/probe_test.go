@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	pass := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		checks   []Check
+		shutdown bool
+		want     map[string]string
+		ready    bool
+	}{
+		{
+			name:   "ready",
+			checks: []Check{{Name: "keeper", Func: pass}, {Name: "schema", Func: pass}},
+			want:   map[string]string{CheckShutdown: StatusPass, "keeper": StatusPass, "schema": StatusPass},
+			ready:  true,
+		},
+		{
+			name:   "failed check",
+			checks: []Check{{Name: "keeper", Func: fail}, {Name: "schema", Func: pass}},
+			want:   map[string]string{CheckShutdown: StatusPass, "keeper": StatusFail, "schema": StatusPass},
+		},
+		{
+			name:   "timeout",
+			checks: []Check{{Name: "keeper", Func: hang}},
+			want:   map[string]string{CheckShutdown: StatusPass, "keeper": StatusFail},
+		},
+		{
+			name:     "shutdown",
+			checks:   []Check{{Name: "keeper", Func: pass}},
+			shutdown: true,
+			want:     map[string]string{CheckShutdown: StatusFail, "keeper": StatusPass},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(50*time.Millisecond, nil)
+			c.Add(tt.checks...)
+			if tt.shutdown {
+				c.Shutdown()
+			}
+
+			start := time.Now()
+			report := c.Check(context.Background())
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+			assert.Equal(t, tt.ready, report.Ready())
+			require.Len(t, report.Checks, len(tt.want))
+			assert.Equal(t, CheckShutdown, report.Checks[0].Name)
+
+			for _, r := range report.Checks {
+				assert.Equal(t, tt.want[r.Name], r.Status, r.Name)
+				assert.GreaterOrEqual(t, r.LatencyMS, 0.0)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package problem maps errors to RFC 7807 problem details for HTTP and to
+// status codes for gRPC. Both transports share one mapping table.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/requestid"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/webhook"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// ErrorDomain is the google.rpc.ErrorInfo domain.
+const ErrorDomain = "shortener"
+
+// typeBase prefixes the problem type code to build the type URI.
+const typeBase = "/problems/"
+
+// Kind is the class of errors with the same problem type and status.
+type Kind struct {
+	// Code is the stable problem type code.
+	Code string
+
+	// Title is the short human-readable summary.
+	Title string
+
+	// Status is the HTTP status code.
+	Status int
+
+	// GRPCCode is the gRPC status code.
+	GRPCCode codes.Code
+}
+
+// Problem kinds.
+var (
+	Internal            = Kind{"internal", "Internal server error", http.StatusInternalServerError, codes.Internal}
+	BadRequest          = Kind{"bad-request", "Bad request", http.StatusBadRequest, codes.InvalidArgument}
+	InvalidURL          = Kind{"invalid-url", "URL not valid", http.StatusBadRequest, codes.InvalidArgument}
+	InvalidID           = Kind{"invalid-id", "Link ID not valid", http.StatusBadRequest, codes.InvalidArgument}
+	EmptyBatch          = Kind{"empty-batch", "Empty batch", http.StatusBadRequest, codes.InvalidArgument}
+	InvalidQuota        = Kind{"invalid-quota", "Quota not valid", http.StatusBadRequest, codes.InvalidArgument}
+	InvalidWebhook      = Kind{"invalid-webhook", "Webhook endpoint not valid", http.StatusBadRequest, codes.InvalidArgument}
+	UnknownDomain       = Kind{"unknown-domain", "Domain not known", http.StatusBadRequest, codes.InvalidArgument}
+	InvalidRedirect     = Kind{"invalid-redirect", "Redirect not valid", http.StatusBadRequest, codes.InvalidArgument}
+	NotFound            = Kind{"not-found", "Not found", http.StatusNotFound, codes.NotFound}
+	LinkDeleted         = Kind{"link-deleted", "Link deleted", http.StatusGone, codes.FailedPrecondition}
+	Duplicate           = Kind{"duplicate-url", "URL already shortened", http.StatusConflict, codes.AlreadyExists}
+	QuotaExceeded       = Kind{"quota-exceeded", "Quota exceeded", http.StatusForbidden, codes.ResourceExhausted}
+	RateLimited         = Kind{"rate-limited", "Too many requests", http.StatusTooManyRequests, codes.ResourceExhausted}
+	Forbidden           = Kind{"forbidden", "Forbidden", http.StatusForbidden, codes.PermissionDenied}
+	BodyTooLarge        = Kind{"body-too-large", "Request body too large", http.StatusRequestEntityTooLarge, codes.InvalidArgument}
+	UnsupportedEncoding = Kind{"unsupported-encoding", "Unsupported content encoding", http.StatusUnsupportedMediaType, codes.InvalidArgument}
+	Timeout             = Kind{"timeout", "Request timeout", http.StatusServiceUnavailable, codes.DeadlineExceeded}
+)
+
+// table maps errors to kinds. The first matching entry wins.
+var table = []struct {
+	match func(error) bool
+	kind  Kind
+}{
+	{is(url.ErrInvalidURL), InvalidURL},
+	{is(url.ErrInvalidID), InvalidID},
+	{is(url.ErrEmptyBatch), EmptyBatch},
+	{is(url.ErrInvalidQuota), InvalidQuota},
+	{is(url.ErrNotFound), NotFound},
+	{as[*url.ErrURLDeleted], LinkDeleted},
+	{as[*url.ErrURLDuplicate], Duplicate},
+	{as[*url.ErrQuotaExceeded], QuotaExceeded},
+	{is(url.ErrUnknownDomain), UnknownDomain},
+	{is(url.ErrDomainForbidden), Forbidden},
+	{is(url.ErrInvalidRedirect), InvalidRedirect},
+	{is(webhook.ErrInvalidEndpoint), InvalidWebhook},
+	{is(webhook.ErrNotFound), NotFound},
+	{as[*http.MaxBytesError], BodyTooLarge},
+	{is(context.DeadlineExceeded), Timeout},
+}
+
+func is(target error) func(error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+func as[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+// Error is the error of explicit kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns error of the kind wrapping err.
+func New(k Kind, err error) error {
+	return &Error{Kind: k, Err: err}
+}
+
+// Errorf returns error of the kind with formatted message.
+func Errorf(k Kind, format string, a ...any) error {
+	return &Error{Kind: k, Err: fmt.Errorf(format, a...)}
+}
+
+// WithDefault returns err of kind k if err does not match a known kind.
+func WithDefault(k Kind, err error) error {
+	if Classify(err) != Internal {
+		return err
+	}
+
+	return New(k, err)
+}
+
+// Classify returns the kind of err. Unknown errors are Internal.
+func Classify(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	for _, entry := range table {
+		if entry.match(err) {
+			return entry.kind
+		}
+	}
+
+	return Internal
+}
+
+// Details is the RFC 7807 problem details object.
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// FromError returns problem details for err. Messages of server errors are
+// not exposed.
+func FromError(ctx context.Context, err error) *Details {
+	k := Classify(err)
+
+	d := &Details{
+		Type:      typeBase + k.Code,
+		Title:     k.Title,
+		Status:    k.Status,
+		RequestID: requestid.FromContext(ctx),
+	}
+
+	if k.Status < http.StatusInternalServerError {
+		d.Detail = err.Error()
+	}
+
+	return d
+}
+
+// Write writes problem details for err to the response. Server errors are logged.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	d := FromError(r.Context(), err)
+	d.Instance = r.URL.Path
+
+	if d.Status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Error("server error",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Error(err),
+		)
+	}
+
+	body, e := json.Marshal(d)
+	if e != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headers.ContentType, ContentType)
+	w.Header().Set(headers.XContentTypeOptions, "nosniff")
+	w.WriteHeader(d.Status)
+	w.Write(body)
+}
+
+// GRPCStatus returns gRPC status error for err with google.rpc.ErrorInfo,
+// google.rpc.RequestInfo and extra details attached. Messages of server
+// errors are not exposed.
+func GRPCStatus(ctx context.Context, err error, details ...protoiface.MessageV1) error {
+	k := Classify(err)
+	requestID := requestid.FromContext(ctx)
+
+	msg := err.Error()
+	if k.Status >= http.StatusInternalServerError {
+		logger.FromContext(ctx).Error("server error", zap.Error(err))
+		msg = k.Title
+	}
+
+	st := status.New(k.GRPCCode, msg)
+
+	all := []protoiface.MessageV1{&errdetails.ErrorInfo{
+		Reason:   Reason(k),
+		Domain:   ErrorDomain,
+		Metadata: errorMetadata(err),
+	}}
+	if requestID != "" {
+		all = append(all, &errdetails.RequestInfo{RequestId: requestID})
+	}
+	all = append(all, details...)
+
+	withDetails, e := st.WithDetails(all...)
+	if e != nil {
+		logger.FromContext(ctx).Error("gRPC error details error", zap.Error(e))
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// Reason returns the google.rpc.ErrorInfo reason of the kind.
+func Reason(k Kind) string {
+	return strings.ToUpper(strings.ReplaceAll(k.Code, "-", "_"))
+}
+
+func errorMetadata(err error) map[string]string {
+	var errDupl *url.ErrURLDuplicate
+	if errors.As(err, &errDupl) {
+		return map[string]string{"id": errDupl.EncodedID, "url": errDupl.URL}
+	}
+
+	var errQuota *url.ErrQuotaExceeded
+	if errors.As(err, &errQuota) {
+		return map[string]string{"quota": errQuota.Name, "limit": strconv.Itoa(errQuota.Limit)}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/requestid"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "invalid url", err: fmt.Errorf("%w: abc", url.ErrInvalidURL), want: InvalidURL},
+		{name: "not found", err: fmt.Errorf("%w: 1", url.ErrNotFound), want: NotFound},
+		{name: "deleted", err: new(url.ErrURLDeleted), want: LinkDeleted},
+		{name: "quota", err: &url.ErrQuotaExceeded{Name: url.QuotaLinks, Limit: 1}, want: QuotaExceeded},
+		{name: "unknown domain", err: fmt.Errorf("%w: go.brand.com", url.ErrUnknownDomain), want: UnknownDomain},
+		{name: "domain forbidden", err: url.ErrDomainForbidden, want: Forbidden},
+		{name: "invalid redirect", err: fmt.Errorf("%w: code 200", url.ErrInvalidRedirect), want: InvalidRedirect},
+		{name: "explicit", err: Errorf(Forbidden, "no access"), want: Forbidden},
+		{name: "too large", err: fmt.Errorf("read: %w", &http.MaxBytesError{Limit: 1}), want: BodyTooLarge},
+		{name: "unknown", err: errors.New("sql: no rows"), want: Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+
+	assert.Equal(t, BadRequest, Classify(WithDefault(BadRequest, errors.New("unexpected EOF"))))
+	assert.Equal(t, NotFound, Classify(WithDefault(BadRequest, url.ErrNotFound)))
+}
+
+func TestWrite(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "req-1"))
+
+	w := httptest.NewRecorder()
+	Write(w, r, fmt.Errorf("%w: abc", url.ErrNotFound))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+	var d Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.Equal(t, Details{
+		Type:      "/problems/not-found",
+		Title:     "Not found",
+		Status:    http.StatusNotFound,
+		Detail:    "URL not found: abc",
+		Instance:  "/abc",
+		RequestID: "req-1",
+	}, d)
+
+	w = httptest.NewRecorder()
+	Write(w, r, fmt.Errorf("data keeper error: %w", errors.New("connection refused")))
+
+	var internal Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &internal))
+	assert.Equal(t, http.StatusInternalServerError, internal.Status)
+	assert.Empty(t, internal.Detail)
+}
+
+func TestGRPCStatus(t *testing.T) {
+	err := GRPCStatus(context.Background(), new(url.ErrURLDeleted))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	err = GRPCStatus(ctx, &url.ErrURLDuplicate{EncodedID: "4", URL: "http://shortener.com"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	details := status.Convert(err).Details()
+	require.Len(t, details, 2)
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, "DUPLICATE_URL", info.Reason)
+	assert.Equal(t, "4", info.Metadata["id"])
+	assert.Equal(t, "req-1", details[1].(*errdetails.RequestInfo).RequestId)
+
+	err = GRPCStatus(context.Background(), errors.New("connection refused"))
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, Internal.Title, status.Convert(err).Message())
+}
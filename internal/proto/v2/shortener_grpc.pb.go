@@ -0,0 +1,574 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: shortener/v2/shortener.proto
+
+// Version 2 of the Shortener API. Errors are reported only with gRPC status
+// codes and google.rpc error details, responses carry no error fields.
+
+package shortenerv2
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Shortener_GetURL_FullMethodName         = "/shortener.v2.Shortener/GetURL"
+	Shortener_AddURL_FullMethodName         = "/shortener.v2.Shortener/AddURL"
+	Shortener_AddURLBatch_FullMethodName    = "/shortener.v2.Shortener/AddURLBatch"
+	Shortener_GetAllURL_FullMethodName      = "/shortener.v2.Shortener/GetAllURL"
+	Shortener_DeleteURLBatch_FullMethodName = "/shortener.v2.Shortener/DeleteURLBatch"
+	Shortener_SetRedirect_FullMethodName    = "/shortener.v2.Shortener/SetRedirect"
+	Shortener_GetStats_FullMethodName       = "/shortener.v2.Shortener/GetStats"
+	Shortener_PingDB_FullMethodName         = "/shortener.v2.Shortener/PingDB"
+	Shortener_ShortenStream_FullMethodName  = "/shortener.v2.Shortener/ShortenStream"
+	Shortener_ListURLs_FullMethodName       = "/shortener.v2.Shortener/ListURLs"
+	Shortener_ResolveStream_FullMethodName  = "/shortener.v2.Shortener/ResolveStream"
+)
+
+// ShortenerClient is the client API for Shortener service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ShortenerClient interface {
+	GetURL(ctx context.Context, in *GetURLRequest, opts ...grpc.CallOption) (*GetURLResponse, error)
+	AddURL(ctx context.Context, in *AddURLRequest, opts ...grpc.CallOption) (*AddURLResponse, error)
+	AddURLBatch(ctx context.Context, in *AddURLBatchRequest, opts ...grpc.CallOption) (*AddURLBatchResponse, error)
+	GetAllURL(ctx context.Context, in *GetAllURLRequest, opts ...grpc.CallOption) (*GetAllURLResponse, error)
+	DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*DeleteURLBatchResponse, error)
+	SetRedirect(ctx context.Context, in *SetRedirectRequest, opts ...grpc.CallOption) (*SetRedirectResponse, error)
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	PingDB(ctx context.Context, in *PingDBRequest, opts ...grpc.CallOption) (*PingDBResponse, error)
+	ShortenStream(ctx context.Context, opts ...grpc.CallOption) (Shortener_ShortenStreamClient, error)
+	ListURLs(ctx context.Context, in *ListURLsRequest, opts ...grpc.CallOption) (Shortener_ListURLsClient, error)
+	ResolveStream(ctx context.Context, opts ...grpc.CallOption) (Shortener_ResolveStreamClient, error)
+}
+
+type shortenerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShortenerClient(cc grpc.ClientConnInterface) ShortenerClient {
+	return &shortenerClient{cc}
+}
+
+func (c *shortenerClient) GetURL(ctx context.Context, in *GetURLRequest, opts ...grpc.CallOption) (*GetURLResponse, error) {
+	out := new(GetURLResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) AddURL(ctx context.Context, in *AddURLRequest, opts ...grpc.CallOption) (*AddURLResponse, error) {
+	out := new(AddURLResponse)
+	err := c.cc.Invoke(ctx, Shortener_AddURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) AddURLBatch(ctx context.Context, in *AddURLBatchRequest, opts ...grpc.CallOption) (*AddURLBatchResponse, error) {
+	out := new(AddURLBatchResponse)
+	err := c.cc.Invoke(ctx, Shortener_AddURLBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetAllURL(ctx context.Context, in *GetAllURLRequest, opts ...grpc.CallOption) (*GetAllURLResponse, error) {
+	out := new(GetAllURLResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetAllURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) DeleteURLBatch(ctx context.Context, in *DeleteURLBatchRequest, opts ...grpc.CallOption) (*DeleteURLBatchResponse, error) {
+	out := new(DeleteURLBatchResponse)
+	err := c.cc.Invoke(ctx, Shortener_DeleteURLBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetRedirect(ctx context.Context, in *SetRedirectRequest, opts ...grpc.CallOption) (*SetRedirectResponse, error) {
+	out := new(SetRedirectResponse)
+	err := c.cc.Invoke(ctx, Shortener_SetRedirect_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) PingDB(ctx context.Context, in *PingDBRequest, opts ...grpc.CallOption) (*PingDBResponse, error) {
+	out := new(PingDBResponse)
+	err := c.cc.Invoke(ctx, Shortener_PingDB_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) ShortenStream(ctx context.Context, opts ...grpc.CallOption) (Shortener_ShortenStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], Shortener_ShortenStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerShortenStreamClient{stream}
+	return x, nil
+}
+
+type Shortener_ShortenStreamClient interface {
+	Send(*ShortenStreamRequest) error
+	Recv() (*ShortenStreamResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerShortenStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerShortenStreamClient) Send(m *ShortenStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shortenerShortenStreamClient) Recv() (*ShortenStreamResponse, error) {
+	m := new(ShortenStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shortenerClient) ListURLs(ctx context.Context, in *ListURLsRequest, opts ...grpc.CallOption) (Shortener_ListURLsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[1], Shortener_ListURLs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerListURLsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Shortener_ListURLsClient interface {
+	Recv() (*ListURLsResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerListURLsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerListURLsClient) Recv() (*ListURLsResponse, error) {
+	m := new(ListURLsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shortenerClient) ResolveStream(ctx context.Context, opts ...grpc.CallOption) (Shortener_ResolveStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[2], Shortener_ResolveStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerResolveStreamClient{stream}
+	return x, nil
+}
+
+type Shortener_ResolveStreamClient interface {
+	Send(*ResolveStreamRequest) error
+	Recv() (*ResolveStreamResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerResolveStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerResolveStreamClient) Send(m *ResolveStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shortenerResolveStreamClient) Recv() (*ResolveStreamResponse, error) {
+	m := new(ResolveStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ShortenerServer is the server API for Shortener service.
+// All implementations must embed UnimplementedShortenerServer
+// for forward compatibility
+type ShortenerServer interface {
+	GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error)
+	AddURL(context.Context, *AddURLRequest) (*AddURLResponse, error)
+	AddURLBatch(context.Context, *AddURLBatchRequest) (*AddURLBatchResponse, error)
+	GetAllURL(context.Context, *GetAllURLRequest) (*GetAllURLResponse, error)
+	DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*DeleteURLBatchResponse, error)
+	SetRedirect(context.Context, *SetRedirectRequest) (*SetRedirectResponse, error)
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	PingDB(context.Context, *PingDBRequest) (*PingDBResponse, error)
+	ShortenStream(Shortener_ShortenStreamServer) error
+	ListURLs(*ListURLsRequest, Shortener_ListURLsServer) error
+	ResolveStream(Shortener_ResolveStreamServer) error
+	mustEmbedUnimplementedShortenerServer()
+}
+
+// UnimplementedShortenerServer must be embedded to have forward compatible implementations.
+type UnimplementedShortenerServer struct {
+}
+
+func (UnimplementedShortenerServer) GetURL(context.Context, *GetURLRequest) (*GetURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetURL not implemented")
+}
+func (UnimplementedShortenerServer) AddURL(context.Context, *AddURLRequest) (*AddURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddURL not implemented")
+}
+func (UnimplementedShortenerServer) AddURLBatch(context.Context, *AddURLBatchRequest) (*AddURLBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddURLBatch not implemented")
+}
+func (UnimplementedShortenerServer) GetAllURL(context.Context, *GetAllURLRequest) (*GetAllURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllURL not implemented")
+}
+func (UnimplementedShortenerServer) DeleteURLBatch(context.Context, *DeleteURLBatchRequest) (*DeleteURLBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteURLBatch not implemented")
+}
+func (UnimplementedShortenerServer) SetRedirect(context.Context, *SetRedirectRequest) (*SetRedirectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRedirect not implemented")
+}
+func (UnimplementedShortenerServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedShortenerServer) PingDB(context.Context, *PingDBRequest) (*PingDBResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PingDB not implemented")
+}
+func (UnimplementedShortenerServer) ShortenStream(Shortener_ShortenStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ShortenStream not implemented")
+}
+func (UnimplementedShortenerServer) ListURLs(*ListURLsRequest, Shortener_ListURLsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListURLs not implemented")
+}
+func (UnimplementedShortenerServer) ResolveStream(Shortener_ResolveStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ResolveStream not implemented")
+}
+func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
+
+// UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShortenerServer will
+// result in compilation errors.
+type UnsafeShortenerServer interface {
+	mustEmbedUnimplementedShortenerServer()
+}
+
+func RegisterShortenerServer(s grpc.ServiceRegistrar, srv ShortenerServer) {
+	s.RegisterService(&Shortener_ServiceDesc, srv)
+}
+
+func _Shortener_GetURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetURL(ctx, req.(*GetURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_AddURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).AddURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_AddURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).AddURL(ctx, req.(*AddURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_AddURLBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddURLBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).AddURLBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_AddURLBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).AddURLBatch(ctx, req.(*AddURLBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetAllURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAllURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetAllURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetAllURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetAllURL(ctx, req.(*GetAllURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_DeleteURLBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteURLBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).DeleteURLBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_DeleteURLBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).DeleteURLBatch(ctx, req.(*DeleteURLBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetRedirect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRedirectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetRedirect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_SetRedirect_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetRedirect(ctx, req.(*SetRedirectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_PingDB_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingDBRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).PingDB(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_PingDB_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).PingDB(ctx, req.(*PingDBRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_ShortenStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).ShortenStream(&shortenerShortenStreamServer{stream})
+}
+
+type Shortener_ShortenStreamServer interface {
+	Send(*ShortenStreamResponse) error
+	Recv() (*ShortenStreamRequest, error)
+	grpc.ServerStream
+}
+
+type shortenerShortenStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerShortenStreamServer) Send(m *ShortenStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shortenerShortenStreamServer) Recv() (*ShortenStreamRequest, error) {
+	m := new(ShortenStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Shortener_ListURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListURLsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).ListURLs(m, &shortenerListURLsServer{stream})
+}
+
+type Shortener_ListURLsServer interface {
+	Send(*ListURLsResponse) error
+	grpc.ServerStream
+}
+
+type shortenerListURLsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerListURLsServer) Send(m *ListURLsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Shortener_ResolveStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).ResolveStream(&shortenerResolveStreamServer{stream})
+}
+
+type Shortener_ResolveStreamServer interface {
+	Send(*ResolveStreamResponse) error
+	Recv() (*ResolveStreamRequest, error)
+	grpc.ServerStream
+}
+
+type shortenerResolveStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerResolveStreamServer) Send(m *ResolveStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shortenerResolveStreamServer) Recv() (*ResolveStreamRequest, error) {
+	m := new(ResolveStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Shortener_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shortener.v2.Shortener",
+	HandlerType: (*ShortenerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetURL",
+			Handler:    _Shortener_GetURL_Handler,
+		},
+		{
+			MethodName: "AddURL",
+			Handler:    _Shortener_AddURL_Handler,
+		},
+		{
+			MethodName: "AddURLBatch",
+			Handler:    _Shortener_AddURLBatch_Handler,
+		},
+		{
+			MethodName: "GetAllURL",
+			Handler:    _Shortener_GetAllURL_Handler,
+		},
+		{
+			MethodName: "DeleteURLBatch",
+			Handler:    _Shortener_DeleteURLBatch_Handler,
+		},
+		{
+			MethodName: "SetRedirect",
+			Handler:    _Shortener_SetRedirect_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Shortener_GetStats_Handler,
+		},
+		{
+			MethodName: "PingDB",
+			Handler:    _Shortener_PingDB_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ShortenStream",
+			Handler:       _Shortener_ShortenStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListURLs",
+			Handler:       _Shortener_ListURLs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ResolveStream",
+			Handler:       _Shortener_ResolveStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "shortener/v2/shortener.proto",
+}
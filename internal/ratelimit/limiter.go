@@ -0,0 +1,164 @@
+// Package ratelimit is the token bucket rate limiter for the shortener API.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Class is the route class with its own limit rule.
+type Class string
+
+// Route classes.
+const (
+	Shorten  Class = "shorten"
+	Batch    Class = "batch"
+	Redirect Class = "redirect"
+	Delete   Class = "delete"
+)
+
+// Rule is the token bucket parameters. Zero rule means no limit.
+type Rule struct {
+	// Rate is the number of tokens added per second.
+	Rate float64
+
+	// Burst is the bucket capacity.
+	Burst int
+}
+
+// ParseRule parses rule from the "rate:burst" string, e.g. "5:20".
+// Empty string returns zero rule.
+func ParseRule(s string) (Rule, error) {
+	if s == "" {
+		return Rule{}, nil
+	}
+
+	rateStr, burstStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit rule %q not valid: expected rate:burst", s)
+	}
+
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate <= 0 {
+		return Rule{}, fmt.Errorf("rate limit rule %q not valid: wrong rate", s)
+	}
+
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst <= 0 {
+		return Rule{}, fmt.Errorf("rate limit rule %q not valid: wrong burst", s)
+	}
+
+	return Rule{Rate: rate, Burst: burst}, nil
+}
+
+// Result is the outcome of one limiter check.
+type Result struct {
+	// Allowed is false if the request must be rejected.
+	Allowed bool
+
+	// Limit is the bucket capacity.
+	Limit int
+
+	// Remaining is the number of requests left in the bucket.
+	Remaining int
+
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed.
+	RetryAfter time.Duration
+}
+
+// Backend keeps token buckets state. Buckets idle longer than IdleTTL may
+// be removed, they are full again on the next take.
+type Backend interface {
+	Take(ctx context.Context, key string, rule Rule, now time.Time) (*Result, error)
+
+	// Close releases the backend resources.
+	Close() error
+}
+
+// Limiter checks requests against the route class rules.
+type Limiter interface {
+	Allow(ctx context.Context, class Class, key string) (*Result, error)
+}
+
+type limiter struct {
+	backend Backend
+	now     func() time.Time
+
+	mu    sync.RWMutex
+	rules map[Class]Rule
+}
+
+// NewLimiter returns Limiter instance. Classes without rules are not limited.
+func NewLimiter(b Backend, rules map[Class]Rule) *limiter {
+	return &limiter{
+		backend: b,
+		rules:   rules,
+		now:     time.Now,
+	}
+}
+
+// Allow takes one token from the bucket of the key for the class.
+// It returns nil result if the class is not limited.
+func (l *limiter) Allow(ctx context.Context, class Class, key string) (*Result, error) {
+	l.mu.RLock()
+	rule, ok := l.rules[class]
+	l.mu.RUnlock()
+
+	if !ok || rule.Rate <= 0 || rule.Burst <= 0 {
+		return nil, nil
+	}
+
+	res, err := l.backend.Take(ctx, string(class)+":"+key, rule, l.now())
+	if err != nil {
+		return nil, fmt.Errorf("rate limit backend error: %w", err)
+	}
+
+	return res, nil
+}
+
+// SetRules replaces the rules for the next requests. The bucket state is
+// kept, the new rule applies to the tokens left.
+func (l *limiter) SetRules(rules map[Class]Rule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rules = rules
+}
+
+// Refill returns the new bucket state after taking one token at the moment now.
+// It is shared by all backends to keep the same bucket math.
+func Refill(tokens float64, updated time.Time, rule Rule, now time.Time) (float64, *Result) {
+	burst := float64(rule.Burst)
+
+	if updated.IsZero() {
+		tokens = burst
+	} else if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*rule.Rate)
+	}
+
+	res := &Result{Limit: rule.Burst}
+
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / rule.Rate)
+	}
+
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = seconds((burst - tokens) / rule.Rate)
+
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			s:    "0.5:10",
+			want: Rule{Rate: 0.5, Burst: 10},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: Rule{},
+		},
+		{
+			name:    "no burst",
+			s:       "5",
+			wantErr: true,
+		},
+		{
+			name:    "negative rate",
+			s:       "-1:10",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRule(tt.s)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := &limiter{
+		backend: NewMemBackend(),
+		rules:   map[Class]Rule{Shorten: {Rate: 1, Burst: 2}},
+		now:     func() time.Time { return now },
+	}
+
+	res, err := l.Allow(context.Background(), Redirect, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	for i := 1; i >= 0; i-- {
+		res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 2*time.Second, res.Reset)
+
+	res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.2")
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	now = now.Add(time.Second)
+
+	res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestSetRules(t *testing.T) {
+	l := NewLimiter(NewMemBackend(), nil)
+
+	res, err := l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	l.SetRules(map[Class]Rule{Shorten: {Rate: 1, Burst: 1}})
+
+	res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = l.Allow(context.Background(), Shorten, "ip:127.0.0.1")
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
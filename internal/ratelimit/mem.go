@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdleTTL is the time after the last take the bucket may be removed.
+const IdleTTL = 10 * time.Minute
+
+const sweepEvery = 1024
+
+type memBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type memBackend struct {
+	buckets map[string]memBucket
+	takes   int
+	mu      sync.Mutex
+}
+
+// NewMemBackend returns in-memory Backend for a single instance.
+func NewMemBackend() Backend {
+	return &memBackend{buckets: make(map[string]memBucket)}
+}
+
+// Take takes one token from the bucket in memory.
+func (m *memBackend) Take(ctx context.Context, key string, rule Rule, now time.Time) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	b := m.buckets[key]
+
+	tokens, res := Refill(b.tokens, b.updated, rule, now)
+	m.buckets[key] = memBucket{tokens: tokens, updated: now}
+
+	m.takes++
+	if m.takes%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	return res, nil
+}
+
+func (m *memBackend) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > IdleTTL {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Close implements Backend interface, memory backend has nothing to release.
+func (m *memBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package requestid carries request IDs through the request context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Header is the HTTP header and gRPC metadata key of the request ID.
+const Header = "X-Request-ID"
+
+const idCtxKey ctxKey = "request_id"
+
+type ctxKey string
+
+var valid = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// New returns random request ID.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Ensure returns id if it is a valid client-provided request ID, otherwise a new one.
+func Ensure(id string) string {
+	if valid.MatchString(id) {
+		return id
+	}
+
+	return New()
+}
+
+// NewContext returns context with the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idCtxKey, id)
+}
+
+// FromContext returns the request ID or empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idCtxKey).(string)
+	return id
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// withActor returns the middleware saving the request actor with the client
+// address ac resolves, nil ac trusts no proxy headers.
+func withActor(ac *access.Checker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := url.Actor{Transport: url.TransportHTTP}
+			if ip := ac.ClientIP(r.RemoteAddr, r.Header.Values); ip != nil {
+				actor.IP = ip.String()
+			}
+
+			next.ServeHTTP(w, r.WithContext(url.WithActor(r.Context(), actor)))
+		})
+	}
+}
+
+func (h *handler) getAudit() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
+			return
+		}
+
+		events, err := h.urlConverter.QueryAudit(ctx, *filter)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		if events == nil {
+			events = []url.AuditEvent{}
+		}
+
+		jsonRes, err := json.Marshal(events)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		w.Header().Add(headers.ContentType, applicationJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	})
+}
+
+func parseAuditFilter(r *http.Request) (*url.AuditFilter, error) {
+	q := r.URL.Query()
+
+	filter := &url.AuditFilter{
+		UserID: q.Get("user_id"),
+		Action: q.Get("action"),
+		LinkID: q.Get("link_id"),
+	}
+
+	var err error
+
+	if from := q.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, err
+		}
+	}
+
+	if to := q.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, err
+		}
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
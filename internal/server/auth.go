@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/ruskiiamov/shortener/internal/problem"
 	"github.com/ruskiiamov/shortener/internal/user"
 )
 
@@ -26,7 +27,7 @@ func (a *authMiddleware) handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(authCookieName)
 		if err != nil && !errors.Is(err, http.ErrNoCookie) {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -42,7 +43,7 @@ func (a *authMiddleware) handle(next http.Handler) http.Handler {
 			var token string
 			userID, token, err = a.ua.CreateUser()
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Write(w, r, err)
 				return
 			}
 
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/backup"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	// backupTimeout limits the time of the snapshot streaming.
+	backupTimeout = 10 * time.Minute
+
+	trailerHeader = "Trailer"
+
+	// backupChecksumHeader is the HTTP trailer with SHA-256 of the archive lines.
+	backupChecksumHeader = "X-Backup-Sha256"
+)
+
+func (h *handler) backup() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+		defer cancel()
+
+		fileName := fmt.Sprintf("shortener-%s.backup", time.Now().UTC().Format("20060102T150405Z"))
+
+		w.Header().Set(trailerHeader, backupChecksumHeader)
+		bw := &backupWriter{ResponseWriter: w, fileName: fileName}
+
+		m, err := backup.Write(ctx, h.urlConverter, bw)
+		if err != nil {
+			if !bw.started {
+				w.Header().Del(trailerHeader)
+				problem.Write(w, r, err)
+				return
+			}
+			// The archive is broken without the trailer, the client
+			// detects it on verify.
+			logger.FromContext(ctx).Error("backup streaming error", zap.Error(err))
+			return
+		}
+
+		w.Header().Set(backupChecksumHeader, m.SHA256)
+	})
+}
+
+// backupWriter sends the response headers with the first archive bytes so
+// that errors before them are reported as problem details.
+type backupWriter struct {
+	http.ResponseWriter
+	fileName string
+	started  bool
+}
+
+func (b *backupWriter) Write(p []byte) (int, error) {
+	if !b.started {
+		b.started = true
+		b.Header().Set(headers.ContentType, backup.ContentType)
+		b.Header().Set(headers.ContentDisposition, fmt.Sprintf("attachment; filename=%q", b.fileName))
+		b.WriteHeader(http.StatusOK)
+	}
+
+	return b.ResponseWriter.Write(p)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/compress"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	// minCompressSize is the smallest response body worth compressing.
+	minCompressSize = 256
+
+	// maxDecodedBodySize limits decompressed request body.
+	maxDecodedBodySize = 1 << 20
+)
+
+// compressibleTypes lists media types and media type prefixes of compressed responses.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get(headers.ContentEncoding)))
+
+		if contentEncoding != "" && contentEncoding != compress.Identity {
+			if !compress.IsSupported(contentEncoding) {
+				w.Header().Set(headers.AcceptEncoding, strings.Join(compress.Supported(), ", "))
+				problem.Write(w, r, problem.Errorf(problem.UnsupportedEncoding, "content encoding %s not supported", contentEncoding))
+				return
+			}
+
+			dec, err := compress.GetDecoder(contentEncoding, r.Body)
+			if err != nil {
+				problem.Write(w, r, problem.New(problem.BadRequest, err))
+				return
+			}
+			defer compress.PutDecoder(contentEncoding, dec)
+
+			r.Body = http.MaxBytesReader(w, readCloser{Reader: dec, Closer: r.Body}, maxDecodedBodySize)
+			r.Header.Del(headers.ContentEncoding)
+			r.Header.Del(headers.ContentLength)
+			r.ContentLength = -1
+		}
+
+		w.Header().Add(headers.Vary, headers.AcceptEncoding)
+
+		encoding := compress.Negotiate(r.Header.Get(headers.AcceptEncoding))
+		if encoding == compress.Identity || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, log: logger.FromContext(r.Context())}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// compressWriter buffers the beginning of the response body to decide
+// whether the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	enc      compress.Encoder
+	log      *zap.Logger
+}
+
+// WriteHeader implements http.ResponseWriter interface.
+func (w *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	if !compressibleStatus(status) {
+		if err := w.decide(false); err != nil {
+			w.log.Warn("response compression error", zap.Error(err))
+		}
+	}
+}
+
+// Write implements http.ResponseWriter interface.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= minCompressSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush implements http.Flusher interface.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if err := w.decide(true); err != nil {
+			w.log.Warn("response compression error", zap.Error(err))
+			return
+		}
+	}
+
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			w.log.Warn("response compression error", zap.Error(err))
+			return
+		}
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get(headers.ContentType) == "" && len(w.buf) > 0 {
+		h.Set(headers.ContentType, http.DetectContentType(w.buf))
+	}
+
+	if large && compressibleStatus(w.status) && h.Get(headers.ContentEncoding) == "" && compressibleType(h.Get(headers.ContentType)) {
+		enc, err := compress.GetEncoder(w.encoding, w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.enc = enc
+
+		h.Set(headers.ContentEncoding, w.encoding)
+		h.Del(headers.ContentLength)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) close() {
+	if !w.decided && w.status != 0 {
+		if err := w.decide(false); err != nil {
+			w.log.Warn("response compression error", zap.Error(err))
+		}
+	}
+
+	if w.enc == nil {
+		return
+	}
+
+	if err := w.enc.Close(); err != nil {
+		w.log.Warn("response compression error", zap.Error(err))
+	}
+	compress.PutEncoder(w.encoding, w.enc)
+	w.enc = nil
+}
+
+func compressibleStatus(status int) bool {
+	return status >= http.StatusOK && status < http.StatusMultipleChoices &&
+		status != http.StatusNoContent && status != http.StatusPartialContent
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range compressibleTypes {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"url":"http://shortener.com"}`, 20)
+
+	echo := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/redirect":
+			w.Header().Set(headers.Location, "http://shortener.com")
+			w.WriteHeader(http.StatusTemporaryRedirect)
+		case "/image":
+			w.Header().Set(headers.ContentType, "image/png")
+			w.Write([]byte(large))
+		default:
+			w.Header().Set(headers.ContentType, "application/json")
+			w.Write(body)
+		}
+	}))
+
+	encode := func(encoding, s string) io.Reader {
+		var buf bytes.Buffer
+		e, err := compress.GetEncoder(encoding, &buf)
+		require.NoError(t, err)
+		io.WriteString(e, s)
+		require.NoError(t, e.Close())
+		return &buf
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		body            io.Reader
+		contentEncoding string
+		acceptEncoding  string
+		wantStatus      int
+		wantEncoding    string
+	}{
+		{name: "large body", path: "/", body: strings.NewReader(large), acceptEncoding: "gzip, br", wantStatus: http.StatusOK, wantEncoding: compress.Brotli},
+		{name: "small body", path: "/", body: strings.NewReader(`{}`), acceptEncoding: "gzip", wantStatus: http.StatusOK},
+		{name: "no accept", path: "/", body: strings.NewReader(large), wantStatus: http.StatusOK},
+		{name: "redirect", path: "/redirect", acceptEncoding: "gzip", wantStatus: http.StatusTemporaryRedirect},
+		{name: "image", path: "/image", acceptEncoding: "gzip", wantStatus: http.StatusOK},
+		{name: "zstd request", path: "/", body: encode(compress.Zstd, large), contentEncoding: "zstd", acceptEncoding: "deflate", wantStatus: http.StatusOK, wantEncoding: compress.Deflate},
+		{name: "unsupported request", path: "/", body: strings.NewReader(large), contentEncoding: "compress", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "broken request", path: "/", body: strings.NewReader(large), contentEncoding: "gzip", wantStatus: http.StatusBadRequest},
+		{name: "zip bomb", path: "/", body: encode(compress.Gzip, strings.Repeat("a", maxDecodedBodySize+1)), contentEncoding: "gzip", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, tt.body)
+			r.Header.Set(headers.ContentEncoding, tt.contentEncoding)
+			r.Header.Set(headers.AcceptEncoding, tt.acceptEncoding)
+			w := httptest.NewRecorder()
+
+			echo.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantEncoding, w.Header().Get(headers.ContentEncoding))
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body io.Reader = w.Body
+			if tt.wantEncoding != "" {
+				d, err := compress.GetDecoder(tt.wantEncoding, w.Body)
+				require.NoError(t, err)
+				body = d
+			}
+
+			decoded, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.NotEmpty(t, decoded)
+		})
+	}
+}
+
+func TestCompressMiddlewareConcurrent(t *testing.T) {
+	h := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.ContentType, "text/plain")
+		io.WriteString(w, strings.Repeat(r.URL.Path, 500))
+	}))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set(headers.AcceptEncoding, "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			d, err := compress.GetDecoder(compress.Gzip, w.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, err := io.ReadAll(d)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Repeat(path, 500), string(body))
+		}(strings.Repeat("/x", i+1))
+	}
+
+	wg.Wait()
+}
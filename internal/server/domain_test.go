@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomains(t *testing.T) {
+	ua := new(mockedUserAuth)
+	uc := new(mockedConverter)
+
+	domains := url.NewDomains(
+		url.Domain{BaseURL: testBaseURL},
+		url.Domain{
+			Name:         "go.brand.com",
+			BaseURL:      "https://go.brand.com",
+			RedirectCode: http.StatusMovedPermanently,
+			NotFoundPage: []byte("<h1>Not here</h1>"),
+		},
+	)
+
+	h, err := NewHandler(context.Background(), ua, uc, nil, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), domains, nil, nil, nil)
+	require.NoError(t, err)
+
+	const (
+		userID     = "cfb31f30-efa9-4244-b1d6-e04c8438771d"
+		authCookie = "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ="
+	)
+	ua.On("CreateUser").Return(userID, authCookie, nil)
+	ua.On("GetUserID", authCookie).Return(userID, nil)
+
+	uc.On("Visit", mock.Anything, "go.brand.com", "1").Return(&url.URL{EncodedID: "1", Original: "http://shortener.com", Redirect: url.Redirect{Code: http.StatusMovedPermanently}}, nil).Once()
+	uc.On("Visit", mock.Anything, "go.brand.com", "2").Return((*url.URL)(nil), fmt.Errorf("%w: 2", url.ErrNotFound)).Once()
+	uc.On("Visit", mock.Anything, "", "1").Return(&url.URL{EncodedID: "1", Original: "http://shortener.com", Redirect: url.Redirect{Code: http.StatusTemporaryRedirect}}, nil).Once()
+	uc.On("Shorten", mock.Anything, userID, "go.brand.com", "http://shortener.com", url.Redirect{}).Return(&url.URL{EncodedID: "1", Domain: "go.brand.com"}, nil).Once()
+
+	serve := func(method, target, host string, body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, body)
+		r.Host = host
+		r.AddCookie(&http.Cookie{Name: authCookieName, Value: authCookie})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/1", "GO.brand.com:443", nil)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "http://shortener.com", w.Header().Get("Location"))
+
+	w = serve(http.MethodGet, "/2", "go.brand.com", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, textHTML, w.Header().Get("Content-Type"))
+	assert.Equal(t, "<h1>Not here</h1>", w.Body.String())
+
+	w = serve(http.MethodGet, "/1", "other.com", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	w = serve(http.MethodPost, "/?domain=go.brand.com", "127.0.0.1:8080", bytes.NewBufferString("http://shortener.com"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "https://go.brand.com/1", strings.TrimSpace(w.Body.String()))
+
+	uc.AssertExpectations(t)
+}
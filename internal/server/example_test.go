@@ -13,14 +13,14 @@ import (
 )
 
 func Example() {
-	dataKeeper, err := data.NewKeeper("", "")
+	dataKeeper, err := data.NewKeeper("", "", nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	userAuthorizer := user.NewAuthorizer([]byte("secret"))
-	urlConverter := url.NewConverter(dataKeeper)
-	delBuf := url.StartDeleteURL(context.Background(), urlConverter)
+	urlConverter := url.NewConverter(dataKeeper, url.Quota{}, nil, nil, nil, nil)
+	delBuf, _ := url.StartDeleteURL(context.Background(), urlConverter, nil, nil, nil)
 
 	router := chi.NewRouter()
 
@@ -28,10 +28,14 @@ func Example() {
 		context.Background(),
 		userAuthorizer,
 		urlConverter,
+		nil,
+		nil,
 		router,
 		delBuf,
-		"http://localhost:8080",
-		"",
+		url.NewDomains(url.Domain{BaseURL: "http://localhost:8080"}),
+		nil,
+		nil,
+		nil,
 	)
 	if err != nil {
 		panic(err)
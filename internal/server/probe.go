@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/ruskiiamov/shortener/internal/probe"
+)
+
+// Probe routes.
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+func isProbePath(path string) bool {
+	return path == healthzPath || path == readyzPath
+}
+
+// healthz reports that the process serves requests. It does not check the
+// dependencies, so a storage outage does not restart the service.
+func (h *handler) healthz() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, probe.Report{Status: probe.StatusPass, Checks: []probe.Result{}})
+	})
+}
+
+// readyz reports the readiness checks with 503 status if any check fails.
+func (h *handler) readyz() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.readiness.Check(r.Context())
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, r, status, report)
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/probe"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	ua := new(mockedUserAuth)
+	ua.On("CreateUser").Return("cfb31f30-efa9-4244-b1d6-e04c8438771d", "token", nil)
+
+	var keeperErr error
+	rc := probe.NewChecker(time.Second, nil)
+	rc.Add(probe.Check{Name: "keeper", Func: func(ctx context.Context) error { return keeperErr }})
+
+	h, err := NewHandler(context.Background(), ua, new(mockedConverter), nil, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), url.NewDomains(url.Domain{BaseURL: testBaseURL}), nil, rc, nil)
+	require.NoError(t, err)
+
+	get := func(path string) (int, probe.Report) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var report probe.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+
+		return w.Code, report
+	}
+
+	status, report := get(healthzPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probe.StatusPass, report.Status)
+
+	status, report = get(readyzPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probe.StatusPass, report.Status)
+	assert.Len(t, report.Checks, 2)
+
+	keeperErr = errors.New("connection refused")
+	status, report = get(readyzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, probe.StatusFail, report.Status)
+
+	keeperErr = nil
+	rc.Shutdown()
+	status, _ = get(readyzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	status, _ = get(healthzPath)
+	assert.Equal(t, http.StatusOK, status)
+}
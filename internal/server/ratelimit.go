@@ -0,0 +1,123 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/user"
+)
+
+const (
+	rateLimitLimit     = "RateLimit-Limit"
+	rateLimitRemaining = "RateLimit-Remaining"
+	rateLimitReset     = "RateLimit-Reset"
+	retryAfter         = "Retry-After"
+)
+
+type rateLimitMiddleware struct {
+	limiter ratelimit.Limiter
+	ua      user.Authorizer
+	checker *access.Checker
+}
+
+// newRateLimitMiddleware returns the middleware limiting anonymous clients
+// by the address ac resolves, nil ac trusts no proxy headers.
+func newRateLimitMiddleware(l ratelimit.Limiter, ua user.Authorizer, ac *access.Checker) *rateLimitMiddleware {
+	return &rateLimitMiddleware{
+		limiter: l,
+		ua:      ua,
+		checker: ac,
+	}
+}
+
+// handle runs before auth, so limited clients without a valid token do not
+// mint new users.
+func (rl *rateLimitMiddleware) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		class, ok := routeClass(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, err := rl.limiter.Allow(r.Context(), class, rl.clientKey(r))
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		if res == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(rateLimitLimit, strconv.Itoa(res.Limit))
+		w.Header().Set(rateLimitRemaining, strconv.Itoa(res.Remaining))
+		w.Header().Set(rateLimitReset, ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			w.Header().Set(retryAfter, ceilSeconds(res.RetryAfter))
+			problem.Write(w, r, problem.Errorf(problem.RateLimited, "rate limit exceeded, retry after %ss", ceilSeconds(res.RetryAfter)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *rateLimitMiddleware) clientKey(r *http.Request) string {
+	if cookie, err := r.Cookie(authCookieName); err == nil {
+		if userID, err := rl.ua.GetUserID(cookie.Value); err == nil {
+			return "user:" + userID
+		}
+	}
+
+	if ip := rl.checker.ClientIP(r.RemoteAddr, r.Header.Values); ip != nil {
+		return "ip:" + ip.String()
+	}
+
+	return "ip:" + r.RemoteAddr
+}
+
+func routeClass(r *http.Request) (ratelimit.Class, bool) {
+	switch {
+	case r.Method == http.MethodPost && (r.URL.Path == "/" || r.URL.Path == "/api/shorten"):
+		return ratelimit.Shorten, true
+	case r.Method == http.MethodPost && r.URL.Path == "/api/shorten/batch":
+		return ratelimit.Batch, true
+	case r.Method == http.MethodDelete && r.URL.Path == "/api/user/urls":
+		return ratelimit.Delete, true
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && isRedirectPath(r.URL.Path):
+		return ratelimit.Redirect, true
+	}
+
+	return "", false
+}
+
+func isRedirectPath(path string) bool {
+	if len(path) < 2 || path[0] != '/' {
+		return false
+	}
+
+	for _, c := range path[1:] {
+		if c == '/' {
+			return false
+		}
+	}
+
+	return path != "/ping" && !isProbePath(path)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
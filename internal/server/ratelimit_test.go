@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	ua := new(mockedUserAuth)
+	uc := new(mockedConverter)
+
+	rl := ratelimit.NewLimiter(ratelimit.NewMemBackend(), map[ratelimit.Class]ratelimit.Rule{
+		ratelimit.Redirect: {Rate: 0.001, Burst: 1},
+	})
+
+	h, err := NewHandler(context.Background(), ua, uc, rl, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), url.NewDomains(url.Domain{BaseURL: testBaseURL}), nil, nil, nil)
+	require.NoError(t, err)
+
+	rts := httptest.NewServer(h)
+	defer rts.Close()
+
+	ua.On("CreateUser").Return(
+		"cfb31f30-efa9-4244-b1d6-e04c8438771d",
+		"XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
+		nil,
+	).Once()
+	uc.On("Visit", mock.Anything, "", "1").Return(&url.URL{EncodedID: "1", Original: "http://shortener.com", Redirect: url.Redirect{Code: http.StatusTemporaryRedirect}}, nil).Once()
+
+	statusCode, _, header := testRequest(t, rts, http.MethodGet, "/1", nil, nil, nil)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, statusCode)
+	assert.Equal(t, "1", header.Get(rateLimitLimit))
+	assert.Equal(t, "0", header.Get(rateLimitRemaining))
+
+	statusCode, _, header = testRequest(t, rts, http.MethodGet, "/1", nil, nil, nil)
+
+	ua.AssertExpectations(t)
+	uc.AssertExpectations(t)
+
+	assert.Equal(t, http.StatusTooManyRequests, statusCode)
+	assert.Equal(t, "1000", header.Get(retryAfter))
+
+	// Address headers of clients other than trusted proxies are ignored.
+	spoofed := http.Header{}
+	spoofed.Set(xRealIP, "10.0.0.1")
+	statusCode, _, _ = testRequest(t, rts, http.MethodGet, "/1", nil, nil, &spoofed)
+	assert.Equal(t, http.StatusTooManyRequests, statusCode)
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	ua := new(mockedUserAuth)
+	uc := new(mockedConverter)
+
+	rl := ratelimit.NewLimiter(ratelimit.NewMemBackend(), map[ratelimit.Class]ratelimit.Rule{
+		ratelimit.Redirect: {Rate: 0.001, Burst: 1},
+	})
+
+	ac, err := access.NewChecker("", "127.0.0.1")
+	require.NoError(t, err)
+
+	h, err := NewHandler(context.Background(), ua, uc, rl, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), url.NewDomains(url.Domain{BaseURL: testBaseURL}), ac, nil, nil)
+	require.NoError(t, err)
+
+	rts := httptest.NewServer(h)
+	defer rts.Close()
+
+	ua.On("CreateUser").Return(
+		"cfb31f30-efa9-4244-b1d6-e04c8438771d",
+		"XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
+		nil,
+	)
+	uc.On("Visit", mock.Anything, "", "1").Return(&url.URL{EncodedID: "1", Original: "http://shortener.com", Redirect: url.Redirect{Code: http.StatusTemporaryRedirect}}, nil)
+
+	for _, tt := range []struct {
+		ip     string
+		status int
+	}{
+		{ip: "10.0.0.1", status: http.StatusTemporaryRedirect},
+		{ip: "10.0.0.2", status: http.StatusTemporaryRedirect},
+		{ip: "10.0.0.1", status: http.StatusTooManyRequests},
+	} {
+		header := http.Header{}
+		header.Set(xRealIP, tt.ip)
+		statusCode, _, _ := testRequest(t, rts, http.MethodGet, "/1", nil, nil, &header)
+		assert.Equal(t, tt.status, statusCode, tt.ip)
+	}
+}
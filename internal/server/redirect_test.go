@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		lookup       string
+		host         string
+		redirect     url.Redirect
+		status       int
+		cacheControl string
+	}{
+		{
+			name:     "default",
+			method:   http.MethodGet,
+			lookup:   "Visit",
+			redirect: url.Redirect{Code: http.StatusTemporaryRedirect},
+			status:   http.StatusTemporaryRedirect,
+		},
+		{
+			name:     "permanent",
+			method:   http.MethodGet,
+			lookup:   "Visit",
+			redirect: url.Redirect{Code: http.StatusPermanentRedirect},
+			status:   http.StatusPermanentRedirect,
+		},
+		{
+			name:         "campaign",
+			method:       http.MethodGet,
+			lookup:       "Visit",
+			redirect:     url.Redirect{Code: http.StatusFound, CacheControl: "no-store"},
+			status:       http.StatusFound,
+			cacheControl: "no-store",
+		},
+		{
+			name:     "domain",
+			method:   http.MethodGet,
+			lookup:   "Visit",
+			host:     "go.brand.com",
+			redirect: url.Redirect{Code: http.StatusMovedPermanently},
+			status:   http.StatusMovedPermanently,
+		},
+		{
+			name:         "head",
+			method:       http.MethodHead,
+			lookup:       "GetOriginal",
+			redirect:     url.Redirect{Code: http.StatusMovedPermanently, CacheControl: "max-age=3600"},
+			status:       http.StatusMovedPermanently,
+			cacheControl: "max-age=3600",
+		},
+	}
+
+	domains := url.NewDomains(
+		url.Domain{BaseURL: testBaseURL},
+		url.Domain{Name: "go.brand.com", BaseURL: "https://go.brand.com", RedirectCode: http.StatusMovedPermanently},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ua := new(mockedUserAuth)
+			uc := new(mockedConverter)
+
+			h, err := NewHandler(context.Background(), ua, uc, nil, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), domains, nil, nil, nil)
+			require.NoError(t, err)
+
+			ua.On("CreateUser").Return(
+				"cfb31f30-efa9-4244-b1d6-e04c8438771d",
+				"XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
+				nil,
+			)
+			uc.On(tt.lookup, mock.Anything, domains.Resolve(tt.host).Name, "1").Return(&url.URL{
+				EncodedID: "1",
+				Original:  "http://shortener.com",
+				Redirect:  tt.redirect,
+			}, nil).Once()
+
+			r := httptest.NewRequest(tt.method, "/1", nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			uc.AssertExpectations(t)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "http://shortener.com", w.Header().Get("Location"))
+			assert.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestSetRedirect(t *testing.T) {
+	const (
+		userID     = "cfb31f30-efa9-4244-b1d6-e04c8438771d"
+		authCookie = "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ="
+	)
+
+	tests := []struct {
+		name     string
+		body     string
+		redirect url.Redirect
+		res      *url.URL
+		err      error
+		status   int
+		want     string
+	}{
+		{
+			name:     "ok",
+			body:     `{"redirect_code":302,"cache_control":"no-store"}`,
+			redirect: url.Redirect{Code: http.StatusFound, CacheControl: "no-store"},
+			res: &url.URL{
+				EncodedID: "1",
+				Original:  "http://shortener.com",
+				Redirect:  url.Redirect{Code: http.StatusFound, CacheControl: "no-store"},
+			},
+			status: http.StatusOK,
+			want:   `{"short_url":"http://127.0.0.1:8080/1","original_url":"http://shortener.com","redirect_code":302,"cache_control":"no-store"}`,
+		},
+		{
+			name:     "not valid",
+			body:     `{"redirect_code":200}`,
+			redirect: url.Redirect{Code: http.StatusOK},
+			res:      nil,
+			err:      url.ErrInvalidRedirect,
+			status:   http.StatusBadRequest,
+			want:     "/problems/invalid-redirect",
+		},
+		{
+			name:     "not found",
+			body:     `{}`,
+			redirect: url.Redirect{},
+			res:      nil,
+			err:      url.ErrNotFound,
+			status:   http.StatusNotFound,
+			want:     "/problems/not-found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ua := new(mockedUserAuth)
+			uc := new(mockedConverter)
+
+			h, err := NewHandler(context.Background(), ua, uc, nil, nil, chi.NewRouter(), make(chan *url.DelBatch, 1), url.NewDomains(url.Domain{BaseURL: testBaseURL}), nil, nil, nil)
+			require.NoError(t, err)
+
+			ua.On("GetUserID", authCookie).Return(userID, nil)
+			uc.On("SetRedirect", mock.Anything, userID, "1", tt.redirect).Return(tt.res, tt.err).Once()
+
+			r := httptest.NewRequest(http.MethodPatch, "/api/user/urls/1", bytes.NewBufferString(tt.body))
+			r.AddCookie(&http.Cookie{Name: authCookieName, Value: authCookie})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			uc.AssertExpectations(t)
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.err != nil {
+				var p problem.Details
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+				assert.Equal(t, tt.want, p.Type)
+				return
+			}
+
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/requestid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type requestLogger struct {
+	log *zap.Logger
+}
+
+func newRequestLogger(l *zap.Logger) *requestLogger {
+	return &requestLogger{log: logger.OrNop(l)}
+}
+
+// handle accepts the client request ID or generates a new one and echoes it
+// in the response header. The request logger with the ID is put to the
+// context, the request is logged when it is served. Query values are
+// redacted, they may carry tokens.
+func (rl *requestLogger) handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestid.Ensure(r.Header.Get(requestid.Header))
+		w.Header().Set(requestid.Header, id)
+
+		l := rl.log.With(zap.String("request_id", id))
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			l = l.With(zap.String("trace_id", sc.TraceID().String()))
+		}
+
+		ctx := requestid.NewContext(r.Context(), id)
+		ctx = logger.NewContext(ctx, l)
+
+		aw := &accessWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r.WithContext(ctx))
+
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", aw.status),
+			zap.Int("bytes", aw.bytes),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remote_addr", r.RemoteAddr),
+		}
+		if r.URL.RawQuery != "" {
+			fields = append(fields, zap.String("query", logger.RedactQuery(r.URL.RawQuery)))
+		}
+
+		// Probes come every few seconds, they are logged on debug level.
+		if isProbePath(r.URL.Path) {
+			l.Debug("http request", fields...)
+			return
+		}
+
+		l.Info("http request", fields...)
+	})
+}
+
+// accessWriter keeps the response status code and body size.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+
+	return n, err
+}
+
+// Flush implements http.Flusher interface.
+func (w *accessWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer for http.ResponseController.
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+
+	h := newRequestLogger(zap.New(core)).handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("handler")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		name     string
+		clientID string
+	}{
+		{name: "client id", clientID: "client-1"},
+		{name: "generated id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+
+			r := httptest.NewRequest(http.MethodGet, "/abc?token=secret&page=2", nil)
+			r.Header.Set(requestid.Header, tt.clientID)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			id := w.Header().Get(requestid.Header)
+			if tt.clientID != "" {
+				assert.Equal(t, tt.clientID, id)
+			} else {
+				assert.NotEmpty(t, id)
+			}
+
+			entries := logs.AllUntimed()
+			require.Len(t, entries, 2)
+
+			for _, e := range entries {
+				assert.Equal(t, id, e.ContextMap()["request_id"])
+			}
+
+			access := entries[1].ContextMap()
+			assert.Equal(t, "/abc", access["path"])
+			assert.Equal(t, "page=REDACTED&token=REDACTED", access["query"])
+			assert.EqualValues(t, http.StatusCreated, access["status"])
+			assert.EqualValues(t, 2, access["bytes"])
+		})
+	}
+}
@@ -5,15 +5,23 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/probe"
+	"github.com/ruskiiamov/shortener/internal/ratelimit"
+	"github.com/ruskiiamov/shortener/internal/tracing"
 	"github.com/ruskiiamov/shortener/internal/url"
 	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/ruskiiamov/shortener/internal/webhook"
+	"go.uber.org/zap"
 )
 
 // Router is used by server to set all handlers and middlewares.
 type Router interface {
 	http.Handler
 	GET(pattern string, handler http.Handler)
+	HEAD(pattern string, handler http.Handler)
 	POST(pattern string, handler http.Handler)
+	PATCH(pattern string, handler http.Handler)
 	DELETE(pattern string, handler http.Handler)
 	GetURLParam(r *http.Request, key string) string
 	AddMiddlewares(middlewares ...func(http.Handler) http.Handler)
@@ -22,8 +30,10 @@ type Router interface {
 type handler struct {
 	router       Router
 	urlConverter url.Converter
-	baseURL      string
+	webhooks     webhook.Service
+	domains      *url.Domains
 	delBuf       chan *url.DelBatch
+	readiness    *probe.Checker
 }
 
 // ServeHTTP is the method of the http.Handler interface.
@@ -31,34 +41,58 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
 }
 
-// NewHandler returns handler mux for HTTP server
-func NewHandler(ctx context.Context, ua user.Authorizer, uc url.Converter, r Router, delBuf chan *url.DelBatch, baseURL, cidr string) (*handler, error) {
+// NewHandler returns handler mux for HTTP server. Rate limiting is disabled
+// if rl is nil, webhook routes are not registered if wh is nil. Internal
+// routes are forbidden if ac is nil. Client addresses of rate limiting and
+// audit are taken from headers of the trusted proxies of ac only. The
+// readiness route is not registered if rc is nil. Short URLs are built with
+// the base URLs of dm. Requests are logged to l, nil discards the log.
+func NewHandler(ctx context.Context, ua user.Authorizer, uc url.Converter, rl ratelimit.Limiter, wh webhook.Service, r Router, delBuf chan *url.DelBatch, dm *url.Domains, ac *access.Checker, rc *probe.Checker, l *zap.Logger) (*handler, error) {
 	h := &handler{
 		router:       r,
 		urlConverter: uc,
-		baseURL:      baseURL,
+		webhooks:     wh,
+		domains:      dm,
 		delBuf:       delBuf,
-	}
-
-	err := setCIDR(cidr)
-	if err != nil {
-		return nil, err
+		readiness:    rc,
 	}
 
 	h.router.AddMiddlewares(
-		trustedSubnet,
-		gzipCompress,
-		newAuthMiddleware(ua).handle,
+		tracing.WrapMiddleware("request_id", newRequestLogger(l).handle),
+		tracing.WrapMiddleware("trusted_subnet", newTrustedSubnet(ac).handle),
+		tracing.WrapMiddleware("actor", withActor(ac)),
+		tracing.WrapMiddleware("rate_limit", newRateLimitMiddleware(rl, ua, ac).handle),
+		tracing.WrapMiddleware("compress", compressMiddleware),
+		tracing.WrapMiddleware("auth", newAuthMiddleware(ua).handle),
 	)
 
 	h.router.GET("/{id}", h.getURL())
+	h.router.HEAD("/{id}", h.getURL())
 	h.router.POST("/", h.addURL())
 	h.router.POST("/api/shorten", h.addURLFromJSON())
 	h.router.POST("/api/shorten/batch", h.addURLBatch())
 	h.router.GET("/api/user/urls", h.getAllURL())
 	h.router.DELETE("/api/user/urls", h.deleteURLBatch())
+	h.router.PATCH("/api/user/urls/{id}", h.setRedirect())
+	h.router.GET("/api/user/quota", h.getQuota())
 	h.router.GET("/api/internal/stats", h.stats())
+	h.router.POST("/api/internal/quota", h.setQuota())
+	h.router.GET("/api/internal/audit", h.getAudit())
+	h.router.POST("/api/internal/backup", h.backup())
 	h.router.GET("/ping", h.pingDB())
+	h.router.GET(healthzPath, h.healthz())
+
+	if rc != nil {
+		h.router.GET(readyzPath, h.readyz())
+	}
+
+	if wh != nil {
+		h.router.POST("/api/user/webhooks", h.addWebhook())
+		h.router.GET("/api/user/webhooks", h.getWebhooks())
+		h.router.DELETE("/api/user/webhooks/{id}", h.deleteWebhook())
+		h.router.GET("/api/user/webhooks/deliveries", h.getWebhookDeliveries())
+		h.router.GET("/api/user/webhooks/dead-letters", h.getWebhookDeadLetters())
+	}
 
 	return h, nil
 }
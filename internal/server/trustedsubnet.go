@@ -1,59 +1,38 @@
 package server
 
 import (
-	"fmt"
-	"net"
 	"net/http"
-	"regexp"
+	"strings"
+
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/problem"
 )
 
-const xRealIP = "X-Real-IP"
+const xRealIP = access.RealIPHeader
 
-var subnet *net.IPNet
+// internalPrefix is the path prefix of the routes for trusted subnets only.
+const internalPrefix = "/api/internal/"
 
-func setCIDR(cidr string) error {
-	if cidr == "" {
-		return nil
-	}
-	_, s, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return err
-	}
-	subnet = s
+type trustedSubnet struct {
+	checker *access.Checker
+}
 
-	return nil
+func newTrustedSubnet(ac *access.Checker) *trustedSubnet {
+	return &trustedSubnet{checker: ac}
 }
 
-func trustedSubnet(next http.Handler) http.Handler {
+func (t *trustedSubnet) handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		match, err := regexp.MatchString("^/api/internal", r.URL.Path)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if !match {
+		if !strings.HasPrefix(r.URL.Path, internalPrefix) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		if subnet == nil {
-			http.Error(w, "trsusted subnet not set", http.StatusForbidden)
-			return
-		}
-
-		ipStr := r.Header.Get(xRealIP)
-		ip := net.ParseIP(ipStr)
-		if ip == nil {
-			http.Error(w, "header X-Real-IP is empty", http.StatusForbidden)
-			return
-		}
-
-		if subnet.Contains(ip) {
-			next.ServeHTTP(w, r)
+		if err := t.checker.Check(r.RemoteAddr, r.Header.Values); err != nil {
+			problem.Write(w, r, err)
 			return
 		}
 
-		http.Error(w, fmt.Sprintf("trusted subnet does not contain IP %s", ip), http.StatusForbidden)
+		next.ServeHTTP(w, r)
 	})
 }
@@ -9,13 +9,24 @@ import (
 	"time"
 
 	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/problem"
 	"github.com/ruskiiamov/shortener/internal/url"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const applicationJSON = "application/json"
+const (
+	applicationJSON = "application/json"
+	textHTML        = "text/html; charset=utf-8"
+
+	// domainParam is the query parameter with the domain of the created
+	// links, empty means the default domain.
+	domainParam = "domain"
+)
 
 type requestData struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Domain string `json:"domain,omitempty"`
+	url.Redirect
 }
 
 type responseData struct {
@@ -35,6 +46,12 @@ type responseBatch struct {
 type responseAll struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	url.Redirect
+}
+
+type requestQuota struct {
+	UserID string `json:"user_id"`
+	url.Quota
 }
 
 type responseStats struct {
@@ -48,19 +65,31 @@ func (h *handler) getURL() http.HandlerFunc {
 		defer cancel()
 
 		id := h.router.GetURLParam(r, "id")
+		domain := h.domains.Resolve(r.Host)
+
+		// HEAD requests check the link without the click.
+		lookup := h.urlConverter.Visit
+		if r.Method == http.MethodHead {
+			lookup = h.urlConverter.GetOriginal
+		}
 
-		shortURL, err := h.urlConverter.GetOriginal(ctx, id)
-		if errors.Is(err, new(url.ErrURLDeleted)) {
-			http.Error(w, err.Error(), http.StatusGone)
+		shortURL, err := lookup(ctx, domain.Name, id)
+		if errors.Is(err, url.ErrNotFound) && len(domain.NotFoundPage) > 0 {
+			w.Header().Set(headers.ContentType, textHTML)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(domain.NotFoundPage)
 			return
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, err)
 			return
 		}
 
+		if shortURL.Redirect.CacheControl != "" {
+			w.Header().Set(headers.CacheControl, shortURL.Redirect.CacheControl)
+		}
 		w.Header().Add(headers.Location, shortURL.Original)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		w.WriteHeader(shortURL.Redirect.Code)
 	})
 }
 
@@ -71,31 +100,31 @@ func (h *handler) addURL() http.HandlerFunc {
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
 			return
 		}
 
 		userID, err := r.Cookie(userIDCookieName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
 		var errDupl *url.ErrURLDuplicate
 
-		shortURL, err := h.urlConverter.Shorten(ctx, userID.Value, string(body))
+		shortURL, err := h.urlConverter.Shorten(ctx, userID.Value, r.URL.Query().Get(domainParam), string(body), url.Redirect{})
 		if errors.As(err, &errDupl) {
 			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(h.baseURL + "/" + errDupl.EncodedID))
+			w.Write([]byte(h.shortURL(errDupl.Domain, errDupl.EncodedID)))
 			return
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		w.Write([]byte(h.baseURL + "/" + shortURL.EncodedID))
+		w.Write([]byte(h.shortURL(shortURL.Domain, shortURL.EncodedID)))
 	})
 }
 
@@ -106,30 +135,30 @@ func (h *handler) addURLFromJSON() http.HandlerFunc {
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
 			return
 		}
 
 		reqData := new(requestData)
 		if err = json.Unmarshal(body, reqData); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
 			return
 		}
 
 		userID, err := r.Cookie(userIDCookieName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
 		var errDupl *url.ErrURLDuplicate
 
-		shortURL, err := h.urlConverter.Shorten(ctx, userID.Value, reqData.URL)
+		shortURL, err := h.urlConverter.Shorten(ctx, userID.Value, reqData.Domain, reqData.URL, reqData.Redirect)
 		if errors.As(err, &errDupl) {
-			resData := responseData{h.baseURL + "/" + errDupl.EncodedID}
+			resData := responseData{h.shortURL(errDupl.Domain, errDupl.EncodedID)}
 			jsonRes, errM := json.Marshal(resData)
 			if errM != nil {
-				http.Error(w, errM.Error(), http.StatusInternalServerError)
+				problem.Write(w, r, errM)
 				return
 			}
 			w.Header().Add(headers.ContentType, applicationJSON)
@@ -138,14 +167,14 @@ func (h *handler) addURLFromJSON() http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, err)
 			return
 		}
 
-		resData := responseData{h.baseURL + "/" + shortURL.EncodedID}
+		resData := responseData{h.shortURL(shortURL.Domain, shortURL.EncodedID)}
 		jsonRes, err := json.Marshal(resData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -162,19 +191,19 @@ func (h *handler) addURLBatch() http.HandlerFunc {
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
 			return
 		}
 
 		var reqData []requestBatch
 		if err = json.Unmarshal(body, &reqData); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
 			return
 		}
 
 		userID, err := r.Cookie(userIDCookieName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -182,9 +211,10 @@ func (h *handler) addURLBatch() http.HandlerFunc {
 		for _, item := range reqData {
 			originals = append(originals, item.OriginalURL)
 		}
-		shortURLs, err := h.urlConverter.ShortenBatch(ctx, userID.Value, originals)
+
+		shortURLs, err := h.urlConverter.ShortenBatch(ctx, userID.Value, r.URL.Query().Get(domainParam), originals)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -194,7 +224,7 @@ func (h *handler) addURLBatch() http.HandlerFunc {
 				if shortURL.Original == item.OriginalURL {
 					resData = append(resData, responseBatch{
 						CorrelationID: item.CorrelationID,
-						ShortURL:      h.baseURL + "/" + shortURL.EncodedID,
+						ShortURL:      h.shortURL(shortURL.Domain, shortURL.EncodedID),
 					})
 					break
 				}
@@ -202,13 +232,13 @@ func (h *handler) addURLBatch() http.HandlerFunc {
 		}
 
 		if len(reqData) != len(resData) {
-			http.Error(w, "url adding error", http.StatusInternalServerError)
+			problem.Write(w, r, errors.New("url adding error"))
 			return
 		}
 
 		jsonRes, err := json.Marshal(resData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -225,13 +255,13 @@ func (h *handler) getAllURL() http.HandlerFunc {
 
 		userID, err := r.Cookie(userIDCookieName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
 		shortURLs, err := h.urlConverter.GetAllByUser(ctx, userID.Value)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -243,14 +273,60 @@ func (h *handler) getAllURL() http.HandlerFunc {
 		var resData []responseAll
 		for _, shortURL := range shortURLs {
 			resData = append(resData, responseAll{
-				ShortURL:    h.baseURL + "/" + shortURL.EncodedID,
+				ShortURL:    h.shortURL(shortURL.Domain, shortURL.EncodedID),
 				OriginalURL: shortURL.Original,
+				Redirect:    shortURL.Redirect,
 			})
 		}
 
 		jsonRes, err := json.Marshal(resData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
+			return
+		}
+
+		w.Header().Add(headers.ContentType, applicationJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	})
+}
+
+func (h *handler) setRedirect() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
+			return
+		}
+
+		var redirect url.Redirect
+		if err = json.Unmarshal(body, &redirect); err != nil {
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
+			return
+		}
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		shortURL, err := h.urlConverter.SetRedirect(ctx, userID.Value, h.router.GetURLParam(r, "id"), redirect)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		jsonRes, err := json.Marshal(responseAll{
+			ShortURL:    h.shortURL(shortURL.Domain, shortURL.EncodedID),
+			OriginalURL: shortURL.Original,
+			Redirect:    shortURL.Redirect,
+		})
+		if err != nil {
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -267,31 +343,42 @@ func (h *handler) deleteURLBatch() http.HandlerFunc {
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
 			return
 		}
 
 		var encodedIDs []string
 		if err = json.Unmarshal(body, &encodedIDs); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
 			return
 		}
 
 		userID, err := r.Cookie(userIDCookieName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
+		err = h.urlConverter.ValidateDelete(ctx, userID.Value, encodedIDs)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		batch := &url.DelBatch{
+			UserID:     userID.Value,
+			EncodedIDs: encodedIDs,
+			Actor:      url.ActorFromContext(r.Context()),
+			Trace:      trace.SpanContextFromContext(r.Context()),
+		}
+
+		// The delete worker stops receiving on shutdown, the send is
+		// abandoned with the request.
 		select {
 		case <-ctx.Done():
-			http.Error(w, ctx.Err().Error(), http.StatusInternalServerError)
+			problem.Write(w, r, ctx.Err())
 			return
-		default:
-			h.delBuf <- &url.DelBatch{
-				UserID:     userID.Value,
-				EncodedIDs: encodedIDs,
-			}
+		case h.delBuf <- batch:
 		}
 
 		w.WriteHeader(http.StatusAccepted)
@@ -305,7 +392,7 @@ func (h *handler) stats() http.Handler {
 
 		urls, users, err := h.urlConverter.GetStats(ctx)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -316,7 +403,7 @@ func (h *handler) stats() http.Handler {
 
 		jsonRes, err := json.Marshal(resData)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
@@ -326,13 +413,78 @@ func (h *handler) stats() http.Handler {
 	})
 }
 
+func (h *handler) getQuota() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		usage, err := h.urlConverter.GetQuota(ctx, userID.Value)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		jsonRes, err := json.Marshal(usage)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		w.Header().Add(headers.ContentType, applicationJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	})
+}
+
+func (h *handler) setQuota() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
+			return
+		}
+
+		reqData := new(requestQuota)
+		if err = json.Unmarshal(body, reqData); err != nil {
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
+			return
+		}
+
+		if reqData.UserID == "" {
+			problem.Write(w, r, problem.Errorf(problem.BadRequest, "empty user_id"))
+			return
+		}
+
+		if err = h.urlConverter.SetQuota(ctx, reqData.UserID, reqData.Quota); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// shortURL returns the short URL of the link on the domain.
+func (h *handler) shortURL(domain, encodedID string) string {
+	return h.domains.Resolve(domain).ShortURL(encodedID)
+}
+
 func (h *handler) pingDB() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
 		if err := h.urlConverter.PingKeeper(ctx); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, err)
 			return
 		}
 
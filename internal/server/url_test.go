@@ -4,21 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/access"
+	"github.com/ruskiiamov/shortener/internal/backup"
 	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/problem"
 	"github.com/ruskiiamov/shortener/internal/url"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 const (
 	testBaseURL       = "http://127.0.0.1:8080"
 	testServerAddress = "127.0.0.1:8080"
 	testCIDR          = "192.168.0.0/16"
+	testProxies       = "127.0.0.1, ::1"
 )
 
 var mAuthorizer *mockedUserAuth
@@ -28,14 +37,22 @@ var ts *httptest.Server
 func init() {
 	mAuthorizer = new(mockedUserAuth)
 	mConverter = new(mockedConverter)
+	ac, err := access.NewChecker(testCIDR, testProxies)
+	if err != nil {
+		panic(err)
+	}
 	h, err := NewHandler(
 		context.Background(),
 		mAuthorizer,
 		mConverter,
+		nil,
+		nil,
 		chi.NewRouter(),
 		make(chan *url.DelBatch, 100),
-		testBaseURL,
-		testCIDR,
+		url.NewDomains(url.Domain{BaseURL: testBaseURL}),
+		ac,
+		nil,
+		nil,
 	)
 	if err != nil {
 		panic(err)
@@ -59,6 +76,7 @@ func TestGetUrl(t *testing.T) {
 		res     *url.URL
 		err     error
 		wantErr bool
+		status  int
 	}{
 		{
 			name:  "ok",
@@ -66,6 +84,7 @@ func TestGetUrl(t *testing.T) {
 			res: &url.URL{
 				EncodedID: "1",
 				Original:  "http://shortener.com",
+				Redirect:  url.Redirect{Code: http.StatusTemporaryRedirect},
 			},
 			err:     nil,
 			wantErr: false,
@@ -74,13 +93,30 @@ func TestGetUrl(t *testing.T) {
 			name:    "not ok",
 			encID:   "abc",
 			res:     nil,
-			err:     errors.New("wrong id"),
+			err:     fmt.Errorf("%w: abc", url.ErrInvalidID),
+			wantErr: true,
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "not found",
+			encID:   "zz",
+			res:     nil,
+			err:     fmt.Errorf("%w: zz", url.ErrNotFound),
+			wantErr: true,
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "deleted",
+			encID:   "zy",
+			res:     nil,
+			err:     new(url.ErrURLDeleted),
 			wantErr: true,
+			status:  http.StatusGone,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mConverter.On("GetOriginal", mock.Anything, tt.encID).Return(tt.res, tt.err)
+			mConverter.On("Visit", mock.Anything, "", tt.encID).Return(tt.res, tt.err)
 			mAuthorizer.On("CreateUser").Return(
 				"cfb31f30-efa9-4244-b1d6-e04c8438771d",
 				"XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
@@ -92,7 +128,8 @@ func TestGetUrl(t *testing.T) {
 			mConverter.AssertExpectations(t)
 
 			if tt.wantErr {
-				assert.Equal(t, http.StatusBadRequest, statusCode)
+				assert.Equal(t, tt.status, statusCode)
+				assert.Equal(t, problem.ContentType, header.Get("Content-Type"))
 				return
 			}
 
@@ -134,10 +171,10 @@ func TestAddURL(t *testing.T) {
 			userID:     "cfb31f30-efa9-4244-b1d6-e04c8438771d",
 			authCookie: "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
 			res:        nil,
-			err:        errors.New("wrong url"),
-			want:       "wrong url\n",
+			err:        fmt.Errorf("%w: shortener.com", url.ErrInvalidURL),
+			want:       "/problems/invalid-url",
 			wantBody:   false,
-			status:     500,
+			status:     400,
 		},
 		{
 			name:       "duplicate",
@@ -153,7 +190,7 @@ func TestAddURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mConverter.On("Shorten", mock.Anything, tt.userID, tt.body).Return(tt.res, tt.err).Once()
+			mConverter.On("Shorten", mock.Anything, tt.userID, "", tt.body, url.Redirect{}).Return(tt.res, tt.err).Once()
 			mAuthorizer.On("GetUserID", tt.authCookie).Return(tt.userID, nil)
 
 			cookie := &http.Cookie{Name: authCookieName, Value: tt.authCookie}
@@ -164,6 +201,16 @@ func TestAddURL(t *testing.T) {
 			mConverter.AssertExpectations(t)
 
 			assert.Equal(t, tt.status, statusCode)
+
+			if !tt.wantBody {
+				var p problem.Details
+				assert.NoError(t, json.Unmarshal([]byte(body), &p))
+				assert.Equal(t, tt.want, p.Type)
+				assert.Equal(t, tt.status, p.Status)
+				assert.NotEmpty(t, p.RequestID)
+				return
+			}
+
 			assert.Equal(t, tt.want, string(body))
 		})
 	}
@@ -204,9 +251,9 @@ func TestAddURLFromJSON(t *testing.T) {
 			authCookie: "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
 			res:        nil,
 			cType:      "",
-			err:        errors.New("wrong url"),
+			err:        fmt.Errorf("%w: shortener.com", url.ErrInvalidURL),
 			wantErr:    true,
-			status:     500,
+			status:     400,
 			jsonResp:   "",
 		},
 		{
@@ -226,7 +273,7 @@ func TestAddURLFromJSON(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			jsonBody := `{"url":"` + tt.url + `"}`
 
-			mConverter.On("Shorten", mock.Anything, tt.userID, tt.url).Return(tt.res, tt.err).Once()
+			mConverter.On("Shorten", mock.Anything, tt.userID, "", tt.url, url.Redirect{}).Return(tt.res, tt.err).Once()
 			mAuthorizer.On("GetUserID", tt.authCookie).Return(tt.userID, nil)
 
 			cookie := &http.Cookie{Name: authCookieName, Value: tt.authCookie}
@@ -274,7 +321,7 @@ func TestAddURLBatch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mConverter.On("ShortenBatch", mock.Anything, tt.userID, tt.originals).Return(tt.shortURLs, nil)
+			mConverter.On("ShortenBatch", mock.Anything, tt.userID, "", tt.originals).Return(tt.shortURLs, nil)
 			mAuthorizer.On("GetUserID", tt.authCookie).Return(tt.userID, nil)
 
 			cookie := &http.Cookie{Name: authCookieName, Value: tt.authCookie}
@@ -352,12 +399,14 @@ func TestDeleteURLBatch(t *testing.T) {
 	authCookie := "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ="
 	cookie := &http.Cookie{Name: authCookieName, Value: authCookie}
 	mAuthorizer.On("GetUserID", authCookie).Return("cfb31f30-efa9-4244-b1d6-e04c8438771d", nil)
+	mConverter.On("ValidateDelete", mock.Anything, "cfb31f30-efa9-4244-b1d6-e04c8438771d", []string{"1", "2", "5"}).Return(nil).Once()
 
 	jsonBody := `["1","2","5"]`
 
 	statusCode, _, _ := testRequest(t, ts, http.MethodDelete, "/api/user/urls", []byte(jsonBody), cookie, nil)
 
 	mAuthorizer.AssertExpectations(t)
+	mConverter.AssertExpectations(t)
 
 	assert.Equal(t, 202, statusCode)
 }
@@ -456,3 +505,125 @@ func TestPingDB(t *testing.T) {
 		})
 	}
 }
+
+func TestGetQuota(t *testing.T) {
+	authCookie := "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ="
+	userID := "cfb31f30-efa9-4244-b1d6-e04c8438771d"
+	cookie := &http.Cookie{Name: authCookieName, Value: authCookie}
+
+	usage := &url.QuotaUsage{
+		Quota: url.Quota{MaxLinks: 100, MaxBatchSize: 10, MaxDeleteIDs: 50},
+		Links: 7,
+	}
+
+	mAuthorizer.On("GetUserID", authCookie).Return(userID, nil)
+	mConverter.On("GetQuota", mock.Anything, userID).Return(usage, nil).Once()
+
+	statusCode, body, header := testRequest(t, ts, http.MethodGet, "/api/user/quota", nil, cookie, nil)
+
+	mAuthorizer.AssertExpectations(t)
+	mConverter.AssertExpectations(t)
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.JSONEq(t, `{"links":7,"max_links":100,"max_batch_size":10,"max_delete_ids":50}`, body)
+}
+
+func TestGetAudit(t *testing.T) {
+	events := []url.AuditEvent{
+		{
+			Time:      time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC),
+			Action:    url.ActionCreated,
+			UserID:    "cfb31f30-efa9-4244-b1d6-e04c8438771d",
+			LinkID:    "1",
+			URL:       "http://shortener.com",
+			IP:        "192.168.0.15",
+			Transport: url.TransportHTTP,
+		},
+	}
+
+	filter := url.AuditFilter{Action: url.ActionCreated, Limit: 10}
+
+	mAuthorizer.On("CreateUser").Return(
+		"cfb31f30-efa9-4244-b1d6-e04c8438771d",
+		"XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ=",
+		nil,
+	)
+	mConverter.On("QueryAudit", mock.Anything, filter).Return(events, nil).Once()
+
+	header := make(http.Header)
+	header.Set(xRealIP, "192.168.0.15")
+
+	statusCode, body, _ := testRequest(t, ts, http.MethodGet, "/api/internal/audit?action=created&limit=10", nil, nil, &header)
+
+	mConverter.AssertExpectations(t)
+
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, `[{"time":"2023-04-01T12:00:00Z","action":"created","user_id":"cfb31f30-efa9-4244-b1d6-e04c8438771d","link_id":"1","url":"http://shortener.com","ip":"192.168.0.15","transport":"http"}]`, body)
+}
+
+func TestBackup(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		err  error
+		code int
+	}{
+		{
+			name: "ok",
+			ip:   "192.168.0.15",
+			code: 200,
+		},
+		{
+			name: "snapshot error",
+			ip:   "192.168.0.15",
+			err:  errors.New("some error"),
+			code: 500,
+		},
+		{
+			name: "forbidden",
+			ip:   "10.80.0.12",
+			code: 403,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authCookie := "XlBVspVMtREN3fydYOxHRdxJKff1Emw3UwLB5RgQrj9jZmIzMWYzMC1lZmE5LTQyNDQtYjFkNi1lMDRjODQzODc3MWQ="
+			cookie := &http.Cookie{Name: authCookieName, Value: authCookie}
+
+			header := make(http.Header)
+			header.Set(xRealIP, tt.ip)
+
+			mAuthorizer.On("GetUserID", authCookie).Return("cfb31f30-efa9-4244-b1d6-e04c8438771d", nil)
+			if tt.code != 403 {
+				mConverter.On("Snapshot", mock.Anything, mock.Anything).Return(tt.err).Run(func(args mock.Arguments) {
+					if tt.err != nil {
+						return
+					}
+					w := args.Get(1).(url.SnapshotWriter)
+					require.NoError(t, w.WriteNextID(3))
+					require.NoError(t, w.WriteRecord(url.Record{ID: 1, URL: "http://example.com", UserID: "cfb31f30-efa9-4244-b1d6-e04c8438771d"}))
+					require.NoError(t, w.WriteRecord(url.Record{ID: 2, URL: "http://example.com/a", UserID: "cfb31f30-efa9-4244-b1d6-e04c8438771d", Deleted: true}))
+				}).Once()
+			}
+
+			statusCode, body, resHeader := testRequest(t, ts, http.MethodPost, "/api/internal/backup", nil, cookie, &header)
+
+			mConverter.AssertExpectations(t)
+			assert.Equal(t, tt.code, statusCode)
+
+			if tt.code == 200 {
+				assert.Equal(t, backup.ContentType, resHeader.Get(headers.ContentType))
+				assert.Contains(t, resHeader.Get(headers.ContentDisposition), "attachment")
+
+				m, err := backup.Verify(strings.NewReader(body))
+				require.NoError(t, err)
+				assert.Equal(t, 3, m.NextID)
+				assert.Equal(t, 2, m.Records)
+				assert.Equal(t, 1, m.Deleted)
+				assert.Equal(t, 1, m.Users)
+			}
+		})
+	}
+}
@@ -12,20 +12,32 @@ type mockedConverter struct {
 }
 
 // Shorten is mocked method.
-func (m *mockedConverter) Shorten(ctx context.Context, userID, original string) (*url.URL, error) {
-	args := m.Called(ctx, userID, original)
+func (m *mockedConverter) Shorten(ctx context.Context, userID, domain, original string, r url.Redirect) (*url.URL, error) {
+	args := m.Called(ctx, userID, domain, original, r)
+	return args.Get(0).(*url.URL), args.Error(1)
+}
+
+// SetRedirect is mocked method.
+func (m *mockedConverter) SetRedirect(ctx context.Context, userID, encodedID string, r url.Redirect) (*url.URL, error) {
+	args := m.Called(ctx, userID, encodedID, r)
 	return args.Get(0).(*url.URL), args.Error(1)
 }
 
 // ShortenBatch is mocked method.
-func (m *mockedConverter) ShortenBatch(ctx context.Context, userID string, originals []string) ([]url.URL, error) {
-	args := m.Called(ctx, userID, originals)
+func (m *mockedConverter) ShortenBatch(ctx context.Context, userID, domain string, originals []string) ([]url.URL, error) {
+	args := m.Called(ctx, userID, domain, originals)
 	return args.Get(0).([]url.URL), args.Error(1)
 }
 
 // GetOriginal is mocked method.
-func (m *mockedConverter) GetOriginal(ctx context.Context, encodedID string) (*url.URL, error) {
-	args := m.Called(ctx, encodedID)
+func (m *mockedConverter) GetOriginal(ctx context.Context, domain, encodedID string) (*url.URL, error) {
+	args := m.Called(ctx, domain, encodedID)
+	return args.Get(0).(*url.URL), args.Error(1)
+}
+
+// Visit is mocked method.
+func (m *mockedConverter) Visit(ctx context.Context, domain, encodedID string) (*url.URL, error) {
+	args := m.Called(ctx, domain, encodedID)
 	return args.Get(0).(*url.URL), args.Error(1)
 }
 
@@ -35,10 +47,16 @@ func (m *mockedConverter) GetAllByUser(ctx context.Context, userID string) ([]ur
 	return args.Get(0).([]url.URL), args.Error(1)
 }
 
+// ListByUser is mocked method.
+func (m *mockedConverter) ListByUser(ctx context.Context, userID string, fn func(url.URL) error) error {
+	args := m.Called(ctx, userID, fn)
+	return args.Error(0)
+}
+
 // RemoveBatch is mocked method.
-func (m *mockedConverter) RemoveBatch(ctx context.Context, batch map[string][]string) error {
+func (m *mockedConverter) RemoveBatch(ctx context.Context, batch map[string][]string) (map[string][]string, error) {
 	args := m.Called(ctx, batch)
-	return args.Error(0)
+	return args.Get(0).(map[string][]string), args.Error(1)
 }
 
 // PingKeeper is mocked method.
@@ -52,3 +70,39 @@ func (m *mockedConverter) GetStats(ctx context.Context) (urls, users int, err er
 	args := m.Called(ctx)
 	return args.Int(0), args.Int(1), args.Error(2)
 }
+
+// GetQuota is mocked method.
+func (m *mockedConverter) GetQuota(ctx context.Context, userID string) (*url.QuotaUsage, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(*url.QuotaUsage), args.Error(1)
+}
+
+// SetQuota is mocked method.
+func (m *mockedConverter) SetQuota(ctx context.Context, userID string, q url.Quota) error {
+	args := m.Called(ctx, userID, q)
+	return args.Error(0)
+}
+
+// ValidateDelete is mocked method.
+func (m *mockedConverter) ValidateDelete(ctx context.Context, userID string, encodedIDs []string) error {
+	args := m.Called(ctx, userID, encodedIDs)
+	return args.Error(0)
+}
+
+// QueryAudit is mocked method.
+func (m *mockedConverter) QueryAudit(ctx context.Context, f url.AuditFilter) ([]url.AuditEvent, error) {
+	args := m.Called(ctx, f)
+	return args.Get(0).([]url.AuditEvent), args.Error(1)
+}
+
+// GetOwner is mocked method.
+func (m *mockedConverter) GetOwner(ctx context.Context, encodedID string) (string, error) {
+	args := m.Called(ctx, encodedID)
+	return args.String(0), args.Error(1)
+}
+
+// Snapshot is mocked method.
+func (m *mockedConverter) Snapshot(ctx context.Context, w url.SnapshotWriter) error {
+	args := m.Called(ctx, w)
+	return args.Error(0)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/webhook"
+)
+
+// Limits of the webhook deliveries and dead letters lists.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type requestWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (h *handler) addWebhook() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, problem.WithDefault(problem.BadRequest, err))
+			return
+		}
+
+		reqData := new(requestWebhook)
+		if err = json.Unmarshal(body, reqData); err != nil {
+			problem.Write(w, r, problem.New(problem.BadRequest, err))
+			return
+		}
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		endpoint, err := h.webhooks.Register(ctx, userID.Value, reqData.URL, reqData.Events)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusCreated, endpoint)
+	})
+}
+
+func (h *handler) getWebhooks() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		endpoints, err := h.webhooks.List(ctx, userID.Value)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		if len(endpoints) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, endpoints)
+	})
+}
+
+func (h *handler) deleteWebhook() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		err = h.webhooks.Remove(ctx, userID.Value, h.router.GetURLParam(r, "id"))
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (h *handler) getWebhookDeliveries() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		limit, err := queryLimit(r)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		deliveries, err := h.webhooks.Deliveries(ctx, userID.Value, limit)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []webhook.Delivery{}
+		}
+
+		writeJSON(w, r, http.StatusOK, deliveries)
+	})
+}
+
+func (h *handler) getWebhookDeadLetters() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
+		defer cancel()
+
+		userID, err := r.Cookie(userIDCookieName)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		limit, err := queryLimit(r)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		deadLetters, err := h.webhooks.DeadLetters(ctx, userID.Value, limit)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+
+		if deadLetters == nil {
+			deadLetters = []webhook.DeadLetter{}
+		}
+
+		writeJSON(w, r, http.StatusOK, deadLetters)
+	})
+}
+
+// queryLimit returns the limit query parameter from 1 to maxLimit,
+// defaultLimit if it is not set.
+func queryLimit(r *http.Request) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return defaultLimit, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxLimit {
+		return 0, problem.Errorf(problem.BadRequest, "limit %s not valid, must be from 1 to %d", limit, maxLimit)
+	}
+
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	jsonRes, err := json.Marshal(v)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Add(headers.ContentType, applicationJSON)
+	w.WriteHeader(status)
+	w.Write(jsonRes)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", query: "", want: defaultLimit},
+		{name: "set", query: "?limit=10", want: 10},
+		{name: "max", query: "?limit=1000", want: maxLimit},
+		{name: "zero", query: "?limit=0", wantErr: true},
+		{name: "negative", query: "?limit=-1", wantErr: true},
+		{name: "too large", query: "?limit=1001", wantErr: true},
+		{name: "not a number", query: "?limit=ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryLimit(httptest.NewRequest(http.MethodGet, "/api/user/webhooks/deliveries"+tt.query, nil))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues the test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns DER of the leaf certificate for hosts with the public key.
+func (ca *testCA) issue(hosts []string, pub any) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+}
+
+// acmeStandIn is the local ACME server. It does not verify the request
+// signatures and accepts every challenge, so that the client flow runs
+// offline.
+type acmeStandIn struct {
+	*httptest.Server
+	ca *testCA
+
+	mu      sync.Mutex
+	nonce   int
+	orders  []*standInOrder
+	account bool
+}
+
+type standInOrder struct {
+	domains    []string
+	authorized bool
+	cert       []byte
+}
+
+func newACMEStandIn(t *testing.T, ca *testCA) *acmeStandIn {
+	s := &acmeStandIn{ca: ca}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// DirectoryURL returns the ACME directory URL.
+func (s *acmeStandIn) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// Orders returns the number of the created orders.
+func (s *acmeStandIn) Orders() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.orders)
+}
+
+func (s *acmeStandIn) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.nonce))
+
+	var payload []byte
+	if r.Method == http.MethodPost {
+		var jws struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if payload, err = base64.RawURLEncoding.DecodeString(jws.Payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id int
+	if len(parts) > 1 {
+		fmt.Sscan(parts[1], &id)
+	}
+
+	switch parts[0] {
+	case "directory":
+		s.json(w, http.StatusOK, map[string]string{
+			"newNonce":   s.URL + "/nonce",
+			"newAccount": s.URL + "/account",
+			"newOrder":   s.URL + "/new-order",
+			"revokeCert": s.URL + "/revoke",
+			"keyChange":  s.URL + "/key-change",
+		})
+	case "nonce":
+		w.WriteHeader(http.StatusOK)
+	case "account":
+		w.Header().Set("Location", s.URL+"/account/1")
+		status := http.StatusOK
+		if !s.account {
+			s.account = true
+			status = http.StatusCreated
+		}
+		s.json(w, status, map[string]any{"status": "valid"})
+	case "new-order":
+		var req struct {
+			Identifiers []struct {
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o := &standInOrder{}
+		for _, ident := range req.Identifiers {
+			o.domains = append(o.domains, ident.Value)
+		}
+		s.orders = append(s.orders, o)
+		id = len(s.orders) - 1
+		w.Header().Set("Location", fmt.Sprintf("%s/order/%d", s.URL, id))
+		s.json(w, http.StatusCreated, s.order(id))
+	case "order":
+		s.json(w, http.StatusOK, s.order(id))
+	case "authz":
+		s.json(w, http.StatusOK, s.authz(id))
+	case "challenge":
+		s.orders[id].authorized = true
+		s.json(w, http.StatusOK, s.authz(id)["challenges"].([]map[string]string)[0])
+	case "finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.orders[id].cert, err = s.ca.issue(csr.DNSNames, csr.PublicKey); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.json(w, http.StatusOK, s.order(id))
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: s.orders[id].cert})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: s.ca.cert.Raw})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *acmeStandIn) order(id int) map[string]any {
+	o := s.orders[id]
+
+	identifiers := make([]map[string]string, 0, len(o.domains))
+	for _, d := range o.domains {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": d})
+	}
+
+	order := map[string]any{
+		"status":         "pending",
+		"identifiers":    identifiers,
+		"authorizations": []string{fmt.Sprintf("%s/authz/%d", s.URL, id)},
+		"finalize":       fmt.Sprintf("%s/finalize/%d", s.URL, id),
+	}
+	switch {
+	case o.cert != nil:
+		order["status"] = "valid"
+		order["certificate"] = fmt.Sprintf("%s/cert/%d", s.URL, id)
+	case o.authorized:
+		order["status"] = "ready"
+	}
+
+	return order
+}
+
+func (s *acmeStandIn) authz(id int) map[string]any {
+	o := s.orders[id]
+
+	status := "pending"
+	if o.authorized {
+		status = "valid"
+	}
+
+	var challenges []map[string]string
+	for _, typ := range []string{"tls-alpn-01", "http-01"} {
+		challenges = append(challenges, map[string]string{
+			"type":   typ,
+			"url":    fmt.Sprintf("%s/challenge/%d", s.URL, id),
+			"token":  "token",
+			"status": status,
+		})
+	}
+
+	return map[string]any{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": o.domains[0]},
+		"challenges": challenges,
+	}
+}
+
+func (s *acmeStandIn) json(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
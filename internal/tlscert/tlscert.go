@@ -0,0 +1,211 @@
+// Package tlscert provides the certificate of the HTTPS listener: the static
+// key pair reloaded when its files change or the ACME certificates issued by
+// autocert for the allowed hosts.
+package tlscert
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// fileCheckPeriod limits how often the key pair files are checked for
+// changes.
+const fileCheckPeriod = 10 * time.Second
+
+// Options of the certificate source. Static files are used if CertFile and
+// KeyFile are set, autocert otherwise.
+type Options struct {
+	CertFile string
+	KeyFile  string
+
+	// Hosts are the only hosts autocert requests certificates for.
+	Hosts []string
+
+	// CacheDir keeps the account key and the certificates between
+	// restarts. Empty means no cache.
+	CacheDir string
+
+	// DirectoryURL is the ACME directory. Empty means Let's Encrypt.
+	DirectoryURL string
+
+	// Email is the contact of the ACME account, optional.
+	Email string
+
+	// Logger logs the certificate reloads, nil discards them.
+	Logger *zap.Logger
+}
+
+// Provider is the certificate source.
+type Provider struct {
+	file    *fileCert
+	manager *autocert.Manager
+}
+
+// New returns the provider. The static key pair is loaded at once.
+func New(opts Options) (*Provider, error) {
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("both TLS cert and key files must be set")
+		}
+
+		f := &fileCert{
+			certFile: opts.CertFile,
+			keyFile:  opts.KeyFile,
+			period:   fileCheckPeriod,
+			log:      logger.OrNop(opts.Logger),
+		}
+		if err := f.load(); err != nil {
+			return nil, err
+		}
+		f.checked = time.Now()
+
+		return &Provider{file: f}, nil
+	}
+
+	if len(opts.Hosts) == 0 {
+		return nil, errors.New("autocert requires allowed hosts")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Hosts...),
+		Email:      opts.Email,
+	}
+	if opts.CacheDir != "" {
+		m.Cache = autocert.DirCache(opts.CacheDir)
+	}
+	if opts.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: opts.DirectoryURL}
+	}
+
+	return &Provider{manager: m}, nil
+}
+
+// TLSConfig returns the config of the HTTPS listener.
+func (p *Provider) TLSConfig() *tls.Config {
+	if p.manager != nil {
+		return p.manager.TLSConfig()
+	}
+
+	return &tls.Config{
+		GetCertificate: p.file.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// RedirectHandler returns the handler of the plain HTTP listener. It
+// redirects to HTTPS on httpsPort, empty or "443" means the default port.
+// ACME HTTP challenges are served with autocert.
+func (p *Provider) RedirectHandler(httpsPort string) http.Handler {
+	h := redirect(httpsPort)
+	if p.manager != nil {
+		return p.manager.HTTPHandler(h)
+	}
+
+	return h
+}
+
+func redirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// fileCert is the static key pair. The files are checked for changes at
+// most once per period on handshakes, the previous pair is kept if the new
+// one can't be loaded.
+type fileCert struct {
+	certFile string
+	keyFile  string
+	period   time.Duration
+	log      *zap.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (f *fileCert) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.checked) >= f.period {
+		f.checked = time.Now()
+		if err := f.load(); err != nil {
+			f.log.Error("TLS certificate reload error", zap.Error(err))
+		}
+	}
+
+	return f.cert, nil
+}
+
+func (f *fileCert) load() error {
+	modTime, err := latestModTime(f.certFile, f.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if f.cert != nil && modTime.Equal(f.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+
+	if f.cert != nil {
+		f.log.Info("TLS certificate reloaded", zap.String("file", f.certFile))
+	}
+
+	f.cert = &cert
+	f.modTime = modTime
+
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,200 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handshake returns the leaf certificate served with cfg for serverName.
+func handshake(t *testing.T, cfg *tls.Config, serverName string, roots *x509.CertPool) (*x509.Certificate, error) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: serverName, RootCAs: roots})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func writeKeyPair(t *testing.T, ca *testCA, certFile, keyFile, host string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := ca.issue([]string{host}, &key.PublicKey)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestFileCert(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeKeyPair(t, ca, certFile, keyFile, "old.test")
+
+	p, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	p.file.period = 0
+
+	leaf, err := handshake(t, p.TLSConfig(), "old.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, "old.test", leaf.Subject.CommonName)
+
+	writeKeyPair(t, ca, certFile, keyFile, "new.test")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	leaf, err = handshake(t, p.TLSConfig(), "new.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, "new.test", leaf.Subject.CommonName)
+
+	// Broken pair is not loaded, the previous one is served.
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	leaf, err = handshake(t, p.TLSConfig(), "new.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, "new.test", leaf.Subject.CommonName)
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "cert without key", opts: Options{CertFile: "cert.pem"}},
+		{name: "missing files", opts: Options{CertFile: "missing.pem", KeyFile: "missing.key"}},
+		{name: "autocert without hosts", opts: Options{CacheDir: t.TempDir()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAutocert(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	acme := newACMEStandIn(t, ca)
+	cacheDir := t.TempDir()
+
+	opts := Options{
+		Hosts:        []string{"shortener.test"},
+		CacheDir:     cacheDir,
+		DirectoryURL: acme.DirectoryURL(),
+	}
+
+	p, err := New(opts)
+	require.NoError(t, err)
+
+	_, err = handshake(t, p.TLSConfig(), "other.test", roots)
+	assert.Error(t, err)
+	assert.Equal(t, 0, acme.Orders(), "no order for the host not allowed")
+
+	leaf, err := handshake(t, p.TLSConfig(), "shortener.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shortener.test"}, leaf.DNSNames)
+	assert.Equal(t, 1, acme.Orders())
+
+	// The certificate is taken from the cache after restart.
+	p, err = New(opts)
+	require.NoError(t, err)
+
+	cached, err := handshake(t, p.TLSConfig(), "shortener.test", roots)
+	require.NoError(t, err)
+	assert.Equal(t, leaf.SerialNumber, cached.SerialNumber)
+	assert.Equal(t, 1, acme.Orders())
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort string
+		method    string
+		target    string
+		status    int
+		location  string
+	}{
+		{
+			name:     "default port",
+			method:   http.MethodGet,
+			target:   "http://example.com/abc?x=1",
+			status:   http.StatusMovedPermanently,
+			location: "https://example.com/abc?x=1",
+		},
+		{
+			name:      "custom port",
+			httpsPort: "8443",
+			method:    http.MethodGet,
+			target:    "http://example.com:8080/abc",
+			status:    http.StatusMovedPermanently,
+			location:  "https://example.com:8443/abc",
+		},
+		{
+			name:      "post",
+			httpsPort: "443",
+			method:    http.MethodPost,
+			target:    "http://[::1]:8080/api/shorten",
+			status:    http.StatusPermanentRedirect,
+			location:  "https://[::1]/api/shorten",
+		},
+	}
+
+	p, err := New(Options{Hosts: []string{"example.com"}})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.RedirectHandler(tt.httpsPort).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+
+	// ACME HTTP challenges are not redirected.
+	w := httptest.NewRecorder()
+	p.RedirectHandler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/token", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
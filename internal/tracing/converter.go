@@ -0,0 +1,163 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ruskiiamov/shortener/internal/problem"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type converter struct {
+	next url.Converter
+}
+
+// WrapConverter returns the converter with the span for every c call.
+// Expected errors like invalid or deleted URL do not fail the span.
+func WrapConverter(c url.Converter) url.Converter {
+	return &converter{next: c}
+}
+
+func startConverterSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "Converter."+method)
+}
+
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		if problem.Classify(*err).Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+	}
+	span.End()
+}
+
+// Shorten implements url.Converter interface.
+func (c *converter) Shorten(ctx context.Context, userID, domain, original string, r url.Redirect) (u *url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "Shorten")
+	defer endSpan(span, &err)
+
+	return c.next.Shorten(ctx, userID, domain, original, r)
+}
+
+// SetRedirect implements url.Converter interface.
+func (c *converter) SetRedirect(ctx context.Context, userID, encodedID string, r url.Redirect) (u *url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "SetRedirect")
+	defer endSpan(span, &err)
+
+	return c.next.SetRedirect(ctx, userID, encodedID, r)
+}
+
+// ShortenBatch implements url.Converter interface.
+func (c *converter) ShortenBatch(ctx context.Context, userID, domain string, originals []string) (urls []url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "ShortenBatch")
+	defer endSpan(span, &err)
+
+	return c.next.ShortenBatch(ctx, userID, domain, originals)
+}
+
+// GetOriginal implements url.Converter interface.
+func (c *converter) GetOriginal(ctx context.Context, domain, encodedID string) (u *url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "GetOriginal")
+	defer endSpan(span, &err)
+
+	return c.next.GetOriginal(ctx, domain, encodedID)
+}
+
+// Visit implements url.Converter interface.
+func (c *converter) Visit(ctx context.Context, domain, encodedID string) (u *url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "Visit")
+	defer endSpan(span, &err)
+
+	return c.next.Visit(ctx, domain, encodedID)
+}
+
+// GetAllByUser implements url.Converter interface.
+func (c *converter) GetAllByUser(ctx context.Context, userID string) (urls []url.URL, err error) {
+	ctx, span := startConverterSpan(ctx, "GetAllByUser")
+	defer endSpan(span, &err)
+
+	return c.next.GetAllByUser(ctx, userID)
+}
+
+// ListByUser implements url.Converter interface.
+func (c *converter) ListByUser(ctx context.Context, userID string, fn func(url.URL) error) (err error) {
+	ctx, span := startConverterSpan(ctx, "ListByUser")
+	defer endSpan(span, &err)
+
+	return c.next.ListByUser(ctx, userID, fn)
+}
+
+// RemoveBatch implements url.Converter interface.
+func (c *converter) RemoveBatch(ctx context.Context, batch map[string][]string) (removed map[string][]string, err error) {
+	ctx, span := startConverterSpan(ctx, "RemoveBatch")
+	defer endSpan(span, &err)
+
+	return c.next.RemoveBatch(ctx, batch)
+}
+
+// PingKeeper implements url.Converter interface.
+func (c *converter) PingKeeper(ctx context.Context) (err error) {
+	ctx, span := startConverterSpan(ctx, "PingKeeper")
+	defer endSpan(span, &err)
+
+	return c.next.PingKeeper(ctx)
+}
+
+// GetStats implements url.Converter interface.
+func (c *converter) GetStats(ctx context.Context) (urls, users int, err error) {
+	ctx, span := startConverterSpan(ctx, "GetStats")
+	defer endSpan(span, &err)
+
+	return c.next.GetStats(ctx)
+}
+
+// GetQuota implements url.Converter interface.
+func (c *converter) GetQuota(ctx context.Context, userID string) (usage *url.QuotaUsage, err error) {
+	ctx, span := startConverterSpan(ctx, "GetQuota")
+	defer endSpan(span, &err)
+
+	return c.next.GetQuota(ctx, userID)
+}
+
+// SetQuota implements url.Converter interface.
+func (c *converter) SetQuota(ctx context.Context, userID string, q url.Quota) (err error) {
+	ctx, span := startConverterSpan(ctx, "SetQuota")
+	defer endSpan(span, &err)
+
+	return c.next.SetQuota(ctx, userID, q)
+}
+
+// ValidateDelete implements url.Converter interface.
+func (c *converter) ValidateDelete(ctx context.Context, userID string, encodedIDs []string) (err error) {
+	ctx, span := startConverterSpan(ctx, "ValidateDelete")
+	defer endSpan(span, &err)
+
+	return c.next.ValidateDelete(ctx, userID, encodedIDs)
+}
+
+// QueryAudit implements url.Converter interface.
+func (c *converter) QueryAudit(ctx context.Context, f url.AuditFilter) (events []url.AuditEvent, err error) {
+	ctx, span := startConverterSpan(ctx, "QueryAudit")
+	defer endSpan(span, &err)
+
+	return c.next.QueryAudit(ctx, f)
+}
+
+// GetOwner implements url.Converter interface.
+func (c *converter) GetOwner(ctx context.Context, encodedID string) (userID string, err error) {
+	ctx, span := startConverterSpan(ctx, "GetOwner")
+	defer endSpan(span, &err)
+
+	return c.next.GetOwner(ctx, encodedID)
+}
+
+// Snapshot implements url.Converter interface.
+func (c *converter) Snapshot(ctx context.Context, w url.SnapshotWriter) (err error) {
+	ctx, span := startConverterSpan(ctx, "Snapshot")
+	defer endSpan(span, &err)
+
+	return c.next.Snapshot(ctx, w)
+}
@@ -0,0 +1,169 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/tracing"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceparent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+func spanByName(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	for _, s := range spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	require.Failf(t, "span not found", "no span %s", name)
+
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	router := chi.NewRouter()
+	router.AddMiddlewares(
+		tracing.Middleware(router.RoutePattern),
+		tracing.WrapMiddleware("test", func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond)
+				next.ServeHTTP(w, r)
+			})
+		}),
+	)
+	router.GET("/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Tracer().Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	server := spanByName(t, spans, "GET /{id}")
+	mw := spanByName(t, spans, "middleware test")
+	handler := spanByName(t, spans, "handler")
+
+	assert.Equal(t, testTraceID, server.SpanContext().TraceID().String())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.True(t, server.Parent().IsRemote())
+
+	assert.Equal(t, server.SpanContext().SpanID(), mw.Parent().SpanID())
+	assert.Equal(t, server.SpanContext().SpanID(), handler.Parent().SpanID())
+	assert.False(t, mw.EndTime().After(handler.StartTime()))
+}
+
+func TestInterceptors(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.v2.Shortener/GetURL"}
+
+	wrapped := tracing.WrapUnary("test", func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(ctx, req)
+	})
+
+	_, err := tracing.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return wrapped(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, span := tracing.Tracer().Start(ctx, "handler")
+			span.End()
+			return nil, nil
+		})
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	server := spanByName(t, spans, "shortener.v2.Shortener/GetURL")
+	interceptor := spanByName(t, spans, "interceptor test")
+	handler := spanByName(t, spans, "handler")
+
+	assert.Equal(t, testTraceID, server.SpanContext().TraceID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), interceptor.Parent().SpanID())
+	assert.Equal(t, server.SpanContext().SpanID(), handler.Parent().SpanID())
+}
+
+func TestConverterAndDeleteFlush(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	keeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+	converter := tracing.WrapConverter(url.NewConverter(keeper, url.Quota{}, nil, nil, nil, nil))
+
+	ctx, request := tracing.Tracer().Start(context.Background(), "request")
+	shortURL, err := converter.Shorten(ctx, "user", "", "http://example.com", url.Redirect{})
+	require.NoError(t, err)
+
+	_, err = converter.GetOriginal(ctx, "", "wrong")
+	assert.Error(t, err)
+	request.End()
+
+	shorten := spanByName(t, recorder.Ended(), "Converter.Shorten")
+	assert.Equal(t, request.SpanContext().SpanID(), shorten.Parent().SpanID())
+
+	delBuf, _ := url.StartDeleteURL(context.Background(), converter, nil, nil, nil)
+	delBuf <- &url.DelBatch{
+		UserID:     "user",
+		EncodedIDs: []string{shortURL.EncodedID},
+		Trace:      request.SpanContext(),
+	}
+	close(delBuf)
+
+	require.Eventually(t, func() bool {
+		for _, s := range recorder.Ended() {
+			if s.Name() == "DeleteFlush" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	flush := spanByName(t, recorder.Ended(), "DeleteFlush")
+	assert.NotEqual(t, request.SpanContext().TraceID(), flush.SpanContext().TraceID())
+	if assert.Len(t, flush.Links(), 1) {
+		assert.Equal(t, request.SpanContext(), flush.Links()[0].SpanContext)
+	}
+
+	remove := spanByName(t, recorder.Ended(), "Converter.RemoveBatch")
+	assert.Equal(t, flush.SpanContext().SpanID(), remove.Parent().SpanID())
+}
@@ -0,0 +1,145 @@
+package url
+
+import (
+	"context"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Audit actions. Links can't be restored or disabled yet, so there are no
+// actions for them.
+const (
+	ActionCreated      = "created"
+	ActionUpdated      = "updated"
+	ActionDeleted      = "deleted"
+	ActionQuotaChanged = "quota_changed"
+)
+
+// Transports the actions come from.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+const actorCtxKey ctxKey = "actor"
+
+type ctxKey string
+
+// Actor describes where the request comes from.
+type Actor struct {
+	// IP is the client IP address.
+	IP string
+
+	// Transport is the API the request comes through.
+	Transport string
+}
+
+// WithActor returns context with the request actor for audit events.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorCtxKey, a)
+}
+
+// ActorFromContext returns the request actor saved by WithActor.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorCtxKey).(Actor)
+	return a
+}
+
+// AuditEvent is one record of the audit trail.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"user_id"`
+	LinkID    string    `json:"link_id,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Transport string    `json:"transport,omitempty"`
+}
+
+// AuditFilter is the audit trail query. Zero fields are not applied.
+type AuditFilter struct {
+	UserID string
+	Action string
+	LinkID string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Match reports whether the event satisfies the filter conditions except Limit.
+func (f *AuditFilter) Match(e *AuditEvent) bool {
+	switch {
+	case f.UserID != "" && e.UserID != f.UserID:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.LinkID != "" && e.LinkID != f.LinkID:
+		return false
+	case !f.From.IsZero() && e.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Time.Before(f.To):
+		return false
+	}
+
+	return true
+}
+
+// AuditSink is the append-only storage for the audit trail.
+type AuditSink interface {
+	Write(ctx context.Context, events ...AuditEvent) error
+	Query(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+	Close() error
+}
+
+type nopAuditSink struct{}
+
+// NewNopAuditSink returns AuditSink that discards all events.
+func NewNopAuditSink() AuditSink {
+	return nopAuditSink{}
+}
+
+// Write discards events.
+func (nopAuditSink) Write(ctx context.Context, events ...AuditEvent) error {
+	return nil
+}
+
+// Query always returns no events.
+func (nopAuditSink) Query(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	return nil, nil
+}
+
+// Close does nothing.
+func (nopAuditSink) Close() error {
+	return nil
+}
+
+// NewAuditEvent returns event filled with the actor from context.
+func NewAuditEvent(ctx context.Context, action, userID string) AuditEvent {
+	a := ActorFromContext(ctx)
+
+	return AuditEvent{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		UserID:    userID,
+		IP:        a.IP,
+		Transport: a.Transport,
+	}
+}
+
+// QueryAudit returns the audit trail events.
+func (c *converter) QueryAudit(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	return c.auditSink.Query(ctx, f)
+}
+
+// audit writes events to the sink. Audit errors do not fail the operation.
+func (c *converter) audit(ctx context.Context, events ...AuditEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	if err := c.auditSink.Write(ctx, events...); err != nil {
+		logger.Request(ctx, c.log).Error("audit write error", zap.Error(err))
+	}
+}
@@ -7,9 +7,38 @@ import (
 	"fmt"
 	"math/big"
 	neturl "net/url"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	base62       = 62
+	listPageSize = 1000
 )
 
-const base62 = 62
+// Domain errors. Wrapped errors keep only user input, so their messages are
+// safe to show to clients.
+var (
+	// ErrInvalidURL is for original URL that cannot be shortened.
+	ErrInvalidURL = errors.New("URL not valid")
+
+	// ErrInvalidID is for encoded id that cannot be decoded.
+	ErrInvalidID = errors.New("encoded id not valid")
+
+	// ErrNotFound is for unknown URL id. DataKeeper returns it for missing URLs.
+	ErrNotFound = errors.New("URL not found")
+
+	// ErrEmptyBatch is for batch requests without items.
+	ErrEmptyBatch = errors.New("empty batch")
+
+	// ErrInvalidQuota is for quota values less than Unlimited.
+	ErrInvalidQuota = errors.New("quota not valid")
+
+	// ErrImportConflict is for imported records with ids or URLs already
+	// in data storage.
+	ErrImportConflict = errors.New("import conflict")
+)
 
 // ErrURLDuplicate is for trying to shorten existing URL. Contains existing URL data.
 type ErrURLDuplicate struct {
@@ -21,11 +50,14 @@ type ErrURLDuplicate struct {
 
 	// Original URL.
 	URL string
+
+	// Domain is the name of the link domain.
+	Domain string
 }
 
 // Error implements error interface.
 func (e *ErrURLDuplicate) Error() string {
-	return fmt.Sprintf("URL duplicate %s id=%d", e.URL, e.ID)
+	return fmt.Sprintf("URL %s already shortened", e.URL)
 }
 
 // NewErrURLDuplicate returns new error object.
@@ -46,14 +78,63 @@ func (e *ErrURLDeleted) Error() string {
 
 // DataKeeper is data storage for URLs.
 type DataKeeper interface {
-	Add(ctx context.Context, userID, original string) (int, error)
-	AddBatch(ctx context.Context, userID string, originals []string) (map[string]int, error)
-	Get(ctx context.Context, id int) (string, error)
-	GetAllByUser(ctx context.Context, userID string) (map[string]int, error)
-	DeleteBatch(ctx context.Context, batch map[string][]int) error
+	// Add saves original on the domain with the redirect and returns
+	// ErrURLDuplicate if it is already shortened there.
+	Add(ctx context.Context, userID, domain, original string, r Redirect) (int, error)
+
+	// SetRedirect changes the redirect of the URL and returns ErrNotFound
+	// for missing URLs.
+	SetRedirect(ctx context.Context, id int, r Redirect) error
+
+	// AddBatch saves originals on the domain with the default redirect. The ids of the originals
+	// already shortened there are returned too, created are the ids of the new URLs only.
+	AddBatch(ctx context.Context, userID, domain string, originals []string) (ids map[string]int, created []int, err error)
+
+	// FindIDs returns the ids of the originals already shortened on the
+	// domain, deleted ones too.
+	FindIDs(ctx context.Context, domain string, originals []string) (map[string]int, error)
+
+	// Get returns the record of the URL, deleted ones too.
+	Get(ctx context.Context, id int) (*Record, error)
+
+	// GetAllByUser and GetPageByUser return active user URLs in id order.
+	GetAllByUser(ctx context.Context, userID string) ([]Record, error)
+	GetPageByUser(ctx context.Context, userID string, afterID, limit int) ([]Record, error)
+
+	// DeleteBatch deletes active URLs of the users and returns the ids of
+	// the deleted ones. Ids of other users are skipped.
+	DeleteBatch(ctx context.Context, batch map[string][]int) (deleted map[string][]int, err error)
 	Ping(ctx context.Context) error
 	Close(ctx context.Context) error
 	GetStats(ctx context.Context) (urls, users int, err error)
+	CountByUser(ctx context.Context, userID string) (int, error)
+	GetQuota(ctx context.Context, userID string) (*Quota, error)
+	SetQuota(ctx context.Context, userID string, q Quota) error
+	GetOwner(ctx context.Context, id int) (string, error)
+	FetchOutbox(ctx context.Context, limit int) ([]OutboxEvent, error)
+	AckOutbox(ctx context.Context, ids []int64) error
+
+	// Export calls fn for all records in id order. fn must not call the
+	// data keeper.
+	Export(ctx context.Context, fn func(Record) error) error
+
+	// Import saves records with their ids. No outbox events are saved.
+	// Records with taken ids or URLs are not saved and ErrImportConflict
+	// is returned.
+	Import(ctx context.Context, records []Record) error
+
+	// NextID returns the id of the next saved URL.
+	NextID(ctx context.Context) (int, error)
+
+	// SetNextID moves the id sequence forward to id. Lower ids are ignored.
+	SetNextID(ctx context.Context, id int) error
+
+	// Snapshot writes the consistent copy of data storage to w.
+	Snapshot(ctx context.Context, w SnapshotWriter) error
+
+	// Clear removes all URLs, quotas and outbox events and resets the id
+	// sequence.
+	Clear(ctx context.Context) error
 }
 
 // URL is the core entity for URL shortener.
@@ -63,119 +144,350 @@ type URL struct {
 
 	// Original is the original URL.
 	Original string
+
+	// Domain is the name of the link domain, empty for the default one.
+	Domain string
+
+	// Redirect is the redirect semantics of the link.
+	Redirect
 }
 
 // Converter is the core logic to operate with URL.
 type Converter interface {
-	Shorten(ctx context.Context, userID, original string) (*URL, error)
-	ShortenBatch(ctx context.Context, userID string, originals []string) ([]URL, error)
-	GetOriginal(ctx context.Context, encodedID string) (*URL, error)
+	Shorten(ctx context.Context, userID, domain, original string, r Redirect) (*URL, error)
+	SetRedirect(ctx context.Context, userID, encodedID string, r Redirect) (*URL, error)
+	ShortenBatch(ctx context.Context, userID, domain string, originals []string) ([]URL, error)
+	GetOriginal(ctx context.Context, domain, encodedID string) (*URL, error)
+	Visit(ctx context.Context, domain, encodedID string) (*URL, error)
 	GetAllByUser(ctx context.Context, userID string) ([]URL, error)
-	RemoveBatch(ctx context.Context, batch map[string][]string) error
+	ListByUser(ctx context.Context, userID string, fn func(URL) error) error
+	RemoveBatch(ctx context.Context, batch map[string][]string) (map[string][]string, error)
 	PingKeeper(ctx context.Context) error
 	GetStats(ctx context.Context) (urls, users int, err error)
+	GetQuota(ctx context.Context, userID string) (*QuotaUsage, error)
+	SetQuota(ctx context.Context, userID string, q Quota) error
+	ValidateDelete(ctx context.Context, userID string, encodedIDs []string) error
+	QueryAudit(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+	GetOwner(ctx context.Context, encodedID string) (string, error)
+	Snapshot(ctx context.Context, w SnapshotWriter) error
 }
 
 type converter struct {
 	dataKeeper DataKeeper
+	quota      Quota
+	auditSink  AuditSink
+	publisher  EventPublisher
+	domains    *Domains
+	log        *zap.Logger
 }
 
 // NewConverter returns object that implements Converter interface.
-func NewConverter(d DataKeeper) Converter {
-	return &converter{dataKeeper: d}
+// The quota is applied to users without their own quota in data storage.
+// Audit events are discarded if a is nil, click events are discarded if
+// p is nil. Other link events are published through the keeper outbox.
+// Only the default domain is known if dm is nil. l logs the errors not
+// failing the operations, nil discards them.
+func NewConverter(d DataKeeper, q Quota, a AuditSink, p EventPublisher, dm *Domains, l *zap.Logger) Converter {
+	if a == nil {
+		a = NewNopAuditSink()
+	}
+
+	if p == nil {
+		p = NewNopPublisher()
+	}
+
+	if dm == nil {
+		dm = NewDomains(Domain{})
+	}
+
+	return &converter{
+		dataKeeper: d,
+		quota:      q,
+		auditSink:  a,
+		publisher:  p,
+		domains:    dm,
+		log:        logger.OrNop(l),
+	}
 }
 
 // Shorten returns URL object with encoded id or ErrURLDuplicate in case of
-// trying to shorten existing URL.
-func (c *converter) Shorten(ctx context.Context, userID, original string) (*URL, error) {
+// trying to shorten URL existing on the domain. Empty domain means the
+// default one. The redirect of the existing URL is not changed.
+func (c *converter) Shorten(ctx context.Context, userID, domain, original string, r Redirect) (*URL, error) {
 	if _, err := neturl.ParseRequestURI(original); err != nil {
-		return nil, fmt.Errorf("URL %s not valid: %w", original, err)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, original)
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	dom, err := c.userDomain(domain, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := c.userQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.MaxLinks > 0 {
+		// The duplicate is reported before the links quota as it doesn't
+		// take a new link.
+		existing, err := c.dataKeeper.FindIDs(ctx, dom.Name, []string{original})
+		if err != nil {
+			return nil, fmt.Errorf("data keeper error: %w", err)
+		}
+
+		if id, ok := existing[original]; ok {
+			return nil, &ErrURLDuplicate{ID: id, EncodedID: encode(id), URL: original, Domain: dom.Name}
+		}
+
+		if err = c.checkLinks(ctx, q, userID, 1); err != nil {
+			return nil, err
+		}
 	}
 
 	var errDupl *ErrURLDuplicate
 
-	id, err := c.dataKeeper.Add(ctx, userID, original)
+	id, err := c.dataKeeper.Add(ctx, userID, dom.Name, original, r)
 	if errors.As(err, &errDupl) {
 		errDupl.EncodedID = encode(errDupl.ID)
+		errDupl.Domain = dom.Name
 		return nil, errDupl
 	}
 	if err != nil {
 		return nil, fmt.Errorf("URL %s adding error: %w", original, err)
 	}
 
-	return &URL{EncodedID: encode(id), Original: original}, nil
+	result := &URL{EncodedID: encode(id), Original: original, Domain: dom.Name, Redirect: r}
+
+	event := NewAuditEvent(ctx, ActionCreated, userID)
+	event.LinkID = result.EncodedID
+	event.URL = original
+	c.audit(ctx, event)
+
+	return result, nil
 }
 
-// ShortenBatch returns a slice of URL objects with shortened IDs.
-func (c *converter) ShortenBatch(ctx context.Context, userID string, originals []string) ([]URL, error) {
+// ShortenBatch returns a slice of URL objects with shortened IDs on the
+// domain. Empty domain means the default one.
+func (c *converter) ShortenBatch(ctx context.Context, userID, domain string, originals []string) ([]URL, error) {
 	if len(originals) == 0 {
-		return nil, errors.New("empty originals")
+		return nil, ErrEmptyBatch
 	}
 
 	originals = unique(originals)
 
 	for _, original := range originals {
 		if _, err := neturl.ParseRequestURI(original); err != nil {
-			return nil, fmt.Errorf("URL %s not valid: %w", original, err)
+			return nil, fmt.Errorf("%w: %s", ErrInvalidURL, original)
+		}
+	}
+
+	dom, err := c.userDomain(domain, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := c.userQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.MaxBatchSize > 0 && len(originals) > q.MaxBatchSize {
+		return nil, &ErrQuotaExceeded{Name: QuotaBatchSize, Limit: q.MaxBatchSize}
+	}
+
+	if q.MaxLinks > 0 {
+		// Only the new URLs take the links quota.
+		existing, err := c.dataKeeper.FindIDs(ctx, dom.Name, originals)
+		if err != nil {
+			return nil, fmt.Errorf("data keeper error: %w", err)
+		}
+
+		if err = c.checkLinks(ctx, q, userID, len(originals)-len(existing)); err != nil {
+			return nil, err
 		}
 	}
 
-	m, err := c.dataKeeper.AddBatch(ctx, userID, originals)
+	m, created, err := c.dataKeeper.AddBatch(ctx, userID, dom.Name, originals)
 	if err != nil {
 		return nil, fmt.Errorf("URLs adding error: %w", err)
 	}
 
+	isCreated := make(map[int]bool, len(created))
+	for _, id := range created {
+		isCreated[id] = true
+	}
+
+	// AddBatch returns existing URLs too, the event is recorded only for
+	// the created ones.
 	var result []URL
+	var events []AuditEvent
 	for original, id := range m {
 		result = append(result, URL{
 			EncodedID: encode(id),
 			Original:  original,
+			Domain:    dom.Name,
 		})
+
+		if !isCreated[id] {
+			continue
+		}
+
+		event := NewAuditEvent(ctx, ActionCreated, userID)
+		event.LinkID = encode(id)
+		event.URL = original
+		events = append(events, event)
 	}
 
+	c.audit(ctx, events...)
+
 	return result, nil
 }
 
-// GetOriginal returns URL object by shortened id.
-func (c *converter) GetOriginal(ctx context.Context, encodedID string) (*URL, error) {
+// GetOriginal returns URL object by shortened id. The links of other
+// domains are not found. Empty domain means the default one. The redirect
+// code is the effective one: the link code or the domain default.
+func (c *converter) GetOriginal(ctx context.Context, domain, encodedID string) (*URL, error) {
+	dom, err := c.domains.Get(domain)
+	if err != nil {
+		return nil, err
+	}
+
 	id, err := decode(encodedID)
 	if err != nil {
-		return nil, fmt.Errorf("decoding error: %w", err)
+		return nil, err
 	}
 
-	original, err := c.dataKeeper.Get(ctx, id)
+	r, err := c.dataKeeper.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, encodedID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("data keeper error: %w", err)
 	}
 
-	return &URL{
-		EncodedID: encodedID,
-		Original:  original,
-	}, nil
+	// The links of the domains removed from the configuration resolve on
+	// the default domain.
+	if c.domains.Resolve(r.Domain) != dom {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, encodedID)
+	}
+
+	if r.Deleted {
+		return nil, new(ErrURLDeleted)
+	}
+
+	result := r.url()
+	result.EncodedID = encodedID
+	if result.Redirect.Code == 0 {
+		result.Redirect.Code = dom.StatusCode()
+	}
+
+	return &result, nil
+}
+
+// Visit returns URL object like GetOriginal for the redirect to it and
+// publishes the link click.
+func (c *converter) Visit(ctx context.Context, domain, encodedID string) (*URL, error) {
+	result, err := c.GetOriginal(ctx, domain, encodedID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The owner is not known here, subscribers resolve it with GetOwner.
+	c.publish(EventLinkClicked, "", result)
+
+	return result, nil
+}
+
+// SetRedirect changes the redirect of the user URL. The URLs of other users
+// are not found.
+func (c *converter) SetRedirect(ctx context.Context, userID, encodedID string, redirect Redirect) (*URL, error) {
+	if err := redirect.Validate(); err != nil {
+		return nil, err
+	}
+
+	id, err := decode(encodedID)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.dataKeeper.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) || (err == nil && r.UserID != userID) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, encodedID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("data keeper error: %w", err)
+	}
+
+	if r.Deleted {
+		return nil, new(ErrURLDeleted)
+	}
+
+	err = c.dataKeeper.SetRedirect(ctx, id, redirect)
+	if err != nil {
+		return nil, fmt.Errorf("URL %s update error: %w", encodedID, err)
+	}
+
+	r.Redirect = redirect
+	result := r.url()
+
+	event := NewAuditEvent(ctx, ActionUpdated, userID)
+	event.LinkID = encodedID
+	event.URL = r.URL
+	c.audit(ctx, event)
+
+	return &result, nil
 }
 
 // GetAllByUser returns a slice of URL objects with all user URLs.
 func (c *converter) GetAllByUser(ctx context.Context, userID string) ([]URL, error) {
-	m, err := c.dataKeeper.GetAllByUser(ctx, userID)
+	records, err := c.dataKeeper.GetAllByUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
 	var result []URL
-	for original, id := range m {
-		result = append(result, URL{
-			EncodedID: encode(id),
-			Original:  original,
-		})
+	for _, r := range records {
+		result = append(result, r.url())
 	}
 
 	return result, nil
 }
 
-// RemoveBatch removes URL batch by encoded IDs.
-func (c *converter) RemoveBatch(ctx context.Context, batch map[string][]string) error {
+// ListByUser calls fn for every user URL in id order. Data storage is read
+// page by page, so the user URLs are never held in memory together.
+func (c *converter) ListByUser(ctx context.Context, userID string, fn func(URL) error) error {
+	afterID := 0
+
+	for {
+		records, err := c.dataKeeper.GetPageByUser(ctx, userID, afterID, listPageSize)
+		if err != nil {
+			return fmt.Errorf("data keeper error: %w", err)
+		}
+
+		for _, r := range records {
+			if err = fn(r.url()); err != nil {
+				return err
+			}
+		}
+
+		if len(records) < listPageSize {
+			return nil
+		}
+		afterID = records[len(records)-1].ID
+	}
+}
+
+// RemoveBatch removes URL batch by encoded IDs and returns the encoded IDs
+// of the removed URLs. IDs of other users and already removed URLs are
+// skipped.
+func (c *converter) RemoveBatch(ctx context.Context, batch map[string][]string) (map[string][]string, error) {
 	if len(batch) == 0 {
-		return errors.New("empty encodedIDs")
+		return nil, ErrEmptyBatch
 	}
 
 	decodedBatch := make(map[string][]int)
@@ -184,13 +496,48 @@ func (c *converter) RemoveBatch(ctx context.Context, batch map[string][]string)
 		for _, encodedID := range encodedIDs {
 			id, err := decode(encodedID)
 			if err != nil {
-				return fmt.Errorf("decoding error: %w", err)
+				return nil, err
 			}
 			decodedBatch[userID] = append(decodedBatch[userID], id)
 		}
 	}
 
-	return c.dataKeeper.DeleteBatch(ctx, decodedBatch)
+	deleted, err := c.dataKeeper.DeleteBatch(ctx, decodedBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make(map[string][]string, len(deleted))
+	for userID, ids := range deleted {
+		for _, id := range ids {
+			removed[userID] = append(removed[userID], encode(id))
+		}
+	}
+
+	return removed, nil
+}
+
+// Snapshot writes the consistent copy of data storage to w.
+func (c *converter) Snapshot(ctx context.Context, w SnapshotWriter) error {
+	if err := c.dataKeeper.Snapshot(ctx, w); err != nil {
+		return fmt.Errorf("data keeper error: %w", err)
+	}
+
+	return nil
+}
+
+// userDomain returns the domain the user creates links on.
+func (c *converter) userDomain(name, userID string) (*Domain, error) {
+	dom, err := c.domains.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dom.Allows(userID) {
+		return nil, fmt.Errorf("%w: %s", ErrDomainForbidden, dom.BaseURL)
+	}
+
+	return dom, nil
 }
 
 // PingKeeper checks the data storage connection.
@@ -219,7 +566,7 @@ func decode(encodedID string) (int, error) {
 	var i big.Int
 	_, ok := i.SetString(encodedID, base62)
 	if !ok {
-		return 0, fmt.Errorf("encoded id not valid: %s", encodedID)
+		return 0, fmt.Errorf("%w: %s", ErrInvalidID, encodedID)
 	}
 
 	return int(i.Int64()), nil
@@ -3,16 +3,38 @@ package url
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// memAuditSink keeps the written events.
+type memAuditSink struct {
+	nopAuditSink
+	events []AuditEvent
+}
+
+func (m *memAuditSink) Write(ctx context.Context, events ...AuditEvent) error {
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memAuditSink) linkIDs() []string {
+	var ids []string
+	for _, e := range m.events {
+		ids = append(ids, e.LinkID)
+	}
+	return ids
+}
+
 func TestShorten(t *testing.T) {
 	tests := []struct {
 		name     string
 		url      string
 		userID   string
+		redirect Redirect
 		want     string
 		wantErr  bool
 		res      int
@@ -45,6 +67,30 @@ func TestShorten(t *testing.T) {
 			checkErr: true,
 			keeper:   true,
 		},
+		{
+			name:     "redirect",
+			url:      "http://shortener.com",
+			userID:   "7b6def87-f3dc-4036-bda2-3a6ca1298ef5",
+			redirect: Redirect{Code: http.StatusFound, CacheControl: "no-store"},
+			want:     "1",
+			wantErr:  false,
+			res:      1,
+			err:      nil,
+			checkErr: false,
+			keeper:   true,
+		},
+		{
+			name:     "not valid redirect",
+			url:      "http://shortener.com",
+			userID:   "7b6def87-f3dc-4036-bda2-3a6ca1298ef5",
+			redirect: Redirect{Code: http.StatusOK},
+			want:     "1",
+			wantErr:  true,
+			res:      0,
+			err:      ErrInvalidRedirect,
+			checkErr: true,
+			keeper:   false,
+		},
 		{
 			name:     "not correct url",
 			url:      "shortener.com",
@@ -69,10 +115,11 @@ func TestShorten(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockedDataKeeper := new(mockedDataKeeper)
-			mockedDataKeeper.On("Add", context.Background(), tt.userID, tt.url).Return(tt.res, tt.err)
+			mockedDataKeeper.On("Add", context.Background(), tt.userID, "", tt.url, tt.redirect).Return(tt.res, tt.err)
+			mockedDataKeeper.On("GetQuota", context.Background(), tt.userID).Return((*Quota)(nil), nil)
 
-			c := NewConverter(mockedDataKeeper)
-			got, err := c.Shorten(context.Background(), tt.userID, tt.url)
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+			got, err := c.Shorten(context.Background(), tt.userID, "", tt.url, tt.redirect)
 
 			if tt.keeper {
 				mockedDataKeeper.AssertExpectations(t)
@@ -90,6 +137,51 @@ func TestShorten(t *testing.T) {
 			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got.EncodedID)
 			assert.Equal(t, tt.url, got.Original)
+			assert.Equal(t, tt.redirect, got.Redirect)
+		})
+	}
+}
+
+func TestShortenDomain(t *testing.T) {
+	const owner = "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	domains := NewDomains(
+		Domain{BaseURL: "http://short.example.com"},
+		Domain{Name: "go.brand.com", BaseURL: "https://go.brand.com", AllowedUsers: []string{owner}},
+	)
+
+	tests := []struct {
+		name    string
+		userID  string
+		domain  string
+		stored  string
+		wantErr error
+	}{
+		{name: "default", userID: "user", domain: "", stored: ""},
+		{name: "default host", userID: "user", domain: "short.example.com", stored: ""},
+		{name: "allowed user", userID: owner, domain: "Go.Brand.com", stored: "go.brand.com"},
+		{name: "other user", userID: "user", domain: "go.brand.com", wantErr: ErrDomainForbidden},
+		{name: "unknown", userID: owner, domain: "other.com", wantErr: ErrUnknownDomain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("GetQuota", context.Background(), tt.userID).Return((*Quota)(nil), nil)
+			mockedDataKeeper.On("Add", context.Background(), tt.userID, tt.stored, "http://shortener.com", Redirect{}).Return(1, nil)
+
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, domains, nil)
+			got, err := c.Shorten(context.Background(), tt.userID, tt.domain, "http://shortener.com", Redirect{})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				mockedDataKeeper.AssertNotCalled(t, "Add", context.Background(), tt.userID, tt.stored, "http://shortener.com", Redirect{})
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.stored, got.Domain)
+			mockedDataKeeper.AssertExpectations(t)
 		})
 	}
 }
@@ -100,8 +192,10 @@ func TestShortenBatch(t *testing.T) {
 		userID    string
 		originals []string
 		res       map[string]int
+		created   []int
 		err       error
 		want      []URL
+		audited   []string
 		wantErr   bool
 	}{
 		{
@@ -109,6 +203,27 @@ func TestShortenBatch(t *testing.T) {
 			userID:    "7b6def87-f3dc-4036-bda2-3a6ca1298ef5",
 			originals: []string{"https://shortener.com", "https://shortener2.ru"},
 			res:       map[string]int{"https://shortener.com": 1, "https://shortener2.ru": 2},
+			created:   []int{1, 2},
+			err:       nil,
+			want: []URL{
+				{
+					EncodedID: "1",
+					Original:  "https://shortener.com",
+				},
+				{
+					EncodedID: "2",
+					Original:  "https://shortener2.ru",
+				},
+			},
+			audited: []string{"1", "2"},
+			wantErr: false,
+		},
+		{
+			name:      "existing",
+			userID:    "7b6def87-f3dc-4036-bda2-3a6ca1298ef5",
+			originals: []string{"https://shortener.com", "https://shortener2.ru"},
+			res:       map[string]int{"https://shortener.com": 1, "https://shortener2.ru": 2},
+			created:   []int{2},
 			err:       nil,
 			want: []URL{
 				{
@@ -120,16 +235,19 @@ func TestShortenBatch(t *testing.T) {
 					Original:  "https://shortener2.ru",
 				},
 			},
+			audited: []string{"2"},
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockedDataKeeper := new(mockedDataKeeper)
-			mockedDataKeeper.On("AddBatch", context.Background(), tt.userID, tt.originals).Return(tt.res, tt.err)
+			mockedDataKeeper.On("AddBatch", context.Background(), tt.userID, "", tt.originals).Return(tt.res, tt.created, tt.err)
+			mockedDataKeeper.On("GetQuota", context.Background(), tt.userID).Return((*Quota)(nil), nil)
 
-			c := NewConverter(mockedDataKeeper)
-			got, err := c.ShortenBatch(context.Background(), tt.userID, tt.originals)
+			a := new(memAuditSink)
+			c := NewConverter(mockedDataKeeper, Quota{}, a, nil, nil, nil)
+			got, err := c.ShortenBatch(context.Background(), tt.userID, "", tt.originals)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -139,52 +257,99 @@ func TestShortenBatch(t *testing.T) {
 
 			assert.NoError(t, err)
 			assert.ElementsMatch(t, tt.want, got)
+			assert.ElementsMatch(t, tt.audited, a.linkIDs())
 		})
 	}
 }
 
 func TestGetOriginal(t *testing.T) {
 	tests := []struct {
-		name    string
-		encID   string
-		id      int
-		want    string
-		wantErr bool
-		res     string
-		err     error
+		name     string
+		domain   string
+		encID    string
+		id       int
+		want     string
+		redirect Redirect
+		wantErr  error
+		res      *Record
+		err      error
 	}{
 		{
-			name:    "ok",
-			encID:   "1",
-			id:      1,
-			want:    "http://shortener.com",
-			wantErr: false,
-			res:     "http://shortener.com",
-			err:     nil,
+			name:     "ok",
+			encID:    "1",
+			id:       1,
+			want:     "http://shortener.com",
+			redirect: Redirect{Code: http.StatusTemporaryRedirect},
+			res:      &Record{ID: 1, URL: "http://shortener.com"},
+			err:      nil,
+		},
+		{
+			name:     "redirect",
+			encID:    "4",
+			id:       4,
+			want:     "http://shortener.com",
+			redirect: Redirect{Code: http.StatusMovedPermanently, CacheControl: "max-age=3600"},
+			res:      &Record{ID: 4, URL: "http://shortener.com", Redirect: Redirect{Code: http.StatusMovedPermanently, CacheControl: "max-age=3600"}},
+			err:      nil,
+		},
+		{
+			name:     "domain default",
+			domain:   "go.brand.com",
+			encID:    "5",
+			id:       5,
+			want:     "http://shortener.com",
+			redirect: Redirect{Code: http.StatusPermanentRedirect},
+			res:      &Record{ID: 5, URL: "http://shortener.com", Domain: "go.brand.com"},
+			err:      nil,
+		},
+		{
+			name:     "link over domain",
+			domain:   "go.brand.com",
+			encID:    "6",
+			id:       6,
+			want:     "http://shortener.com",
+			redirect: Redirect{Code: http.StatusFound},
+			res:      &Record{ID: 6, URL: "http://shortener.com", Domain: "go.brand.com", Redirect: Redirect{Code: http.StatusFound}},
+			err:      nil,
 		},
 		{
 			name:    "not ok",
 			encID:   "0",
 			id:      0,
 			want:    "http://shortener.com",
-			wantErr: true,
-			res:     "",
-			err:     errors.New("wrong id"),
+			wantErr: ErrNotFound,
+			res:     nil,
+			err:     ErrNotFound,
+		},
+		{
+			name:    "deleted",
+			encID:   "2",
+			id:      2,
+			wantErr: new(ErrURLDeleted),
+			res:     &Record{ID: 2, URL: "http://shortener.com", Deleted: true},
+		},
+		{
+			name:    "other domain",
+			encID:   "3",
+			id:      3,
+			wantErr: ErrNotFound,
+			res:     &Record{ID: 3, URL: "http://shortener.com", Domain: "go.brand.com", Deleted: true},
 		},
 	}
 
+	domains := NewDomains(Domain{}, Domain{Name: "go.brand.com", RedirectCode: http.StatusPermanentRedirect})
 	mockedDataKeeper := new(mockedDataKeeper)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockedDataKeeper.On("Get", context.Background(), tt.id).Return(tt.res, tt.err)
 
-			c := NewConverter(mockedDataKeeper)
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, domains, nil)
 
-			got, err := c.GetOriginal(context.Background(), tt.encID)
+			got, err := c.GetOriginal(context.Background(), tt.domain, tt.encID)
 
-			if tt.wantErr {
-				assert.NotNil(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
 				assert.Empty(t, got)
 				return
 			}
@@ -192,6 +357,120 @@ func TestGetOriginal(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Equal(t, tt.encID, got.EncodedID)
 			assert.Equal(t, tt.want, got.Original)
+			assert.Equal(t, tt.redirect, got.Redirect)
+		})
+	}
+}
+
+// memPublisher keeps the published events.
+type memPublisher struct {
+	events []LinkEvent
+}
+
+func (m *memPublisher) Publish(e LinkEvent) {
+	m.events = append(m.events, e)
+}
+
+func TestVisit(t *testing.T) {
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("Get", context.Background(), 1).Return(&Record{ID: 1, URL: "http://shortener.com"}, nil)
+	mockedDataKeeper.On("Get", context.Background(), 2).Return(&Record{ID: 2, URL: "http://shortener.com", Deleted: true}, nil)
+
+	p := new(memPublisher)
+	c := NewConverter(mockedDataKeeper, Quota{}, nil, p, NewDomains(Domain{}), nil)
+
+	_, err := c.GetOriginal(context.Background(), "", "1")
+	assert.NoError(t, err)
+	assert.Empty(t, p.events, "lookup is not a click")
+
+	_, err = c.Visit(context.Background(), "", "2")
+	assert.Error(t, err)
+	assert.Empty(t, p.events)
+
+	got, err := c.Visit(context.Background(), "", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, got.Redirect.Code)
+	if assert.Len(t, p.events, 1) {
+		assert.Equal(t, EventLinkClicked, p.events[0].Type)
+		assert.Equal(t, "1", p.events[0].LinkID)
+	}
+}
+
+func TestSetRedirect(t *testing.T) {
+	const owner = "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	redirect := Redirect{Code: http.StatusFound, CacheControl: "no-store"}
+
+	tests := []struct {
+		name     string
+		encID    string
+		id       int
+		redirect Redirect
+		res      *Record
+		err      error
+		wantErr  error
+	}{
+		{
+			name:     "ok",
+			encID:    "1",
+			id:       1,
+			redirect: redirect,
+			res:      &Record{ID: 1, URL: "http://shortener.com", UserID: owner},
+		},
+		{
+			name:     "not valid",
+			encID:    "1",
+			id:       1,
+			redirect: Redirect{Code: http.StatusFound, CacheControl: "no-store\r\nSet-Cookie: a=b"},
+			wantErr:  ErrInvalidRedirect,
+		},
+		{
+			name:     "other user",
+			encID:    "2",
+			id:       2,
+			redirect: redirect,
+			res:      &Record{ID: 2, URL: "http://shortener.com", UserID: "user"},
+			wantErr:  ErrNotFound,
+		},
+		{
+			name:     "not found",
+			encID:    "3",
+			id:       3,
+			redirect: redirect,
+			err:      ErrNotFound,
+			wantErr:  ErrNotFound,
+		},
+		{
+			name:     "deleted",
+			encID:    "4",
+			id:       4,
+			redirect: redirect,
+			res:      &Record{ID: 4, URL: "http://shortener.com", UserID: owner, Deleted: true},
+			wantErr:  new(ErrURLDeleted),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("Get", context.Background(), tt.id).Return(tt.res, tt.err)
+			mockedDataKeeper.On("SetRedirect", context.Background(), tt.id, tt.redirect).Return(nil).Once()
+
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+
+			got, err := c.SetRedirect(context.Background(), owner, tt.encID, tt.redirect)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, got)
+				mockedDataKeeper.AssertNotCalled(t, "SetRedirect", context.Background(), tt.id, tt.redirect)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.encID, got.EncodedID)
+			assert.Equal(t, tt.redirect, got.Redirect)
+			mockedDataKeeper.AssertExpectations(t)
 		})
 	}
 }
@@ -202,7 +481,7 @@ func TestGetAllByUser(t *testing.T) {
 		userID  string
 		want    []URL
 		wantErr bool
-		res     map[string]int
+		res     []Record
 		err     error
 	}{
 		{
@@ -216,11 +495,15 @@ func TestGetAllByUser(t *testing.T) {
 				{
 					EncodedID: "3",
 					Original:  "http://shortener.ru",
+					Domain:    "go.brand.com",
 				},
 			},
 			wantErr: false,
-			res:     map[string]int{"http://shortener.com": 1, "http://shortener.ru": 3},
-			err:     nil,
+			res: []Record{
+				{ID: 1, URL: "http://shortener.com"},
+				{ID: 3, URL: "http://shortener.ru", Domain: "go.brand.com"},
+			},
+			err: nil,
 		},
 	}
 
@@ -230,7 +513,7 @@ func TestGetAllByUser(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockedDataKeeper.On("GetAllByUser", context.Background(), tt.userID).Return(tt.res, tt.err)
 
-			c := NewConverter(mockedDataKeeper)
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
 
 			got, err := c.GetAllByUser(context.Background(), tt.userID)
 
@@ -246,11 +529,53 @@ func TestGetAllByUser(t *testing.T) {
 	}
 }
 
+func TestListByUser(t *testing.T) {
+	userID := "21f923fc-cbbf-4fb1-a05c-21933d307be2"
+
+	firstPage := make([]Record, 0, listPageSize)
+	for i := 1; i <= listPageSize; i++ {
+		firstPage = append(firstPage, Record{ID: i, URL: fmt.Sprintf("http://shortener.com/%d", i)})
+	}
+	secondPage := []Record{{ID: listPageSize + 5, URL: "http://shortener.ru"}}
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("GetPageByUser", context.Background(), userID, 0, listPageSize).Return(firstPage, nil).Once()
+	mockedDataKeeper.On("GetPageByUser", context.Background(), userID, listPageSize, listPageSize).Return(secondPage, nil).Once()
+
+	c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+
+	var got []URL
+	err := c.ListByUser(context.Background(), userID, func(u URL) error {
+		got = append(got, u)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, got, listPageSize+1)
+	assert.Equal(t, URL{EncodedID: "1", Original: "http://shortener.com/1"}, got[0])
+	assert.Equal(t, URL{EncodedID: encode(listPageSize + 5), Original: "http://shortener.ru"}, got[listPageSize])
+	mockedDataKeeper.AssertExpectations(t)
+
+	errStop := errors.New("stop")
+	mockedDataKeeper.On("GetPageByUser", context.Background(), userID, 0, listPageSize).Return(firstPage, nil).Once()
+
+	calls := 0
+	err = c.ListByUser(context.Background(), userID, func(u URL) error {
+		calls++
+		return errStop
+	})
+
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
+
 func TestRemoveBatch(t *testing.T) {
 	tests := []struct {
 		name         string
 		batch        map[string][]string
 		decodedBatch map[string][]int
+		deleted      map[string][]int
+		want         map[string][]string
 		wantErr      bool
 		dataErr      error
 	}{
@@ -262,6 +587,12 @@ func TestRemoveBatch(t *testing.T) {
 			decodedBatch: map[string][]int{
 				"21f923fc-cbbf-4fb1-a05c-21933d307be2": {1, 3},
 			},
+			deleted: map[string][]int{
+				"21f923fc-cbbf-4fb1-a05c-21933d307be2": {3},
+			},
+			want: map[string][]string{
+				"21f923fc-cbbf-4fb1-a05c-21933d307be2": {"3"},
+			},
 			wantErr: false,
 			dataErr: nil,
 		},
@@ -271,18 +602,20 @@ func TestRemoveBatch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockedDataKeeper.On("DeleteBatch", context.Background(), tt.decodedBatch).Return(tt.dataErr).Once()
-			c := NewConverter(mockedDataKeeper)
+			mockedDataKeeper.On("DeleteBatch", context.Background(), tt.decodedBatch).Return(tt.deleted, tt.dataErr).Once()
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
 
-			err := c.RemoveBatch(context.Background(), tt.batch)
+			got, err := c.RemoveBatch(context.Background(), tt.batch)
 
 			mockedDataKeeper.AssertExpectations(t)
 
 			if tt.wantErr {
 				assert.Error(t, err)
+				return
 			}
 
 			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
@@ -313,7 +646,7 @@ func TestGetStats(t *testing.T) {
 	for _, tt := range tests {
 		t.Run("ok", func(t *testing.T) {
 			mockedDataKeeper.On("GetStats", context.Background()).Return(tt.urls, tt.users, tt.err).Once()
-			c := NewConverter(mockedDataKeeper)
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
 
 			urls, users, err := c.GetStats(context.Background())
 
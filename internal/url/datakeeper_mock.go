@@ -11,33 +11,51 @@ type mockedDataKeeper struct {
 }
 
 // Add is mocked method.
-func (m *mockedDataKeeper) Add(ctx context.Context, userID, original string) (int, error) {
-	args := m.Called(ctx, userID, original)
+func (m *mockedDataKeeper) Add(ctx context.Context, userID, domain, original string, r Redirect) (int, error) {
+	args := m.Called(ctx, userID, domain, original, r)
 	return args.Int(0), args.Error(1)
 }
 
+// SetRedirect is mocked method.
+func (m *mockedDataKeeper) SetRedirect(ctx context.Context, id int, r Redirect) error {
+	args := m.Called(ctx, id, r)
+	return args.Error(0)
+}
+
 // AddBatch is mocked method.
-func (m *mockedDataKeeper) AddBatch(ctx context.Context, userID string, originals []string) (map[string]int, error) {
-	args := m.Called(ctx, userID, originals)
+func (m *mockedDataKeeper) AddBatch(ctx context.Context, userID, domain string, originals []string) (map[string]int, []int, error) {
+	args := m.Called(ctx, userID, domain, originals)
+	return args.Get(0).(map[string]int), args.Get(1).([]int), args.Error(2)
+}
+
+// FindIDs is mocked method.
+func (m *mockedDataKeeper) FindIDs(ctx context.Context, domain string, originals []string) (map[string]int, error) {
+	args := m.Called(ctx, domain, originals)
 	return args.Get(0).(map[string]int), args.Error(1)
 }
 
 // Get is mocked method.
-func (m *mockedDataKeeper) Get(ctx context.Context, id int) (string, error) {
+func (m *mockedDataKeeper) Get(ctx context.Context, id int) (*Record, error) {
 	args := m.Called(ctx, id)
-	return args.String(0), args.Error(1)
+	return args.Get(0).(*Record), args.Error(1)
 }
 
 // GetAllByUser is mocked method.
-func (m *mockedDataKeeper) GetAllByUser(ctx context.Context, userID string) (map[string]int, error) {
+func (m *mockedDataKeeper) GetAllByUser(ctx context.Context, userID string) ([]Record, error) {
 	args := m.Called(ctx, userID)
-	return args.Get(0).(map[string]int), args.Error(1)
+	return args.Get(0).([]Record), args.Error(1)
+}
+
+// GetPageByUser is mocked method.
+func (m *mockedDataKeeper) GetPageByUser(ctx context.Context, userID string, afterID, limit int) ([]Record, error) {
+	args := m.Called(ctx, userID, afterID, limit)
+	return args.Get(0).([]Record), args.Error(1)
 }
 
 // DeleteBatch is mocked method.
-func (m *mockedDataKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) error {
+func (m *mockedDataKeeper) DeleteBatch(ctx context.Context, batch map[string][]int) (map[string][]int, error) {
 	args := m.Called(ctx, batch)
-	return args.Error(0)
+	return args.Get(0).(map[string][]int), args.Error(1)
 }
 
 // GetStats is mocked method.
@@ -57,3 +75,75 @@ func (m *mockedDataKeeper) Close(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
+
+// CountByUser is mocked method.
+func (m *mockedDataKeeper) CountByUser(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+// GetQuota is mocked method.
+func (m *mockedDataKeeper) GetQuota(ctx context.Context, userID string) (*Quota, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(*Quota), args.Error(1)
+}
+
+// SetQuota is mocked method.
+func (m *mockedDataKeeper) SetQuota(ctx context.Context, userID string, q Quota) error {
+	args := m.Called(ctx, userID, q)
+	return args.Error(0)
+}
+
+// GetOwner is mocked method.
+func (m *mockedDataKeeper) GetOwner(ctx context.Context, id int) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
+// FetchOutbox is mocked method.
+func (m *mockedDataKeeper) FetchOutbox(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]OutboxEvent), args.Error(1)
+}
+
+// AckOutbox is mocked method.
+func (m *mockedDataKeeper) AckOutbox(ctx context.Context, ids []int64) error {
+	args := m.Called(ctx, ids)
+	return args.Error(0)
+}
+
+// Export is mocked method.
+func (m *mockedDataKeeper) Export(ctx context.Context, fn func(Record) error) error {
+	args := m.Called(ctx, fn)
+	return args.Error(0)
+}
+
+// Import is mocked method.
+func (m *mockedDataKeeper) Import(ctx context.Context, records []Record) error {
+	args := m.Called(ctx, records)
+	return args.Error(0)
+}
+
+// NextID is mocked method.
+func (m *mockedDataKeeper) NextID(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+// SetNextID is mocked method.
+func (m *mockedDataKeeper) SetNextID(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Snapshot is mocked method.
+func (m *mockedDataKeeper) Snapshot(ctx context.Context, w SnapshotWriter) error {
+	args := m.Called(ctx, w)
+	return args.Error(0)
+}
+
+// Clear is mocked method.
+func (m *mockedDataKeeper) Clear(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
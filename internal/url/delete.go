@@ -2,8 +2,18 @@ package url
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 const deletePeriod = 10 * time.Second
@@ -12,58 +22,292 @@ const deletePeriod = 10 * time.Second
 type DelBatch struct {
 	UserID     string
 	EncodedIDs []string
+
+	// Actor is the request source for the audit trail.
+	Actor Actor
+
+	// Trace is the span of the request, the flush span is linked to it.
+	Trace trace.SpanContext
+}
+
+// DeleteObserver is notified about the delete buffer, e.g. for metrics.
+type DeleteObserver interface {
+	// DeleteQueued is called with the number of buffered IDs after every
+	// change of the buffer.
+	DeleteQueued(ids int)
+
+	// DeleteFlushed is called after saving of non-empty buffer.
+	DeleteFlushed(ids int, err error)
+}
+
+type nopDeleteObserver struct{}
+
+func (nopDeleteObserver) DeleteQueued(int)         {}
+func (nopDeleteObserver) DeleteFlushed(int, error) {}
+
+const (
+	// maxDeleteTickDelay is the delay of the delete loop after which the
+	// worker is considered stalled.
+	maxDeleteTickDelay = 3 * deletePeriod
+
+	// closeFlushTimeout limits the last flush after the buffer channel is
+	// closed. The last flush after Stop is limited by the Stop context.
+	closeFlushTimeout = 5 * time.Second
+)
+
+// DeleteWorker is the state of the delete goroutine.
+type DeleteWorker struct {
+	tick     atomic.Int64
+	stop     chan context.Context
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newDeleteWorker() *DeleteWorker {
+	w := &DeleteWorker{
+		stop: make(chan context.Context, 1),
+		done: make(chan struct{}),
+	}
+	w.beat()
+
+	return w
+}
+
+func (w *DeleteWorker) beat() {
+	w.tick.Store(time.Now().UnixNano())
+}
+
+// Check returns error if the goroutine is stopped or stalled.
+func (w *DeleteWorker) Check(ctx context.Context) error {
+	select {
+	case <-w.done:
+		return errors.New("delete worker is stopped")
+	default:
+	}
+
+	if delay := time.Since(time.Unix(0, w.tick.Load())); delay > maxDeleteTickDelay {
+		return fmt.Errorf("delete worker is stalled for %s", delay.Round(time.Second))
+	}
+
+	return ctx.Err()
+}
+
+// Stop stops receiving from the buffer channel and flushes the buffer
+// within ctx. The channel is not closed, so late senders do not panic but
+// block until their context is done.
+func (w *DeleteWorker) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		w.stop <- ctx
+	})
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // StartDeleteURL starts goroutine to periodic deleting URLs and returns
-// the channel to receive buffer items. To stop deleting it is needed to
-// close the channel.
-func StartDeleteURL(ctx context.Context, c Converter) chan *DelBatch {
+// the channel to receive buffer items and the goroutine state. Deleting
+// stops with DeleteWorker.Stop or when the channel is closed. Deleted URLs
+// are recorded to the audit sink if a is not nil, the buffer changes are
+// reported to o if it is not nil. l logs the flush results, nil discards
+// them. ctx limits the periodic flushes, it should outlive the senders.
+func StartDeleteURL(ctx context.Context, c Converter, a AuditSink, o DeleteObserver, l *zap.Logger) (chan *DelBatch, *DeleteWorker) {
 	delBuf := make(chan *DelBatch)
 
-	go deleteURL(ctx, delBuf, c)
+	if a == nil {
+		a = NewNopAuditSink()
+	}
 
-	return delBuf
+	if o == nil {
+		o = nopDeleteObserver{}
+	}
+
+	w := newDeleteWorker()
+	go deleteURL(ctx, delBuf, w, c, a, o, logger.OrNop(l))
+
+	return delBuf, w
 }
 
-func deleteURL(ctx context.Context, delBuf chan *DelBatch, c Converter) {
+func deleteURL(ctx context.Context, delBuf chan *DelBatch, w *DeleteWorker, c Converter, a AuditSink, o DeleteObserver, l *zap.Logger) {
 	buf := make(map[string][]string)
+	var events []AuditEvent
+	var links []trace.Link
+
+	add := func(batch *DelBatch) {
+		if URLs, ok := buf[batch.UserID]; ok {
+			buf[batch.UserID] = unq(URLs, batch.EncodedIDs)
+		} else {
+			buf[batch.UserID] = unq(batch.EncodedIDs)
+		}
+		events = append(events, deleteEvents(batch)...)
+		if batch.Trace.IsValid() {
+			links = append(links, trace.Link{SpanContext: batch.Trace})
+		}
+		o.DeleteQueued(countIDs(buf))
+	}
+
+	var stopCtx context.Context
+
+	defer close(w.done)
 
 	defer func() {
-		onCloseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+		flushCtx := stopCtx
+		if flushCtx == nil {
+			var cancel context.CancelFunc
+			flushCtx, cancel = context.WithTimeout(context.Background(), closeFlushTimeout)
+			defer cancel()
+		}
 
-		err := c.RemoveBatch(onCloseCtx, buf)
+		ids := countIDs(buf)
+		deleted, err := flush(flushCtx, c, buf, links)
+		observeFlush(o, buf, err)
 		if err != nil {
-			log.Printf("on close delete URL batch error: %v\n", err)
+			l.Error("on close delete URL batch error", zap.Int("ids", ids), zap.Error(err))
 			return
 		}
-		log.Printf("URL batch deleted on close\n")
+		l.Debug("URL batch deleted on close", zap.Int("ids", ids))
+
+		writeAudit(flushCtx, l, a, deletedEvents(events, deleted))
 	}()
 
 	t := time.NewTimer(deletePeriod)
+	defer t.Stop()
+
 	for {
 		select {
+		case stopCtx = <-w.stop:
+			// Batches of the senders waiting right now are flushed too.
+			for {
+				select {
+				case batch, ok := <-delBuf:
+					if !ok {
+						return
+					}
+					add(batch)
+				default:
+					return
+				}
+			}
 		case batch, ok := <-delBuf:
 			if !ok {
 				return
 			}
-			if URLs, ok := buf[batch.UserID]; ok {
-				buf[batch.UserID] = unq(URLs, batch.EncodedIDs)
-			} else {
-				buf[batch.UserID] = unq(batch.EncodedIDs)
-			}
+			w.beat()
+			add(batch)
 		case <-t.C:
-			err := c.RemoveBatch(ctx, buf)
+			w.beat()
+			ids := countIDs(buf)
+			deleted, err := flush(ctx, c, buf, links)
+			observeFlush(o, buf, err)
 			t.Reset(deletePeriod)
 			if err != nil {
-				log.Printf("delete URL batch error: %v\n", err)
+				l.Error("delete URL batch error", zap.Int("ids", ids), zap.Error(err))
 				continue
 			}
-			log.Printf("URL batch deleted\n")
+			l.Debug("URL batch deleted", zap.Int("ids", ids))
+
+			writeAudit(ctx, l, a, deletedEvents(events, deleted))
 
 			buf = make(map[string][]string)
+			events = nil
+			links = nil
+			o.DeleteQueued(0)
+		}
+	}
+}
+
+// flush removes the buffered URLs and returns the encoded IDs of the removed
+// ones. The flush span is linked to the spans of the delete requests. Empty
+// buffer is not flushed.
+func flush(ctx context.Context, c Converter, buf map[string][]string, links []trace.Link) (map[string][]string, error) {
+	ids := countIDs(buf)
+	if ids == 0 {
+		return nil, nil
+	}
+
+	ctx, span := otel.Tracer("github.com/ruskiiamov/shortener/internal/url").Start(ctx, "DeleteFlush",
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("shortener.delete.ids", ids)),
+	)
+	defer span.End()
+
+	deleted, err := c.RemoveBatch(ctx, buf)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return deleted, err
+}
+
+func observeFlush(o DeleteObserver, buf map[string][]string, err error) {
+	if ids := countIDs(buf); ids > 0 {
+		o.DeleteFlushed(ids, err)
+	}
+}
+
+func countIDs(buf map[string][]string) int {
+	n := 0
+	for _, ids := range buf {
+		n += len(ids)
+	}
+
+	return n
+}
+
+// deletedEvents returns the events of the deleted IDs only, one per ID. IDs
+// of other users, unknown and already deleted ones are not deleted by the
+// flush, so they are not audited.
+func deletedEvents(events []AuditEvent, deleted map[string][]string) []AuditEvent {
+	pending := make(map[string]map[string]bool, len(deleted))
+	for userID, ids := range deleted {
+		pending[userID] = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			pending[userID][id] = true
 		}
 	}
+
+	var result []AuditEvent
+	for _, e := range events {
+		if pending[e.UserID][e.LinkID] {
+			delete(pending[e.UserID], e.LinkID)
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+func deleteEvents(batch *DelBatch) []AuditEvent {
+	events := make([]AuditEvent, 0, len(batch.EncodedIDs))
+	now := time.Now().UTC()
+
+	for _, encodedID := range batch.EncodedIDs {
+		events = append(events, AuditEvent{
+			Time:      now,
+			Action:    ActionDeleted,
+			UserID:    batch.UserID,
+			LinkID:    encodedID,
+			IP:        batch.Actor.IP,
+			Transport: batch.Actor.Transport,
+		})
+	}
+
+	return events
+}
+
+func writeAudit(ctx context.Context, l *zap.Logger, a AuditSink, events []AuditEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	if err := a.Write(ctx, events...); err != nil {
+		l.Error("audit write error", zap.Error(err))
+	}
 }
 
 func unq(URLs ...[]string) []string {
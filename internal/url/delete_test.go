@@ -0,0 +1,80 @@
+package url
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteWorker(t *testing.T) {
+	c := NewConverter(new(mockedDataKeeper), Quota{}, nil, nil, nil, nil)
+
+	delBuf, w := StartDeleteURL(context.Background(), c, nil, nil, nil)
+	assert.NoError(t, w.Check(context.Background()))
+
+	w.tick.Store(time.Now().Add(-maxDeleteTickDelay - time.Second).UnixNano())
+	assert.ErrorContains(t, w.Check(context.Background()), "stalled")
+
+	close(delBuf)
+	assert.Eventually(t, func() bool {
+		err := w.Check(context.Background())
+		return err != nil && err.Error() == "delete worker is stopped"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDeleteWorkerStop(t *testing.T) {
+	userID := "21f923fc-cbbf-4fb1-a05c-21933d307be2"
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("DeleteBatch", mock.Anything, map[string][]int{userID: {1, 3}}).Return(map[string][]int{userID: {1, 3}}, nil).Once()
+	c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+
+	delBuf, w := StartDeleteURL(context.Background(), c, nil, nil, nil)
+	delBuf <- &DelBatch{UserID: userID, EncodedIDs: []string{"1", "3"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, w.Stop(ctx))
+	assert.NoError(t, w.Stop(ctx))
+	assert.Error(t, w.Check(context.Background()))
+	mockedDataKeeper.AssertExpectations(t)
+
+	// Late senders are not received but do not panic.
+	select {
+	case delBuf <- &DelBatch{UserID: userID, EncodedIDs: []string{"5"}}:
+		t.Fatal("batch is received after stop")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestDeleteWorkerAudit(t *testing.T) {
+	userID := "21f923fc-cbbf-4fb1-a05c-21933d307be2"
+	otherID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("DeleteBatch", mock.Anything, mock.Anything).Return(map[string][]int{userID: {1}}, nil).Once()
+	c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+
+	a := new(memAuditSink)
+	delBuf, w := StartDeleteURL(context.Background(), c, a, nil, nil)
+	delBuf <- &DelBatch{UserID: userID, EncodedIDs: []string{"1", "3"}, Actor: Actor{IP: "10.0.0.1"}}
+	delBuf <- &DelBatch{UserID: userID, EncodedIDs: []string{"1"}}
+	delBuf <- &DelBatch{UserID: otherID, EncodedIDs: []string{"1"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, w.Stop(ctx))
+	mockedDataKeeper.AssertExpectations(t)
+
+	if assert.Len(t, a.events, 1) {
+		assert.Equal(t, ActionDeleted, a.events[0].Action)
+		assert.Equal(t, userID, a.events[0].UserID)
+		assert.Equal(t, "1", a.events[0].LinkID)
+		assert.Equal(t, "10.0.0.1", a.events[0].IP)
+	}
+}
@@ -0,0 +1,136 @@
+package url
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+var (
+	// ErrUnknownDomain is for links created on the domain not configured.
+	ErrUnknownDomain = errors.New("domain not known")
+
+	// ErrDomainForbidden is for users not allowed to create links on the
+	// domain.
+	ErrDomainForbidden = errors.New("domain not allowed for user")
+)
+
+// Domain is the domain of the short links. Every link belongs to one
+// domain and is resolved only on requests to it, so the same original URL
+// may be shortened once per domain.
+type Domain struct {
+	// Name is the host of the domain. It is empty for the default domain,
+	// the links created before domains were introduced belong to it.
+	Name string
+
+	// BaseURL is the prefix of the short links.
+	BaseURL string
+
+	// RedirectCode is the HTTP status of the redirects, zero means
+	// 307 Temporary Redirect.
+	RedirectCode int
+
+	// AllowedUsers are the only users creating links on the domain, empty
+	// means all users.
+	AllowedUsers []string
+
+	// NotFoundPage is the HTML page responded for unknown links, empty
+	// means the problem details response.
+	NotFoundPage []byte
+}
+
+// StatusCode returns the redirect status of the domain links without their
+// own code.
+func (d *Domain) StatusCode() int {
+	if d.RedirectCode != 0 {
+		return d.RedirectCode
+	}
+
+	return http.StatusTemporaryRedirect
+}
+
+// Allows reports whether the user may create links on the domain.
+func (d *Domain) Allows(userID string) bool {
+	if len(d.AllowedUsers) == 0 {
+		return true
+	}
+
+	for _, allowed := range d.AllowedUsers {
+		if allowed == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ShortURL returns the short URL of the link with encodedID.
+func (d *Domain) ShortURL(encodedID string) string {
+	return d.BaseURL + "/" + encodedID
+}
+
+// Domains is the set of the configured domains.
+type Domains struct {
+	def    *Domain
+	byName map[string]*Domain
+}
+
+// NewDomains returns the domains with the default one. The default domain
+// is also known by the host of its base URL. Names of the others must be
+// unique, later ones replace earlier ones.
+func NewDomains(def Domain, others ...Domain) *Domains {
+	def.Name = ""
+	d := &Domains{
+		def:    &def,
+		byName: make(map[string]*Domain, len(others)+1),
+	}
+
+	if u, err := neturl.Parse(def.BaseURL); err == nil && u.Hostname() != "" {
+		d.byName[strings.ToLower(u.Hostname())] = d.def
+	}
+
+	for i := range others {
+		dom := others[i]
+		dom.Name = strings.ToLower(dom.Name)
+		d.byName[dom.Name] = &dom
+	}
+
+	return d
+}
+
+// Default returns the default domain.
+func (d *Domains) Default() *Domain {
+	return d.def
+}
+
+// Get returns the domain by name, empty name means the default domain.
+func (d *Domains) Get(name string) (*Domain, error) {
+	if name == "" {
+		return d.def, nil
+	}
+
+	dom, ok := d.byName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDomain, name)
+	}
+
+	return dom, nil
+}
+
+// Resolve returns the domain of the request host, the port is ignored.
+// Unknown hosts and the domains removed from the configuration resolve to
+// the default domain.
+func (d *Domains) Resolve(host string) *Domain {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if dom, ok := d.byName[strings.ToLower(host)]; ok {
+		return dom
+	}
+
+	return d.def
+}
@@ -0,0 +1,53 @@
+package url
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomains(t *testing.T) {
+	d := NewDomains(
+		Domain{Name: "ignored", BaseURL: "http://short.example.com:8080"},
+		Domain{Name: "Go.Brand.com", BaseURL: "https://go.brand.com"},
+	)
+
+	tests := []struct {
+		name    string
+		domain  string
+		want    string
+		wantErr error
+	}{
+		{name: "default", domain: "", want: ""},
+		{name: "default host", domain: "short.example.com", want: ""},
+		{name: "case insensitive", domain: "GO.BRAND.COM", want: "go.brand.com"},
+		{name: "unknown", domain: "other.com", wantErr: ErrUnknownDomain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Get(tt.domain)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Name)
+		})
+	}
+
+	assert.Equal(t, "go.brand.com", d.Resolve("go.brand.com:443").Name)
+	assert.Equal(t, "", d.Resolve("short.example.com:8080").Name)
+	assert.Equal(t, "", d.Resolve("removed.com").Name)
+	assert.Equal(t, "https://go.brand.com/1", d.Resolve("go.brand.com").ShortURL("1"))
+}
+
+func TestDomainAllows(t *testing.T) {
+	open := Domain{}
+	assert.True(t, open.Allows("user"))
+
+	closed := Domain{AllowedUsers: []string{"owner"}}
+	assert.True(t, closed.Allows("owner"))
+	assert.False(t, closed.Allows("user"))
+}
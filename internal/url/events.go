@@ -0,0 +1,58 @@
+package url
+
+import (
+	"context"
+	"time"
+)
+
+// Link event types.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+// LinkEvent is the domain event of the link lifecycle.
+type LinkEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	UserID string    `json:"user_id,omitempty"`
+	LinkID string    `json:"link_id"`
+	URL    string    `json:"url,omitempty"`
+}
+
+// EventPublisher delivers link events to integrations. Publish must not
+// block the caller.
+type EventPublisher interface {
+	Publish(e LinkEvent)
+}
+
+type nopPublisher struct{}
+
+// NewNopPublisher returns EventPublisher that discards all events.
+func NewNopPublisher() EventPublisher {
+	return nopPublisher{}
+}
+
+// Publish discards the event.
+func (nopPublisher) Publish(e LinkEvent) {}
+
+// GetOwner returns the user ID of the link owner.
+func (c *converter) GetOwner(ctx context.Context, encodedID string) (string, error) {
+	id, err := decode(encodedID)
+	if err != nil {
+		return "", err
+	}
+
+	return c.dataKeeper.GetOwner(ctx, id)
+}
+
+func (c *converter) publish(eventType, userID string, u *URL) {
+	c.publisher.Publish(LinkEvent{
+		Type:   eventType,
+		Time:   time.Now().UTC(),
+		UserID: userID,
+		LinkID: u.EncodedID,
+		URL:    u.Original,
+	})
+}
@@ -0,0 +1,29 @@
+package url
+
+import "time"
+
+// OutboxEvent is the link event saved by DataKeeper in the same transaction
+// as the link change.
+type OutboxEvent struct {
+	// ID is the outbox sequence number.
+	ID int64 `json:"id"`
+
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	UserID string    `json:"user_id"`
+
+	// URLID is the URL id in data storage.
+	URLID int    `json:"url_id"`
+	URL   string `json:"url,omitempty"`
+}
+
+// LinkEvent returns the event with encoded link ID.
+func (e *OutboxEvent) LinkEvent() LinkEvent {
+	return LinkEvent{
+		Type:   e.Type,
+		Time:   e.Time,
+		UserID: e.UserID,
+		LinkID: encode(e.URLID),
+		URL:    e.URL,
+	}
+}
@@ -0,0 +1,153 @@
+package url
+
+import (
+	"context"
+	"fmt"
+)
+
+// Quota limit names.
+const (
+	QuotaLinks     = "links"
+	QuotaBatchSize = "batch_size"
+	QuotaDeleteIDs = "delete_ids"
+)
+
+// Unlimited is the user override value that lifts the default limit.
+const Unlimited = -1
+
+// Quota is the set of hard per-user limits. Zero value means no limit.
+//
+// In the user override zero field keeps the default limit and Unlimited
+// lifts it, so the override with all fields zero resets the user to the
+// defaults.
+type Quota struct {
+	// MaxLinks is the maximum number of active links.
+	MaxLinks int `json:"max_links"`
+
+	// MaxBatchSize is the maximum number of URLs in one batch.
+	MaxBatchSize int `json:"max_batch_size"`
+
+	// MaxDeleteIDs is the maximum number of IDs in one delete request.
+	MaxDeleteIDs int `json:"max_delete_ids"`
+}
+
+// QuotaUsage is the user quota with the current usage.
+type QuotaUsage struct {
+	Quota
+
+	// Links is the number of active user links.
+	Links int `json:"links"`
+}
+
+// ErrQuotaExceeded is for exceeding one of the user quotas.
+type ErrQuotaExceeded struct {
+	// Name of the exceeded limit.
+	Name string
+
+	// Limit value.
+	Limit int
+}
+
+// Error implements error interface.
+func (e *ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota %s exceeded: limit is %d", e.Name, e.Limit)
+}
+
+// GetQuota returns user quota with the current usage.
+func (c *converter) GetQuota(ctx context.Context, userID string) (*QuotaUsage, error) {
+	q, err := c.userQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := c.dataKeeper.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("data keeper error: %w", err)
+	}
+
+	return &QuotaUsage{Quota: *q, Links: links}, nil
+}
+
+// SetQuota saves the quota override for user, see Quota for the override
+// values.
+func (c *converter) SetQuota(ctx context.Context, userID string, q Quota) error {
+	if q.MaxLinks < Unlimited || q.MaxBatchSize < Unlimited || q.MaxDeleteIDs < Unlimited {
+		return fmt.Errorf("%w: values must not be less than %d", ErrInvalidQuota, Unlimited)
+	}
+
+	if err := c.dataKeeper.SetQuota(ctx, userID, q); err != nil {
+		return fmt.Errorf("data keeper error: %w", err)
+	}
+
+	c.audit(ctx, NewAuditEvent(ctx, ActionQuotaChanged, userID))
+
+	return nil
+}
+
+// ValidateDelete checks the delete request against the user quota.
+func (c *converter) ValidateDelete(ctx context.Context, userID string, encodedIDs []string) error {
+	q, err := c.userQuota(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if q.MaxDeleteIDs > 0 && len(encodedIDs) > q.MaxDeleteIDs {
+		return &ErrQuotaExceeded{Name: QuotaDeleteIDs, Limit: q.MaxDeleteIDs}
+	}
+
+	for _, encodedID := range encodedIDs {
+		if _, err := decode(encodedID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// userQuota returns the default quota with the user override fields over
+// it.
+func (c *converter) userQuota(ctx context.Context, userID string) (*Quota, error) {
+	override, err := c.dataKeeper.GetQuota(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("data keeper error: %w", err)
+	}
+
+	q := c.quota
+	if override == nil {
+		return &q, nil
+	}
+
+	q.MaxLinks = overrideLimit(q.MaxLinks, override.MaxLinks)
+	q.MaxBatchSize = overrideLimit(q.MaxBatchSize, override.MaxBatchSize)
+	q.MaxDeleteIDs = overrideLimit(q.MaxDeleteIDs, override.MaxDeleteIDs)
+
+	return &q, nil
+}
+
+func overrideLimit(limit, override int) int {
+	switch {
+	case override == Unlimited:
+		return 0
+	case override > 0:
+		return override
+	default:
+		return limit
+	}
+}
+
+func (c *converter) checkLinks(ctx context.Context, q *Quota, userID string, n int) error {
+	if q.MaxLinks == 0 {
+		return nil
+	}
+
+	links, err := c.dataKeeper.CountByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("data keeper error: %w", err)
+	}
+
+	if links+n > q.MaxLinks {
+		return &ErrQuotaExceeded{Name: QuotaLinks, Limit: q.MaxLinks}
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package url
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortenQuota(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+	original := "https://shortener.com"
+
+	tests := []struct {
+		name     string
+		existing map[string]int
+		wantErr  error
+	}{
+		{
+			name:     "new",
+			existing: map[string]int{},
+			wantErr:  &ErrQuotaExceeded{Name: QuotaLinks, Limit: 10},
+		},
+		{
+			name:     "duplicate",
+			existing: map[string]int{original: 7},
+			wantErr:  &ErrURLDuplicate{ID: 7, EncodedID: encode(7), URL: original},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("GetQuota", context.Background(), userID).Return((*Quota)(nil), nil)
+			mockedDataKeeper.On("FindIDs", context.Background(), "", []string{original}).Return(tt.existing, nil)
+			mockedDataKeeper.On("CountByUser", context.Background(), userID).Return(10, nil)
+
+			c := NewConverter(mockedDataKeeper, Quota{MaxLinks: 10}, nil, nil, nil, nil)
+			got, err := c.Shorten(context.Background(), userID, "", original, Redirect{})
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Nil(t, got)
+			mockedDataKeeper.AssertNotCalled(t, "Add", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestShortenBatchQuota(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	tests := []struct {
+		name      string
+		quota     Quota
+		override  *Quota
+		links     int
+		existing  map[string]int
+		originals []string
+		exceeded  string
+	}{
+		{
+			name:      "batch size",
+			quota:     Quota{MaxBatchSize: 1},
+			originals: []string{"https://shortener.com", "https://shortener2.ru"},
+			exceeded:  QuotaBatchSize,
+		},
+		{
+			name:      "links",
+			quota:     Quota{MaxLinks: 10},
+			links:     9,
+			existing:  map[string]int{},
+			originals: []string{"https://shortener.com", "https://shortener2.ru"},
+			exceeded:  QuotaLinks,
+		},
+		{
+			name:      "links with existing",
+			quota:     Quota{MaxLinks: 10},
+			links:     9,
+			existing:  map[string]int{"https://shortener.com": 1},
+			originals: []string{"https://shortener.com", "https://shortener2.ru", "https://shortener3.org"},
+			exceeded:  QuotaLinks,
+		},
+		{
+			name:      "override",
+			quota:     Quota{MaxLinks: 100},
+			override:  &Quota{MaxLinks: 2},
+			links:     1,
+			existing:  map[string]int{},
+			originals: []string{"https://shortener.com", "https://shortener2.ru"},
+			exceeded:  QuotaLinks,
+		},
+		{
+			name:      "override keeps defaults",
+			quota:     Quota{MaxBatchSize: 1},
+			override:  &Quota{MaxLinks: 100},
+			originals: []string{"https://shortener.com", "https://shortener2.ru"},
+			exceeded:  QuotaBatchSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("GetQuota", context.Background(), userID).Return(tt.override, nil)
+			mockedDataKeeper.On("FindIDs", context.Background(), "", tt.originals).Return(tt.existing, nil)
+			mockedDataKeeper.On("CountByUser", context.Background(), userID).Return(tt.links, nil)
+
+			c := NewConverter(mockedDataKeeper, tt.quota, nil, nil, nil, nil)
+			got, err := c.ShortenBatch(context.Background(), userID, "", tt.originals)
+
+			var errQuota *ErrQuotaExceeded
+			assert.ErrorAs(t, err, &errQuota)
+			assert.Equal(t, tt.exceeded, errQuota.Name)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func TestShortenBatchQuotaExisting(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+	originals := []string{"https://shortener.com", "https://shortener2.ru"}
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("GetQuota", context.Background(), userID).Return((*Quota)(nil), nil)
+	mockedDataKeeper.On("FindIDs", context.Background(), "", originals).Return(map[string]int{originals[0]: 1}, nil)
+	mockedDataKeeper.On("CountByUser", context.Background(), userID).Return(9, nil)
+	mockedDataKeeper.On("AddBatch", context.Background(), userID, "", originals).
+		Return(map[string]int{originals[0]: 1, originals[1]: 2}, []int{2}, nil)
+
+	c := NewConverter(mockedDataKeeper, Quota{MaxLinks: 10}, nil, nil, nil, nil)
+	got, err := c.ShortenBatch(context.Background(), userID, "", originals)
+
+	mockedDataKeeper.AssertExpectations(t)
+
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+}
+
+func TestValidateDelete(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	tests := []struct {
+		name       string
+		encodedIDs []string
+		wantErr    bool
+	}{
+		{
+			name:       "ok",
+			encodedIDs: []string{"1", "2"},
+			wantErr:    false,
+		},
+		{
+			name:       "too many",
+			encodedIDs: []string{"1", "2", "3"},
+			wantErr:    true,
+		},
+		{
+			name:       "not valid",
+			encodedIDs: []string{"1", "-"},
+			wantErr:    true,
+		},
+	}
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("GetQuota", context.Background(), userID).Return((*Quota)(nil), nil)
+
+	c := NewConverter(mockedDataKeeper, Quota{MaxDeleteIDs: 2}, nil, nil, nil, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.ValidateDelete(context.Background(), userID, tt.encodedIDs)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGetQuota(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	tests := []struct {
+		name     string
+		override *Quota
+		want     Quota
+	}{
+		{
+			name: "default",
+			want: Quota{MaxLinks: 10, MaxBatchSize: 5},
+		},
+		{
+			name:     "override",
+			override: &Quota{MaxLinks: 20, MaxDeleteIDs: 3},
+			want:     Quota{MaxLinks: 20, MaxBatchSize: 5, MaxDeleteIDs: 3},
+		},
+		{
+			name:     "unlimited",
+			override: &Quota{MaxLinks: Unlimited},
+			want:     Quota{MaxBatchSize: 5},
+		},
+		{
+			name:     "reset",
+			override: &Quota{},
+			want:     Quota{MaxLinks: 10, MaxBatchSize: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("GetQuota", context.Background(), userID).Return(tt.override, nil)
+			mockedDataKeeper.On("CountByUser", context.Background(), userID).Return(3, nil)
+
+			c := NewConverter(mockedDataKeeper, Quota{MaxLinks: 10, MaxBatchSize: 5}, nil, nil, nil, nil)
+
+			got, err := c.GetQuota(context.Background(), userID)
+
+			mockedDataKeeper.AssertExpectations(t)
+
+			assert.NoError(t, err)
+			assert.Equal(t, &QuotaUsage{Quota: tt.want, Links: 3}, got)
+		})
+	}
+}
+
+func TestShortenBatchQuotaUnlimited(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+	originals := []string{"https://shortener.com", "https://shortener2.ru"}
+
+	mockedDataKeeper := new(mockedDataKeeper)
+	mockedDataKeeper.On("GetQuota", context.Background(), userID).Return(&Quota{MaxLinks: Unlimited, MaxBatchSize: Unlimited}, nil)
+	mockedDataKeeper.On("AddBatch", context.Background(), userID, "", originals).
+		Return(map[string]int{originals[0]: 1, originals[1]: 2}, []int{1, 2}, nil)
+
+	c := NewConverter(mockedDataKeeper, Quota{MaxLinks: 1, MaxBatchSize: 1}, nil, nil, nil, nil)
+	got, err := c.ShortenBatch(context.Background(), userID, "", originals)
+
+	mockedDataKeeper.AssertExpectations(t)
+	mockedDataKeeper.AssertNotCalled(t, "CountByUser", mock.Anything, mock.Anything)
+
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+}
+
+func TestSetQuota(t *testing.T) {
+	userID := "7b6def87-f3dc-4036-bda2-3a6ca1298ef5"
+
+	tests := []struct {
+		name    string
+		quota   Quota
+		wantErr bool
+	}{
+		{name: "limits", quota: Quota{MaxLinks: 5, MaxBatchSize: 2}},
+		{name: "unlimited", quota: Quota{MaxLinks: Unlimited}},
+		{name: "not valid", quota: Quota{MaxDeleteIDs: -2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedDataKeeper := new(mockedDataKeeper)
+			mockedDataKeeper.On("SetQuota", context.Background(), userID, tt.quota).Return(nil)
+
+			c := NewConverter(mockedDataKeeper, Quota{}, nil, nil, nil, nil)
+			err := c.SetQuota(context.Background(), userID, tt.quota)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidQuota)
+				mockedDataKeeper.AssertNotCalled(t, "SetQuota", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			mockedDataKeeper.AssertExpectations(t)
+		})
+	}
+}
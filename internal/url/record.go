@@ -0,0 +1,39 @@
+package url
+
+// Record is the stored URL with its id, owner and state. Records are used
+// to move data between data storages without breaking the short links.
+type Record struct {
+	// ID is the URL id in data storage.
+	ID int `json:"id"`
+
+	URL     string `json:"url"`
+	UserID  string `json:"user_id"`
+	Deleted bool   `json:"deleted"`
+
+	// Domain is the name of the link domain, empty for the default one.
+	Domain string `json:"domain,omitempty"`
+
+	// Redirect is the redirect semantics of the link.
+	Redirect
+}
+
+// EncodedID returns the ID used in shortened URL.
+func (r *Record) EncodedID() string {
+	return encode(r.ID)
+}
+
+func (r *Record) url() URL {
+	return URL{EncodedID: r.EncodedID(), Original: r.URL, Domain: r.Domain, Redirect: r.Redirect}
+}
+
+// SnapshotWriter receives the consistent copy of data storage.
+type SnapshotWriter interface {
+	// WriteNextID is called first with the id of the next saved URL.
+	WriteNextID(id int) error
+
+	// WriteRecord is called for all records in id order.
+	WriteRecord(r Record) error
+
+	// WriteQuota is called for all user quota overrides.
+	WriteQuota(userID string, q Quota) error
+}
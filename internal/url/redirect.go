@@ -0,0 +1,47 @@
+package url
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxCacheControl limits the length of the link Cache-Control header.
+const maxCacheControl = 256
+
+// ErrInvalidRedirect is for the redirect settings not supported.
+var ErrInvalidRedirect = errors.New("redirect not valid")
+
+// Redirect is the redirect semantics of the link.
+type Redirect struct {
+	// Code is the HTTP status of the redirect: 301, 302, 307 or 308. Zero
+	// means the default of the link domain.
+	Code int `json:"redirect_code,omitempty"`
+
+	// CacheControl is the Cache-Control header of the redirect, empty means
+	// no header.
+	CacheControl string `json:"cache_control,omitempty"`
+}
+
+// Validate returns ErrInvalidRedirect for the code not supported or the
+// cache header not valid.
+func (r Redirect) Validate() error {
+	switch r.Code {
+	case 0, http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("%w: code %d", ErrInvalidRedirect, r.Code)
+	}
+
+	if len(r.CacheControl) > maxCacheControl {
+		return fmt.Errorf("%w: cache control longer than %d", ErrInvalidRedirect, maxCacheControl)
+	}
+
+	for i := 0; i < len(r.CacheControl); i++ {
+		if c := r.CacheControl[i]; (c < ' ' && c != '\t') || c > '~' {
+			return fmt.Errorf("%w: cache control %q", ErrInvalidRedirect, r.CacheControl)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,435 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/ruskiiamov/shortener/internal/logger"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"go.uber.org/zap"
+)
+
+// Webhook request headers.
+const (
+	SignatureHeader = "X-Shortener-Signature"
+	TimestampHeader = "X-Shortener-Timestamp"
+	EventHeader     = "X-Shortener-Event"
+	DeliveryHeader  = "X-Shortener-Delivery"
+)
+
+var (
+	// ErrNotFound is for unknown endpoint.
+	ErrNotFound = errors.New("webhook endpoint not found")
+
+	// ErrInvalidEndpoint is for endpoint with not valid URL or event types.
+	ErrInvalidEndpoint = errors.New("webhook endpoint not valid")
+)
+
+// OwnerFunc returns the link owner for events without user ID.
+type OwnerFunc func(ctx context.Context, linkID string) (string, error)
+
+// Options are the delivery parameters.
+type Options struct {
+	// QueueSize is the number of events waiting for dispatch. Published
+	// events are dropped when the queue is full, enqueued events wait.
+	QueueSize int
+
+	// Workers is the number of concurrent requests. The delivery waiting
+	// for the retry doesn't take a worker.
+	Workers int
+
+	// MaxAttempts is the number of attempts before the dead letter.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the second attempt. It doubles for
+	// each next attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Timeout is the limit for one request.
+	Timeout time.Duration
+
+	// AllowedSubnets are the not public subnets the endpoints may be in.
+	// Other loopback, private and link-local addresses are rejected.
+	AllowedSubnets []*net.IPNet
+
+	// Logger logs the dispatch errors, nil discards them.
+	Logger *zap.Logger
+}
+
+// DefaultOptions returns the production delivery parameters.
+func DefaultOptions() Options {
+	return Options{
+		QueueSize:   1024,
+		Workers:     8,
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// job is the queued event. done receives the dispatch result if not nil.
+type job struct {
+	e    url.LinkEvent
+	done chan<- error
+}
+
+type dispatcher struct {
+	store  Store
+	owner  OwnerFunc
+	opts   Options
+	client *http.Client
+	guard  *guard
+	queue  chan job
+	sem    chan struct{}
+	log    *zap.Logger
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher returns webhook dispatcher. It implements Service,
+// url.EventPublisher and outbox.Enqueuer interfaces. Deliveries start after Start call.
+func NewDispatcher(s Store, owner OwnerFunc, opts Options) *dispatcher {
+	g := newGuard(opts.AllowedSubnets)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = g.dialer(opts.Timeout).DialContext
+
+	return &dispatcher{
+		store:  s,
+		owner:  owner,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout, Transport: transport},
+		guard:  g,
+		queue:  make(chan job, opts.QueueSize),
+		sem:    make(chan struct{}, opts.Workers),
+		log:    logger.OrNop(opts.Logger),
+	}
+}
+
+// Start runs dispatching until ctx is done.
+func (d *dispatcher) Start(ctx context.Context) {
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case j := <-d.queue:
+				err := d.dispatch(ctx, j.e)
+				if err != nil {
+					d.log.Error("webhook dispatch error", zap.String("type", j.e.Type), zap.String("link_id", j.e.LinkID), zap.Error(err))
+				}
+				if j.done != nil {
+					j.done <- err
+				}
+			}
+		}
+	}()
+}
+
+// Wait blocks until all started deliveries are finished.
+func (d *dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Publish queues the event without blocking.
+func (d *dispatcher) Publish(e url.LinkEvent) {
+	select {
+	case d.queue <- job{e: e}:
+	default:
+		d.log.Warn("webhook queue is full, event dropped", zap.String("type", e.Type), zap.String("link_id", e.LinkID))
+	}
+}
+
+// Enqueue waits for the queue and the dispatch of the event. It returns nil
+// when the deliveries to all subscribed endpoints are started, their results
+// are saved to the store. Otherwise the event should be enqueued again.
+func (d *dispatcher) Enqueue(ctx context.Context, e url.LinkEvent) error {
+	done := make(chan error, 1)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case d.queue <- job{e: e, done: done}:
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// Register saves new endpoint with generated secret. The endpoint host must
+// resolve to public addresses only.
+func (d *dispatcher) Register(ctx context.Context, userID, endpointURL string, events []string) (*Endpoint, error) {
+	u, err := neturl.ParseRequestURI(endpointURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: URL %s", ErrInvalidEndpoint, endpointURL)
+	}
+
+	if err = d.guard.checkHost(ctx, u.Hostname()); err != nil {
+		return nil, err
+	}
+
+	for _, t := range events {
+		if t != url.EventLinkCreated && t != url.EventLinkDeleted && t != url.EventLinkClicked {
+			return nil, fmt.Errorf("%w: event type %s", ErrInvalidEndpoint, t)
+		}
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	e := Endpoint{
+		ID:        id.String(),
+		UserID:    userID,
+		URL:       endpointURL,
+		Events:    events,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err = d.store.AddEndpoint(ctx, e); err != nil {
+		return nil, fmt.Errorf("webhook store error: %w", err)
+	}
+
+	return &e, nil
+}
+
+// List returns user endpoints without secrets.
+func (d *dispatcher) List(ctx context.Context, userID string) ([]Endpoint, error) {
+	endpoints, err := d.store.GetEndpoints(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("webhook store error: %w", err)
+	}
+
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+
+	return endpoints, nil
+}
+
+// Remove deletes user endpoint.
+func (d *dispatcher) Remove(ctx context.Context, userID, id string) error {
+	return d.store.DeleteEndpoint(ctx, userID, id)
+}
+
+// Deliveries returns the last delivery attempts of the user endpoints.
+func (d *dispatcher) Deliveries(ctx context.Context, userID string, limit int) ([]Delivery, error) {
+	return d.store.GetDeliveries(ctx, userID, limit)
+}
+
+// DeadLetters returns the last undelivered payloads of the user endpoints.
+func (d *dispatcher) DeadLetters(ctx context.Context, userID string, limit int) ([]DeadLetter, error) {
+	return d.store.GetDeadLetters(ctx, userID, limit)
+}
+
+// dispatch starts the deliveries of the event to the subscribed endpoints.
+func (d *dispatcher) dispatch(ctx context.Context, e url.LinkEvent) error {
+	if e.UserID == "" {
+		owner, err := d.owner(ctx, e.LinkID)
+		if err != nil {
+			return fmt.Errorf("webhook owner not found: %w", err)
+		}
+		e.UserID = owner
+	}
+
+	endpoints, err := d.store.GetEndpoints(ctx, e.UserID)
+	if err != nil {
+		return fmt.Errorf("webhook store error: %w", err)
+	}
+
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("webhook event id error: %w", err)
+	}
+
+	payload := Payload{ID: id.String(), LinkEvent: e}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("webhook payload error: %w", err)
+	}
+
+	for _, ep := range endpoints {
+		if !ep.Subscribed(e.Type) {
+			continue
+		}
+
+		if !d.acquire(ctx) {
+			return ctx.Err()
+		}
+
+		d.wg.Add(1)
+		go func(ep Endpoint) {
+			defer d.wg.Done()
+			d.deliver(ctx, ep, payload, body)
+		}(ep)
+	}
+
+	return nil
+}
+
+// acquire takes a worker slot and returns false if ctx is done earlier.
+func (d *dispatcher) acquire(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case d.sem <- struct{}{}:
+		return true
+	}
+}
+
+// deliver sends the payload until success or MaxAttempts. The caller takes
+// the worker slot for the first attempt, the slot is released after every
+// attempt and taken again after the backoff.
+func (d *dispatcher) deliver(ctx context.Context, ep Endpoint, payload Payload, body []byte) {
+	var lastErr string
+	var attempt int
+
+	for attempt = 1; ; attempt++ {
+		statusCode, err := d.send(ctx, ep, payload, body)
+		<-d.sem
+
+		delivery := Delivery{
+			EndpointID: ep.ID,
+			UserID:     ep.UserID,
+			EventID:    payload.ID,
+			EventType:  payload.Type,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Time:       time.Now().UTC(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+			lastErr = delivery.Error
+		}
+
+		d.record(func(storeCtx context.Context) error {
+			return d.store.AddDelivery(storeCtx, delivery)
+		})
+
+		if err == nil {
+			return
+		}
+
+		if attempt >= d.opts.MaxAttempts || !sleep(ctx, d.backoff(attempt)) || !d.acquire(ctx) {
+			break
+		}
+	}
+
+	d.record(func(storeCtx context.Context) error {
+		return d.store.AddDeadLetter(storeCtx, DeadLetter{
+			EndpointID: ep.ID,
+			UserID:     ep.UserID,
+			Payload:    payload,
+			Attempts:   attempt,
+			Error:      lastErr,
+			Time:       time.Now().UTC(),
+		})
+	})
+}
+
+func (d *dispatcher) send(ctx context.Context, ep Endpoint, payload Payload, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Type)
+	req.Header.Set(DeliveryHeader, payload.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(ep.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *dispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > d.opts.MaxBackoff {
+		return d.opts.MaxBackoff
+	}
+
+	return delay
+}
+
+// sleep waits for the delay and returns false if ctx is done earlier.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// record saves delivery results independently of the dispatcher context,
+// so the results of canceled deliveries are not lost on shutdown.
+func (d *dispatcher) record(save func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := save(ctx); err != nil {
+		d.log.Error("webhook store error", zap.Error(err))
+	}
+}
+
+// Sign returns the signature header value: HMAC-SHA256 of the timestamp
+// and body joined with a dot.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,321 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUserID = "cfb31f30-efa9-4244-b1d6-e04c8438771d"
+
+func testOptions() Options {
+	return Options{
+		QueueSize:   10,
+		Workers:     2,
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		Timeout:     time.Second,
+
+		AllowedSubnets: mustCIDRs("127.0.0.0/8"),
+	}
+}
+
+// publicLookup resolves every host to the public address.
+func publicLookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+}
+
+func TestDeliver(t *testing.T) {
+	received := make(chan Payload, 1)
+	var secret string
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, url.EventLinkClicked, r.Header.Get(EventHeader))
+		assert.Equal(t, Sign(secret, r.Header.Get(TimestampHeader), body), r.Header.Get(SignatureHeader))
+
+		var p Payload
+		require.NoError(t, json.Unmarshal(body, &p))
+		received <- p
+	}))
+	defer receiver.Close()
+
+	owner := func(ctx context.Context, linkID string) (string, error) {
+		return testUserID, nil
+	}
+
+	d := NewDispatcher(NewMemStore(), owner, testOptions())
+
+	ep, err := d.Register(context.Background(), testUserID, receiver.URL, []string{url.EventLinkClicked})
+	require.NoError(t, err)
+	secret = ep.Secret
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx)
+
+	d.Publish(url.LinkEvent{Type: url.EventLinkCreated, UserID: testUserID, LinkID: "1"})
+	d.Publish(url.LinkEvent{Type: url.EventLinkClicked, LinkID: "2", URL: "http://shortener.com"})
+
+	select {
+	case p := <-received:
+		assert.Equal(t, "2", p.LinkID)
+		assert.Equal(t, testUserID, p.UserID)
+	case <-time.After(time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	assert.Eventually(t, func() bool {
+		deliveries, err := d.Deliveries(context.Background(), testUserID, 0)
+		return err == nil && len(deliveries) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	d.Wait()
+
+	deliveries, err := d.Deliveries(context.Background(), testUserID, 0)
+	assert.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	assert.Equal(t, 1, deliveries[0].Attempt)
+
+	endpoints, err := d.List(context.Background(), testUserID)
+	assert.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Empty(t, endpoints[0].Secret)
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	var calls int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	d := NewDispatcher(NewMemStore(), nil, testOptions())
+
+	_, err := d.Register(context.Background(), testUserID, receiver.URL, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+
+	d.Publish(url.LinkEvent{Type: url.EventLinkDeleted, UserID: testUserID, LinkID: "1"})
+
+	assert.Eventually(t, func() bool {
+		deadLetters, err := d.DeadLetters(context.Background(), testUserID, 0)
+		return err == nil && len(deadLetters) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	deliveries, err := d.Deliveries(context.Background(), testUserID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 3)
+
+	deadLetters, err := d.DeadLetters(context.Background(), testUserID, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deadLetters[0].Attempts)
+	assert.Equal(t, "1", deadLetters[0].Payload.LinkID)
+}
+
+func TestRegister(t *testing.T) {
+	d := NewDispatcher(NewMemStore(), nil, testOptions())
+	d.guard.lookup = publicLookup
+
+	_, err := d.Register(context.Background(), testUserID, "ftp://example.com", nil)
+	assert.Error(t, err)
+
+	_, err = d.Register(context.Background(), testUserID, "http://example.com", []string{"link.updated"})
+	assert.Error(t, err)
+
+	ep, err := d.Register(context.Background(), testUserID, "http://example.com", nil)
+	require.NoError(t, err)
+	assert.Len(t, ep.Secret, 64)
+
+	assert.NoError(t, d.Remove(context.Background(), testUserID, ep.ID))
+	assert.ErrorIs(t, d.Remove(context.Background(), testUserID, ep.ID), ErrNotFound)
+}
+
+func TestRegisterForbidden(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		lookup string
+	}{
+		{name: "loopback", url: "http://localhost:8080/hook", lookup: "::1"},
+		{name: "private", url: "http://10.0.0.5/hook"},
+		{name: "private name", url: "https://intranet.example.com", lookup: "192.168.1.10"},
+		{name: "metadata", url: "http://169.254.169.254/latest/meta-data"},
+		{name: "unspecified", url: "http://0.0.0.0:8080"},
+		{name: "cgnat", url: "http://100.64.1.1"},
+		{name: "ipv6 unique local", url: "http://[fd00::1]/hook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDispatcher(NewMemStore(), nil, Options{})
+			if tt.lookup != "" {
+				d.guard.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+					return []net.IPAddr{{IP: net.ParseIP(tt.lookup)}}, nil
+				}
+			}
+
+			_, err := d.Register(context.Background(), testUserID, tt.url, nil)
+			assert.ErrorIs(t, err, ErrInvalidEndpoint)
+		})
+	}
+
+	d := NewDispatcher(NewMemStore(), nil, Options{AllowedSubnets: mustCIDRs("10.0.0.0/8")})
+	_, err := d.Register(context.Background(), testUserID, "http://10.0.0.5/hook", nil)
+	assert.NoError(t, err)
+}
+
+func TestDeliverRebound(t *testing.T) {
+	var calls int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer receiver.Close()
+
+	opts := testOptions()
+	opts.AllowedSubnets = nil
+
+	d := NewDispatcher(NewMemStore(), nil, opts)
+	d.guard.lookup = publicLookup
+
+	_, err := d.Register(context.Background(), testUserID, receiver.URL, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx)
+
+	d.Publish(url.LinkEvent{Type: url.EventLinkCreated, UserID: testUserID, LinkID: "1"})
+
+	assert.Eventually(t, func() bool {
+		deadLetters, err := d.DeadLetters(context.Background(), testUserID, 0)
+		return err == nil && len(deadLetters) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Zero(t, atomic.LoadInt32(&calls))
+
+	deadLetters, err := d.DeadLetters(context.Background(), testUserID, 0)
+	require.NoError(t, err)
+	assert.Contains(t, deadLetters[0].Error, "not allowed")
+}
+
+func TestDeliverRetryReleasesWorker(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	received := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	opts := testOptions()
+	opts.Workers = 1
+	opts.BaseBackoff = time.Minute
+	opts.MaxBackoff = time.Minute
+
+	d := NewDispatcher(NewMemStore(), nil, opts)
+
+	_, err := d.Register(context.Background(), testUserID, failing.URL, nil)
+	require.NoError(t, err)
+	_, err = d.Register(context.Background(), testUserID, receiver.URL, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx)
+
+	d.Publish(url.LinkEvent{Type: url.EventLinkCreated, UserID: testUserID, LinkID: "1"})
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("webhook blocked by the retry of another endpoint")
+	}
+
+	assert.Eventually(t, func() bool {
+		deliveries, err := d.Deliveries(context.Background(), testUserID, 0)
+		return err == nil && len(deliveries) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	d.Wait()
+
+	deadLetters, err := d.DeadLetters(context.Background(), testUserID, 0)
+	assert.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, 1, deadLetters[0].Attempts)
+}
+
+func TestEnqueue(t *testing.T) {
+	received := make(chan Payload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		received <- p
+	}))
+	defer receiver.Close()
+
+	owner := func(ctx context.Context, linkID string) (string, error) {
+		if linkID == "404" {
+			return "", errors.New("link not found")
+		}
+		return testUserID, nil
+	}
+
+	opts := testOptions()
+	opts.QueueSize = 0
+
+	d := NewDispatcher(NewMemStore(), owner, opts)
+
+	_, err := d.Register(context.Background(), testUserID, receiver.URL, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	err = d.Enqueue(ctx, url.LinkEvent{Type: url.EventLinkCreated, LinkID: "1"})
+	cancel()
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "not started dispatcher must not accept events")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	d.Start(ctx)
+
+	err = d.Enqueue(context.Background(), url.LinkEvent{Type: url.EventLinkCreated, LinkID: "404"})
+	assert.Error(t, err)
+
+	err = d.Enqueue(context.Background(), url.LinkEvent{Type: url.EventLinkCreated, LinkID: "1"})
+	assert.NoError(t, err)
+
+	select {
+	case p := <-received:
+		assert.Equal(t, "1", p.LinkID)
+	case <-time.After(time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	cancel()
+	d.Wait()
+}
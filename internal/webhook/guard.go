@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// reserved are the special-purpose IPv4 ranges not covered by net.IP
+// methods: "this network", shared address space (CGNAT) and benchmarking.
+var reserved = mustCIDRs("0.0.0.0/8", "100.64.0.0/10", "198.18.0.0/15")
+
+// guard rejects the webhook addresses that are not public, so the users
+// can't reach the internal network (loopback, private and link-local
+// ranges including the cloud metadata 169.254.169.254). Addresses in the
+// allowed subnets pass anyway.
+type guard struct {
+	allowed []*net.IPNet
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newGuard(allowed []*net.IPNet) *guard {
+	return &guard{allowed: allowed, lookup: net.DefaultResolver.LookupIPAddr}
+}
+
+// checkHost resolves the host and returns ErrInvalidEndpoint if any of its
+// addresses is not allowed.
+func (g *guard) checkHost(ctx context.Context, host string) error {
+	addrs, err := g.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: host %s: %v", ErrInvalidEndpoint, host, err)
+	}
+
+	for _, a := range addrs {
+		if err = g.checkIP(a.IP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *guard) checkIP(ip net.IP) error {
+	for _, n := range g.allowed {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+
+	if !public(ip) {
+		return fmt.Errorf("%w: address %s not allowed", ErrInvalidEndpoint, ip)
+	}
+
+	return nil
+}
+
+// control checks the address right before the connection, after the DNS
+// resolution, so the host rebound to internal address is rejected too.
+func (g *guard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: address %s not allowed", ErrInvalidEndpoint, host)
+	}
+
+	return g.checkIP(ip)
+}
+
+// dialer returns the dialer checking every connected address.
+func (g *guard) dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout, Control: g.control}
+}
+
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, n := range reserved {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustCIDRs(list ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}
@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+)
+
+const memLogSize = 1000
+
+type memStore struct {
+	endpoints   map[string][]Endpoint
+	deliveries  map[string][]Delivery
+	deadLetters map[string][]DeadLetter
+	mu          sync.RWMutex
+}
+
+// NewMemStore returns in-memory Store. Delivery log and dead letters keep
+// only the last records of each user.
+func NewMemStore() Store {
+	return &memStore{
+		endpoints:   make(map[string][]Endpoint),
+		deliveries:  make(map[string][]Delivery),
+		deadLetters: make(map[string][]DeadLetter),
+	}
+}
+
+// AddEndpoint saves endpoint in memory.
+func (m *memStore) AddEndpoint(ctx context.Context, e Endpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.endpoints[e.UserID] = append(m.endpoints[e.UserID], e)
+
+	return nil
+}
+
+// GetEndpoints returns all user endpoints from memory.
+func (m *memStore) GetEndpoints(ctx context.Context, userID string) ([]Endpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]Endpoint(nil), m.endpoints[userID]...), nil
+}
+
+// DeleteEndpoint removes user endpoint from memory.
+func (m *memStore) DeleteEndpoint(ctx context.Context, userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoints := m.endpoints[userID]
+	for i, e := range endpoints {
+		if e.ID == id {
+			m.endpoints[userID] = append(endpoints[:i:i], endpoints[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// AddDelivery appends delivery to the user log in memory.
+func (m *memStore) AddDelivery(ctx context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveries[d.UserID] = tail(append(m.deliveries[d.UserID], d), memLogSize)
+
+	return nil
+}
+
+// GetDeliveries returns the last user deliveries from memory.
+func (m *memStore) GetDeliveries(ctx context.Context, userID string, limit int) ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]Delivery(nil), tail(m.deliveries[userID], limit)...), nil
+}
+
+// AddDeadLetter appends dead letter to the user list in memory.
+func (m *memStore) AddDeadLetter(ctx context.Context, d DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deadLetters[d.UserID] = tail(append(m.deadLetters[d.UserID], d), memLogSize)
+
+	return nil
+}
+
+// GetDeadLetters returns the last user dead letters from memory.
+func (m *memStore) GetDeadLetters(ctx context.Context, userID string, limit int) ([]DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]DeadLetter(nil), tail(m.deadLetters[userID], limit)...), nil
+}
+
+func tail[T any](s []T, n int) []T {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	return s[len(s)-n:]
+}
+
+// Close implements Store interface, memory store has nothing to release.
+func (m *memStore) Close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package webhook delivers link events to the user registered endpoints.
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/url"
+)
+
+// Endpoint is the user registered webhook receiver.
+type Endpoint struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"-"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+
+	// Secret is the HMAC key. It is shown to the user only on registration.
+	Secret string `json:"secret,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the endpoint receives events of the type.
+// Endpoint without events receives all of them.
+func (e *Endpoint) Subscribed(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Payload is the body of the webhook request.
+type Payload struct {
+	ID string `json:"id"`
+	url.LinkEvent
+}
+
+// Delivery is one attempt to deliver the payload to the endpoint.
+type Delivery struct {
+	EndpointID string    `json:"endpoint_id"`
+	UserID     string    `json:"-"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// DeadLetter is the payload that could not be delivered after all attempts.
+type DeadLetter struct {
+	EndpointID string    `json:"endpoint_id"`
+	UserID     string    `json:"-"`
+	Payload    Payload   `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	Time       time.Time `json:"time"`
+}
+
+// Store keeps endpoints, delivery log and dead letters.
+type Store interface {
+	AddEndpoint(ctx context.Context, e Endpoint) error
+	GetEndpoints(ctx context.Context, userID string) ([]Endpoint, error)
+	DeleteEndpoint(ctx context.Context, userID, id string) error
+	AddDelivery(ctx context.Context, d Delivery) error
+	GetDeliveries(ctx context.Context, userID string, limit int) ([]Delivery, error)
+	AddDeadLetter(ctx context.Context, d DeadLetter) error
+	GetDeadLetters(ctx context.Context, userID string, limit int) ([]DeadLetter, error)
+
+	// Close releases the store resources.
+	Close() error
+}
+
+// Service is the webhook management for users.
+type Service interface {
+	Register(ctx context.Context, userID, endpointURL string, events []string) (*Endpoint, error)
+	List(ctx context.Context, userID string) ([]Endpoint, error)
+	Remove(ctx context.Context, userID, id string) error
+	Deliveries(ctx context.Context, userID string, limit int) ([]Delivery, error)
+	DeadLetters(ctx context.Context, userID string, limit int) ([]DeadLetter, error)
+}
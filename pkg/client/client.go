@@ -0,0 +1,134 @@
+// Package client is the Go SDK for the URL shortener. HTTP and gRPC
+// transports implement one Client interface with the same auth token
+// handling, typed errors and retries of idempotent calls.
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Client is the shortener API client. Deadlines and cancellation of ctx are
+// respected by all calls including retries.
+type Client interface {
+	// Shorten stores URL. DuplicateError with the existing link is returned
+	// for URL already shortened.
+	Shorten(ctx context.Context, url string) (*Link, error)
+
+	// ShortenBatch stores URLs. Already shortened URLs get existing IDs.
+	ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error)
+
+	// List returns all links of the user.
+	List(ctx context.Context) ([]Link, error)
+
+	// Delete removes links of the user. Links are removed asynchronously.
+	Delete(ctx context.Context, ids []string) error
+
+	// Resolve returns the original URL of the link.
+	Resolve(ctx context.Context, id string) (string, error)
+
+	// Stats returns the service statistics. It is allowed for trusted
+	// subnets only.
+	Stats(ctx context.Context) (*Stats, error)
+
+	// Ping checks the service storage.
+	Ping(ctx context.Context) error
+
+	// Close releases the transport resources.
+	Close() error
+}
+
+// Link is the short link.
+type Link struct {
+	ID       string `json:"id"`
+	ShortURL string `json:"short_url,omitempty"`
+	URL      string `json:"url"`
+}
+
+// BatchItem is the URL of the batch.
+type BatchItem struct {
+	CorrelationID string `json:"correlation_id"`
+	URL           string `json:"url"`
+}
+
+// BatchResult is the link for the batch item.
+type BatchResult struct {
+	CorrelationID string `json:"correlation_id"`
+	ID            string `json:"id"`
+	ShortURL      string `json:"short_url,omitempty"`
+}
+
+// Stats is the service statistics.
+type Stats struct {
+	URLs  int `json:"urls"`
+	Users int `json:"users"`
+}
+
+// Options are the client parameters.
+type Options struct {
+	// Tokens keeps the auth token between calls and processes. A new user
+	// is created by the service if no token is stored.
+	Tokens TokenStore
+
+	// MaxAttempts is the number of attempts of idempotent calls.
+	MaxAttempts int
+
+	// BaseBackoff is the delay before the second attempt. It doubles for
+	// each next attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Timeout is the limit for one attempt if ctx has no earlier deadline.
+	// Zero means no limit.
+	Timeout time.Duration
+
+	// BaseURL builds short URLs for the gRPC transport, which returns IDs
+	// only. Short URLs are left empty if it is not set.
+	BaseURL string
+}
+
+// DefaultOptions returns the client parameters with in-memory token.
+func DefaultOptions() Options {
+	return Options{
+		Tokens:      NewMemoryTokenStore(""),
+		MaxAttempts: 3,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+		Timeout:     5 * time.Second,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+
+	if o.Tokens == nil {
+		o.Tokens = d.Tokens
+	}
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = 1
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = d.BaseBackoff
+	}
+	if o.MaxBackoff < o.BaseBackoff {
+		o.MaxBackoff = o.BaseBackoff
+	}
+	o.BaseURL = strings.TrimRight(o.BaseURL, "/")
+
+	return o
+}
+
+// attemptContext returns ctx limited by the attempt timeout.
+func (o Options) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+// idFromShortURL returns the last path segment of the short URL.
+func idFromShortURL(shortURL string) string {
+	return shortURL[strings.LastIndexByte(shortURL, '/')+1:]
+}
@@ -0,0 +1,314 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ruskiiamov/shortener/internal/chi"
+	"github.com/ruskiiamov/shortener/internal/data"
+	"github.com/ruskiiamov/shortener/internal/grpcserver"
+	"github.com/ruskiiamov/shortener/internal/problem"
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"github.com/ruskiiamov/shortener/internal/server"
+	"github.com/ruskiiamov/shortener/internal/url"
+	"github.com/ruskiiamov/shortener/internal/user"
+	"github.com/ruskiiamov/shortener/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testBaseURL = "http://short.test"
+
+type backend struct {
+	ua     user.Authorizer
+	uc     url.Converter
+	delBuf chan *url.DelBatch
+	clicks *clickCounter
+}
+
+// clickCounter counts the published link.clicked events.
+type clickCounter struct {
+	n atomic.Int64
+}
+
+func (c *clickCounter) Publish(e url.LinkEvent) {
+	if e.Type == url.EventLinkClicked {
+		c.n.Add(1)
+	}
+}
+
+func newBackend(t *testing.T) *backend {
+	t.Helper()
+
+	dataKeeper, err := data.NewKeeper("", "", nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	clicks := new(clickCounter)
+	uc := url.NewConverter(dataKeeper, url.Quota{}, nil, clicks, nil, nil)
+	delBuf, _ := url.StartDeleteURL(ctx, uc, nil, nil, nil)
+
+	return &backend{
+		ua:     user.NewAuthorizer([]byte("secret")),
+		uc:     uc,
+		delBuf: delBuf,
+		clicks: clicks,
+	}
+}
+
+func newHTTPClient(t *testing.T, b *backend, opts client.Options) client.Client {
+	t.Helper()
+
+	h, err := server.NewHandler(context.Background(), b.ua, b.uc, nil, nil, chi.NewRouter(), b.delBuf, url.NewDomains(url.Domain{BaseURL: testBaseURL}), nil, nil, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	c := client.NewHTTP(ts.URL, ts.Client(), opts)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func newGRPCClient(t *testing.T, b *backend, opts client.Options) client.Client {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcserver.NewLoggingInterceptor(nil), grpcserver.NewAccessInterceptor(nil), grpcserver.NewAuthInterceptor(b.ua, nil)),
+		grpc.ChainStreamInterceptor(grpcserver.NewLoggingStreamInterceptor(nil), grpcserver.NewAccessStreamInterceptor(nil), grpcserver.NewAuthStreamInterceptor(b.ua, nil)),
+	)
+	pb.RegisterShortenerServer(s, grpcserver.NewGRPCServer(b.uc, b.delBuf))
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	c, err := client.DialGRPC(
+		"bufnet",
+		opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestClient(t *testing.T) {
+	transports := []struct {
+		name string
+		new  func(t *testing.T, b *backend, opts client.Options) client.Client
+	}{
+		{name: "http", new: newHTTPClient},
+		{name: "grpc", new: newGRPCClient},
+	}
+
+	for _, tt := range transports {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := newBackend(t)
+
+			opts := client.DefaultOptions()
+			opts.BaseURL = testBaseURL
+			c := tt.new(t, b, opts)
+
+			link, err := c.Shorten(ctx, "http://example.com/a")
+			require.NoError(t, err)
+			assert.NotEmpty(t, link.ID)
+			assert.Equal(t, testBaseURL+"/"+link.ID, link.ShortURL)
+
+			token, err := opts.Tokens.Token()
+			require.NoError(t, err)
+			assert.NotEmpty(t, token)
+
+			_, err = c.Shorten(ctx, "http://example.com/a")
+			var errDupl *client.DuplicateError
+			require.ErrorAs(t, err, &errDupl)
+			assert.Equal(t, link.ID, errDupl.Link.ID)
+			assert.ErrorIs(t, err, client.ErrDuplicate)
+
+			_, err = c.Shorten(ctx, "not a url")
+			assert.ErrorIs(t, err, client.ErrInvalidURL)
+
+			results, err := c.ShortenBatch(ctx, []client.BatchItem{
+				{CorrelationID: "1", URL: "http://example.com/b"},
+				{CorrelationID: "2", URL: "http://example.com/a"},
+			})
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.Equal(t, "1", results[0].CorrelationID)
+			assert.Equal(t, link.ID, results[1].ID)
+
+			links, err := c.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, links, 2)
+
+			original, err := c.Resolve(ctx, link.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "http://example.com/a", original)
+
+			permanent, err := b.uc.Shorten(ctx, "owner", "", "http://example.com/permanent", url.Redirect{Code: http.StatusPermanentRedirect})
+			require.NoError(t, err)
+			original, err = c.Resolve(ctx, permanent.EncodedID)
+			require.NoError(t, err)
+			assert.Equal(t, "http://example.com/permanent", original)
+
+			_, err = c.Resolve(ctx, "zzzzzz")
+			assert.ErrorIs(t, err, client.ErrNotFound)
+
+			assert.Zero(t, b.clicks.n.Load(), "resolve is not a click")
+
+			_, err = c.Stats(ctx)
+			assert.ErrorIs(t, err, client.ErrForbidden)
+
+			// The memory data keeper has no storage to ping.
+			var e *client.Error
+			require.ErrorAs(t, c.Ping(ctx), &e)
+			assert.Equal(t, client.CodeInternal, e.Code)
+			assert.NotEmpty(t, e.RequestID)
+
+			require.NoError(t, c.Delete(ctx, []string{link.ID}))
+
+			// Deletion buffer is flushed on close.
+			close(b.delBuf)
+			assert.Eventually(t, func() bool {
+				_, err = c.Resolve(ctx, link.ID)
+				return errors.Is(err, client.ErrLinkDeleted)
+			}, time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestClientTokenReuse(t *testing.T) {
+	ctx := context.Background()
+	b := newBackend(t)
+
+	tokens := client.NewFileTokenStore(filepath.Join(t.TempDir(), "token"))
+
+	opts := client.DefaultOptions()
+	opts.Tokens = tokens
+
+	link, err := newHTTPClient(t, b, opts).Shorten(ctx, "http://example.com/a")
+	require.NoError(t, err)
+
+	links, err := newGRPCClient(t, b, opts).List(ctx)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, link.ID, links[0].ID)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	opts := client.DefaultOptions()
+	opts.BaseBackoff = time.Millisecond
+
+	c := client.NewHTTP(ts.URL, nil, opts)
+
+	assert.NoError(t, c.Ping(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	_, err := c.Shorten(context.Background(), "http://example.com")
+	var e *client.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, client.CodeUnavailable, e.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, c.Ping(ctx), context.Canceled)
+}
+
+func TestCodes(t *testing.T) {
+	kinds := map[string]problem.Kind{
+		client.CodeInternal:            problem.Internal,
+		client.CodeBadRequest:          problem.BadRequest,
+		client.CodeInvalidURL:          problem.InvalidURL,
+		client.CodeInvalidID:           problem.InvalidID,
+		client.CodeEmptyBatch:          problem.EmptyBatch,
+		client.CodeNotFound:            problem.NotFound,
+		client.CodeLinkDeleted:         problem.LinkDeleted,
+		client.CodeDuplicate:           problem.Duplicate,
+		client.CodeQuotaExceeded:       problem.QuotaExceeded,
+		client.CodeRateLimited:         problem.RateLimited,
+		client.CodeForbidden:           problem.Forbidden,
+		client.CodeBodyTooLarge:        problem.BodyTooLarge,
+		client.CodeUnsupportedEncoding: problem.UnsupportedEncoding,
+		client.CodeTimeout:             problem.Timeout,
+	}
+
+	for code, kind := range kinds {
+		assert.Equal(t, kind.Code, code)
+	}
+}
+
+func TestHTTPResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		want     string
+		wantErr  bool
+	}{
+		{name: "moved permanently", status: http.StatusMovedPermanently, location: "http://example.com/a", want: "http://example.com/a"},
+		{name: "found", status: http.StatusFound, location: "http://example.com/b", want: "http://example.com/b"},
+		{name: "temporary", status: http.StatusTemporaryRedirect, location: "http://example.com/c", want: "http://example.com/c"},
+		{name: "permanent", status: http.StatusPermanentRedirect, location: "http://example.com/d", want: "http://example.com/d"},
+		{name: "no location", status: http.StatusFound, wantErr: true},
+		{name: "not redirect", status: http.StatusOK, location: "http://example.com/e", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodHead, r.Method)
+				assert.Equal(t, "/1", r.URL.Path)
+				if tt.location != "" {
+					w.Header().Set("Location", tt.location)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			opts := client.DefaultOptions()
+			opts.MaxAttempts = 1
+			c := client.NewHTTP(ts.URL, ts.Client(), opts)
+			defer c.Close()
+
+			got, err := c.Resolve(context.Background(), "1")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
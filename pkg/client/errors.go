@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Problem type codes reported by the service.
+const (
+	CodeInternal            = "internal"
+	CodeBadRequest          = "bad-request"
+	CodeInvalidURL          = "invalid-url"
+	CodeInvalidID           = "invalid-id"
+	CodeEmptyBatch          = "empty-batch"
+	CodeNotFound            = "not-found"
+	CodeLinkDeleted         = "link-deleted"
+	CodeDuplicate           = "duplicate-url"
+	CodeQuotaExceeded       = "quota-exceeded"
+	CodeRateLimited         = "rate-limited"
+	CodeForbidden           = "forbidden"
+	CodeBodyTooLarge        = "body-too-large"
+	CodeUnsupportedEncoding = "unsupported-encoding"
+	CodeTimeout             = "timeout"
+	CodeUnavailable         = "unavailable"
+)
+
+// Errors to match returned errors with errors.Is.
+var (
+	ErrInvalidURL    = &Error{Code: CodeInvalidURL}
+	ErrInvalidID     = &Error{Code: CodeInvalidID}
+	ErrNotFound      = &Error{Code: CodeNotFound}
+	ErrLinkDeleted   = &Error{Code: CodeLinkDeleted}
+	ErrDuplicate     = &Error{Code: CodeDuplicate}
+	ErrQuotaExceeded = &Error{Code: CodeQuotaExceeded}
+	ErrRateLimited   = &Error{Code: CodeRateLimited}
+	ErrForbidden     = &Error{Code: CodeForbidden}
+)
+
+// Error is the error reported by the service.
+type Error struct {
+	// Code is the problem type code, e.g. "not-found".
+	Code string
+
+	// Status is the HTTP status code or zero for gRPC.
+	Status int
+
+	// GRPCCode is the gRPC status code name or empty for HTTP.
+	GRPCCode string
+
+	// Message is the error detail. It is empty for server errors.
+	Message string
+
+	// RequestID is the service request ID for support.
+	RequestID string
+
+	// RetryAfter is the delay requested by the service before the next call.
+	RetryAfter time.Duration
+
+	// Err is the transport error for unavailable service.
+	Err error
+
+	// duplicateID is the existing link ID of the gRPC duplicate error.
+	duplicateID string
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	var b strings.Builder
+
+	b.WriteString("shortener: ")
+	b.WriteString(e.Code)
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request_id=%s)", e.RequestID)
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the transport error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is Error with the same code.
+func (e *Error) Is(target error) bool {
+	var t *Error
+	if !errors.As(target, &t) {
+		return false
+	}
+
+	return t.Code == e.Code
+}
+
+// DuplicateError is returned for URL already shortened. It matches
+// ErrDuplicate.
+type DuplicateError struct {
+	// Link is the existing link.
+	Link Link
+
+	Err *Error
+}
+
+// Error implements error interface.
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("shortener: URL %s already shortened as %s", e.Link.URL, e.Link.ID)
+}
+
+// Unwrap returns the service error.
+func (e *DuplicateError) Unwrap() error {
+	return e.Err
+}
+
+// retryable reports whether the call may succeed on the next attempt.
+func retryable(err error, idempotent bool) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	if !idempotent {
+		return e.Code == CodeRateLimited
+	}
+
+	switch e.Code {
+	case CodeRateLimited, CodeUnavailable, CodeTimeout:
+		return true
+	}
+
+	return false
+}
+
+// transportError returns Unavailable error for the failed call. Errors of
+// the done caller context are returned as is.
+func transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	code := CodeUnavailable
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = CodeTimeout
+	}
+
+	return &Error{Code: code, Message: err.Error(), Err: err}
+}
+
+// codeFromReason converts google.rpc.ErrorInfo reason to the problem code.
+func codeFromReason(reason string) string {
+	return strings.ToLower(strings.ReplaceAll(reason, "_", "-"))
+}
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/ruskiiamov/shortener/internal/proto/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authMetadata = "auth"
+
+type grpcClient struct {
+	client pb.ShortenerClient
+	closer io.Closer
+	opts   Options
+}
+
+// NewGRPC returns client of the Shortener v2 gRPC service on cc. The
+// connection is not closed by Close.
+func NewGRPC(cc grpc.ClientConnInterface, opts Options) Client {
+	return &grpcClient{
+		client: pb.NewShortenerClient(cc),
+		opts:   opts.withDefaults(),
+	}
+}
+
+// DialGRPC returns client of the Shortener v2 gRPC service at target. The
+// transport credentials must be set with dialOpts. The connection is closed
+// by Close.
+func DialGRPC(target string, opts Options, dialOpts ...grpc.DialOption) (Client, error) {
+	conn, err := grpc.Dial(target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewGRPC(conn, opts).(*grpcClient)
+	c.closer = conn
+
+	return c, nil
+}
+
+// Shorten implements Client interface.
+func (c *grpcClient) Shorten(ctx context.Context, url string) (*Link, error) {
+	var res *pb.AddURLResponse
+	err := c.opts.retry(ctx, false, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) (err error) {
+			res, err = c.client.AddURL(actx, &pb.AddURLRequest{Url: url}, opts...)
+			return err
+		})
+	})
+
+	var e *Error
+	if errors.As(err, &e) && e.Code == CodeDuplicate {
+		return nil, &DuplicateError{Link: c.link(e.duplicateID, url), Err: e}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	link := c.link(res.Id, url)
+
+	return &link, nil
+}
+
+// ShortenBatch implements Client interface.
+func (c *grpcClient) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	req := &pb.AddURLBatchRequest{Urls: make([]*pb.AddURLBatchRequestItem, 0, len(items))}
+	for _, item := range items {
+		req.Urls = append(req.Urls, &pb.AddURLBatchRequestItem{CorrelationId: item.CorrelationID, Url: item.URL})
+	}
+
+	var res *pb.AddURLBatchResponse
+	err := c.opts.retry(ctx, false, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) (err error) {
+			res, err = c.client.AddURLBatch(actx, req, opts...)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, 0, len(res.Ids))
+	for _, item := range res.Ids {
+		results = append(results, BatchResult{
+			CorrelationID: item.CorrelationId,
+			ID:            item.Id,
+			ShortURL:      c.shortURL(item.Id),
+		})
+	}
+
+	return results, nil
+}
+
+// List implements Client interface. Links are received with the ListURLs
+// stream.
+func (c *grpcClient) List(ctx context.Context) ([]Link, error) {
+	var links []Link
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		links = nil
+
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) error {
+			stream, err := c.client.ListURLs(actx, &pb.ListURLsRequest{}, opts...)
+			if err != nil {
+				return err
+			}
+
+			for {
+				res, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				links = append(links, c.link(res.Id, res.Url))
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// Delete implements Client interface.
+func (c *grpcClient) Delete(ctx context.Context, ids []string) error {
+	return c.opts.retry(ctx, true, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) error {
+			_, err := c.client.DeleteURLBatch(actx, &pb.DeleteURLBatchRequest{Ids: ids}, opts...)
+			return err
+		})
+	})
+}
+
+// Resolve implements Client interface.
+func (c *grpcClient) Resolve(ctx context.Context, id string) (string, error) {
+	var res *pb.GetURLResponse
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) (err error) {
+			res, err = c.client.GetURL(actx, &pb.GetURLRequest{Id: id}, opts...)
+			return err
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return res.Url, nil
+}
+
+// Stats implements Client interface.
+func (c *grpcClient) Stats(ctx context.Context) (*Stats, error) {
+	var res *pb.GetStatsResponse
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) (err error) {
+			res, err = c.client.GetStats(actx, &pb.GetStatsRequest{}, opts...)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stats{URLs: int(res.Urls), Users: int(res.Users)}, nil
+}
+
+// Ping implements Client interface.
+func (c *grpcClient) Ping(ctx context.Context) error {
+	return c.opts.retry(ctx, true, func(actx context.Context) error {
+		return c.call(ctx, actx, func(actx context.Context, opts ...grpc.CallOption) error {
+			_, err := c.client.PingDB(actx, &pb.PingDBRequest{}, opts...)
+			return err
+		})
+	})
+}
+
+// Close implements Client interface.
+func (c *grpcClient) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+
+	return c.closer.Close()
+}
+
+// call makes one RPC with the stored token and stores the token issued by
+// the service. ctx is the caller context, actx is the attempt context.
+func (c *grpcClient) call(ctx, actx context.Context, rpc func(actx context.Context, opts ...grpc.CallOption) error) error {
+	token, err := c.opts.Tokens.Token()
+	if err != nil {
+		return fmt.Errorf("token store: %w", err)
+	}
+	if token != "" {
+		actx = metadata.AppendToOutgoingContext(actx, authMetadata, token)
+	}
+
+	var header metadata.MD
+	rpcErr := rpc(actx, grpc.Header(&header))
+
+	if values := header.Get(authMetadata); len(values) > 0 && values[0] != token {
+		if err = c.opts.Tokens.SetToken(values[0]); err != nil {
+			return fmt.Errorf("token store: %w", err)
+		}
+	}
+
+	if rpcErr != nil {
+		return grpcError(ctx, rpcErr)
+	}
+
+	return nil
+}
+
+func (c *grpcClient) link(id, url string) Link {
+	return Link{ID: id, ShortURL: c.shortURL(id), URL: url}
+}
+
+func (c *grpcClient) shortURL(id string) string {
+	if c.opts.BaseURL == "" || id == "" {
+		return ""
+	}
+
+	return c.opts.BaseURL + "/" + id
+}
+
+// grpcError returns Error from the status details or from the status code.
+// Errors of the done caller context are returned as is.
+func grpcError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return transportError(ctx, err)
+	}
+
+	e := &Error{
+		Code:     grpcCode(st.Code()),
+		GRPCCode: st.Code().String(),
+		Message:  st.Message(),
+	}
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			e.Code = codeFromReason(d.Reason)
+			e.duplicateID = d.Metadata["id"]
+		case *errdetails.RequestInfo:
+			e.RequestID = d.RequestId
+		case *errdetails.RetryInfo:
+			e.RetryAfter = d.RetryDelay.AsDuration()
+		}
+	}
+
+	return e
+}
+
+// grpcCode returns problem code for status without google.rpc.ErrorInfo.
+func grpcCode(code codes.Code) string {
+	switch code {
+	case codes.InvalidArgument:
+		return CodeBadRequest
+	case codes.NotFound:
+		return CodeNotFound
+	case codes.AlreadyExists:
+		return CodeDuplicate
+	case codes.FailedPrecondition:
+		return CodeLinkDeleted
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return CodeForbidden
+	case codes.ResourceExhausted:
+		return CodeRateLimited
+	case codes.Unavailable:
+		return CodeUnavailable
+	case codes.DeadlineExceeded:
+		return CodeTimeout
+	}
+
+	return CodeInternal
+}
@@ -0,0 +1,379 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	authCookieName     = "auth"
+	requestIDHeader    = "X-Request-ID"
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "/problems/"
+)
+
+type httpClient struct {
+	baseURL string
+	client  *http.Client
+	opts    Options
+}
+
+// NewHTTP returns client of the HTTP API at baseURL. Redirects are not
+// followed and cookies are handled by the client, so hc is copied with
+// CheckRedirect and Jar replaced. http.DefaultClient is used if hc is nil.
+func NewHTTP(baseURL string, hc *http.Client, opts Options) Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	c := *hc
+	c.Jar = nil
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &httpClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &c,
+		opts:    opts.withDefaults(),
+	}
+}
+
+type httpResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Shorten implements Client interface.
+func (c *httpClient) Shorten(ctx context.Context, url string) (*Link, error) {
+	body, err := json.Marshal(struct {
+		URL string `json:"url"`
+	}{URL: url})
+	if err != nil {
+		return nil, err
+	}
+
+	var res *httpResponse
+	err = c.opts.retry(ctx, false, func(actx context.Context) error {
+		res, err = c.send(ctx, actx, http.MethodPost, "/api/shorten", body)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusCreated, http.StatusConflict)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Result string `json:"result"`
+	}
+	if err = json.Unmarshal(res.body, &data); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	link := Link{ID: idFromShortURL(data.Result), ShortURL: data.Result, URL: url}
+
+	if res.status == http.StatusConflict {
+		return nil, &DuplicateError{
+			Link: link,
+			Err:  &Error{Code: CodeDuplicate, Status: res.status, RequestID: res.header.Get(requestIDHeader)},
+		}
+	}
+
+	return &link, nil
+}
+
+// ShortenBatch implements Client interface.
+func (c *httpClient) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	type requestItem struct {
+		CorrelationID string `json:"correlation_id"`
+		OriginalURL   string `json:"original_url"`
+	}
+
+	reqData := make([]requestItem, 0, len(items))
+	for _, item := range items {
+		reqData = append(reqData, requestItem{CorrelationID: item.CorrelationID, OriginalURL: item.URL})
+	}
+
+	body, err := json.Marshal(reqData)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *httpResponse
+	err = c.opts.retry(ctx, false, func(actx context.Context) error {
+		res, err = c.send(ctx, actx, http.MethodPost, "/api/shorten/batch", body)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusCreated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resData []struct {
+		CorrelationID string `json:"correlation_id"`
+		ShortURL      string `json:"short_url"`
+	}
+	if err = json.Unmarshal(res.body, &resData); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	results := make([]BatchResult, 0, len(resData))
+	for _, item := range resData {
+		results = append(results, BatchResult{
+			CorrelationID: item.CorrelationID,
+			ID:            idFromShortURL(item.ShortURL),
+			ShortURL:      item.ShortURL,
+		})
+	}
+
+	return results, nil
+}
+
+// List implements Client interface.
+func (c *httpClient) List(ctx context.Context) ([]Link, error) {
+	var res *httpResponse
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		var err error
+		res, err = c.send(ctx, actx, http.MethodGet, "/api/user/urls", nil)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusOK, http.StatusNoContent)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.status == http.StatusNoContent {
+		return nil, nil
+	}
+
+	var resData []struct {
+		ShortURL    string `json:"short_url"`
+		OriginalURL string `json:"original_url"`
+	}
+	if err = json.Unmarshal(res.body, &resData); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	links := make([]Link, 0, len(resData))
+	for _, item := range resData {
+		links = append(links, Link{ID: idFromShortURL(item.ShortURL), ShortURL: item.ShortURL, URL: item.OriginalURL})
+	}
+
+	return links, nil
+}
+
+// Delete implements Client interface.
+func (c *httpClient) Delete(ctx context.Context, ids []string) error {
+	body, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	return c.opts.retry(ctx, true, func(actx context.Context) error {
+		res, err := c.send(ctx, actx, http.MethodDelete, "/api/user/urls", body)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusAccepted)
+	})
+}
+
+// Resolve implements Client interface. Any redirect status with the
+// Location header is accepted, the status depends on the link settings.
+// HEAD is sent so the lookup is not counted as a click.
+func (c *httpClient) Resolve(ctx context.Context, id string) (string, error) {
+	var location string
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		res, err := c.send(ctx, actx, http.MethodHead, "/"+id, nil)
+		if err != nil {
+			return err
+		}
+		location = res.header.Get("Location")
+		if res.status < 300 || res.status > 399 || location == "" {
+			return httpError(res)
+		}
+		return nil
+	})
+
+	return location, err
+}
+
+// Stats implements Client interface.
+func (c *httpClient) Stats(ctx context.Context) (*Stats, error) {
+	var res *httpResponse
+	err := c.opts.retry(ctx, true, func(actx context.Context) error {
+		var err error
+		res, err = c.send(ctx, actx, http.MethodGet, "/api/internal/stats", nil)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusOK)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(Stats)
+	if err = json.Unmarshal(res.body, stats); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Ping implements Client interface.
+func (c *httpClient) Ping(ctx context.Context) error {
+	return c.opts.retry(ctx, true, func(actx context.Context) error {
+		res, err := c.send(ctx, actx, http.MethodGet, "/ping", nil)
+		if err != nil {
+			return err
+		}
+		return c.expect(res, http.StatusOK)
+	})
+}
+
+// Close implements Client interface.
+func (c *httpClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// send makes one request with the stored token and stores the token issued
+// by the service. ctx is the caller context, actx is the attempt context.
+func (c *httpClient) send(ctx, actx context.Context, method, path string, body []byte) (*httpResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(actx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := c.opts.Tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("token store: %w", err)
+	}
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: authCookieName, Value: token})
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, transportError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	resBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(ctx, err)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == authCookieName && cookie.Value != "" && cookie.Value != token {
+			if err = c.opts.Tokens.SetToken(cookie.Value); err != nil {
+				return nil, fmt.Errorf("token store: %w", err)
+			}
+		}
+	}
+
+	return &httpResponse{status: resp.StatusCode, header: resp.Header, body: resBody}, nil
+}
+
+// expect returns Error for the response status not in want.
+func (c *httpClient) expect(res *httpResponse, want ...int) error {
+	for _, status := range want {
+		if res.status == status {
+			return nil
+		}
+	}
+
+	return httpError(res)
+}
+
+// httpError returns Error from the problem details or from the status.
+func httpError(res *httpResponse) error {
+	e := &Error{
+		Code:      statusCode(res.status),
+		Status:    res.status,
+		RequestID: res.header.Get(requestIDHeader),
+	}
+
+	if seconds, err := strconv.Atoi(res.header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.header.Get("Content-Type"))
+	if mediaType != problemContentType {
+		return e
+	}
+
+	var details struct {
+		Type      string `json:"type"`
+		Detail    string `json:"detail"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(res.body, &details); err != nil {
+		return e
+	}
+
+	if strings.HasPrefix(details.Type, problemTypePrefix) {
+		e.Code = strings.TrimPrefix(details.Type, problemTypePrefix)
+	}
+	e.Message = details.Detail
+	if details.RequestID != "" {
+		e.RequestID = details.RequestID
+	}
+
+	return e
+}
+
+// statusCode returns problem code for response without problem details.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeDuplicate
+	case http.StatusGone:
+		return CodeLinkDeleted
+	case http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedEncoding
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUnavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeBadRequest
+}
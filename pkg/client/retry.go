@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// retry calls fn up to MaxAttempts times while the error is retryable. Calls
+// that are not idempotent are retried only if the service rejected them
+// before processing. The delay doubles after each attempt, Error.RetryAfter
+// overrides it.
+func (o Options) retry(ctx context.Context, idempotent bool, fn func(ctx context.Context) error) error {
+	backoff := o.BaseBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := o.attempt(ctx, fn)
+		if err == nil || attempt >= o.MaxAttempts || ctx.Err() != nil || !retryable(err, idempotent) {
+			return err
+		}
+
+		delay := backoff
+		var e *Error
+		if errors.As(err, &e) && e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+		if delay > o.MaxBackoff {
+			delay = o.MaxBackoff
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+func (o Options) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := o.attemptContext(ctx)
+	defer cancel()
+
+	return fn(ctx)
+}
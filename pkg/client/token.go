@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TokenStore keeps the auth token.
+type TokenStore interface {
+	Token() (string, error)
+	SetToken(token string) error
+}
+
+type memoryTokenStore struct {
+	mu    sync.RWMutex
+	token string
+}
+
+// NewMemoryTokenStore returns token store in memory with the initial token.
+func NewMemoryTokenStore(token string) TokenStore {
+	return &memoryTokenStore{token: token}
+}
+
+// Token implements TokenStore interface.
+func (s *memoryTokenStore) Token() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.token, nil
+}
+
+// SetToken implements TokenStore interface.
+func (s *memoryTokenStore) SetToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = token
+
+	return nil
+}
+
+type fileTokenStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileTokenStore returns token store in the file. The file is created
+// with owner-only permissions on the first token.
+func NewFileTokenStore(path string) TokenStore {
+	return &fileTokenStore{path: path}
+}
+
+// Token implements TokenStore interface. Missing file means no token.
+func (s *fileTokenStore) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetToken implements TokenStore interface.
+func (s *fileTokenStore) SetToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}